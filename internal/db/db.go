@@ -55,6 +55,7 @@ func InitDB(dbType, dsn string, debug bool) error {
 	if err := db.AutoMigrate(
 		&model.User{},
 		&model.Channel{},
+		&model.ChannelKey{},
 		&model.Group{},
 		&model.GroupItem{},
 		&model.LLMInfo{},
@@ -65,7 +66,10 @@ func InitDB(dbType, dsn string, debug bool) error {
 		&model.StatsHourly{},
 		&model.StatsModel{},
 		&model.StatsChannel{},
+		&model.StatsChannelKey{},
 		&model.StatsAPIKey{},
+		&model.StatsAPIKeyModel{},
+		&model.StatsAPIKeyPeriod{},
 		&migrate.MigrationRecord{},
 	); err != nil {
 		return err
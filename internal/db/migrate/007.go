@@ -26,8 +26,11 @@ func migrateGroupRouting(db *gorm.DB) error {
 	if !db.Migrator().HasColumn("groups", "relay_config") {
 		return fmt.Errorf("groups.relay_config not found")
 	}
+	// 迁移 6 会删除旧版 mode 列, 自动迁移先于它建出的新列随之丢失, 需按当前模型重新添加。
 	if !db.Migrator().HasColumn("groups", "mode") {
-		return fmt.Errorf("groups.mode not found")
+		if err := db.Migrator().AddColumn(&model.Group{}, "Mode"); err != nil {
+			return fmt.Errorf("failed to add groups.mode: %w", err)
+		}
 	}
 	if !db.Migrator().HasColumn("groups", "retry_interval") {
 		return nil
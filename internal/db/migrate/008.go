@@ -0,0 +1,35 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterAfterAutoMigration(Migration{
+		Version: 8,
+		Up:      migrateGroupItemWeight,
+	})
+}
+
+// migrateGroupItemWeight 为负载均衡模式恢复 group_items.weight 字段，并将全部成员重置为默认权重 1。
+// 迁移 6 已删除旧版 weight 字段，未执行过迁移 6 的数据库仍保留旧版权重，这些值与负载均衡份额无关，不能沿用。
+func migrateGroupItemWeight(db *gorm.DB) error {
+	if db == nil {
+		return fmt.Errorf("db is nil")
+	}
+	if !db.Migrator().HasTable("group_items") {
+		return nil
+	}
+	if !db.Migrator().HasColumn(&model.GroupItem{}, "weight") {
+		if err := db.Migrator().AddColumn(&model.GroupItem{}, "Weight"); err != nil {
+			return fmt.Errorf("failed to add group_items.weight: %w", err)
+		}
+	}
+	if err := db.Table("group_items").Where("1 = 1").Update("weight", 1).Error; err != nil {
+		return fmt.Errorf("failed to reset group_items.weight: %w", err)
+	}
+	return nil
+}
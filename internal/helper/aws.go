@@ -0,0 +1,159 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+)
+
+// AWSCredentials 是 AWS 渠道一个凭据中的访问密钥。
+type AWSCredentials struct {
+	AccessKeyID     string // 访问密钥 ID。
+	SecretAccessKey string // 访问密钥。
+	SessionToken    string // 临时凭据的会话令牌, 长期凭据为空。
+}
+
+// ParseAWSCredentials 解析 AWS 渠道的凭据, 格式为 AccessKeyID:SecretAccessKey, 临时凭据再追加 :SessionToken。
+func ParseAWSCredentials(key string) (AWSCredentials, error) {
+	parts := strings.SplitN(strings.TrimSpace(key), ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return AWSCredentials{}, fmt.Errorf("aws credentials must be AccessKeyID:SecretAccessKey[:SessionToken]")
+	}
+	credentials := AWSCredentials{AccessKeyID: parts[0], SecretAccessKey: parts[1]}
+	if len(parts) == 3 {
+		credentials.SessionToken = parts[2]
+	}
+	return credentials, nil
+}
+
+// BedrockRuntimeURL 返回 Bedrock 渠道的推理接口地址: 配置了 BaseURL 时以其为准, 便于接入私有终端节点或本地桩服务, 否则按区域拼接官方地址。
+func BedrockRuntimeURL(channel model.Channel) string {
+	if channel.BaseURL != "" {
+		return strings.TrimRight(strings.TrimSuffix(channel.BaseURL, "##"), "/")
+	}
+	return "https://bedrock-runtime." + channel.Region + ".amazonaws.com"
+}
+
+// BedrockAnthropicModel 判断 Bedrock 模型 ID 是否为 Anthropic 模型, 兼容基础模型 ID, 跨区域推理配置 ID 及二者的 ARN。
+// 应用推理配置与预置吞吐量的 ARN 不含模型信息, 无法在本地判断, 一律视为 Anthropic 模型交由上游校验。
+func BedrockAnthropicModel(modelID string) bool {
+	if strings.HasPrefix(modelID, "arn:") {
+		// ARN 格式为 arn:partition:service:region:account:resource, 资源部分中的模型 ID 本身也含冒号。
+		parts := strings.SplitN(modelID, ":", 6)
+		if len(parts) < 6 {
+			return false
+		}
+		kind, id, _ := strings.Cut(parts[5], "/")
+		if kind != "foundation-model" && kind != "inference-profile" {
+			return true
+		}
+		modelID = id
+	}
+	return strings.HasPrefix(modelID, "anthropic.") || strings.Contains(modelID, ".anthropic.")
+}
+
+// SignAWSRequest 按 AWS Signature Version 4 为请求签名, body 为请求的完整正文。
+// 只签名 host, content-type 和 x-amz-* 请求头, 避免代理改写其余请求头后签名失效。
+// refer: https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html
+func SignAWSRequest(req *http.Request, body []byte, credentials AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.Join(values, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(headers[name]), " ") + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.EscapedPath(), false),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+credentials.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// AWSPathEscape 按 AWS 的要求转义路径中的一段, 模型 ID 中的冒号等字符都需转义。
+func AWSPathEscape(segment string) string {
+	return awsURIEncode(segment, true)
+}
+
+// awsCanonicalQuery 返回按参数名排序并按 RFC 3986 转义的规范查询串。
+func awsCanonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode 对除非保留字符外的全部字节做百分号编码; 路径中的斜杠按 encodeSlash 决定是否保留。
+// 规范路径对已转义的路径再编码一次, 与 AWS 对非 S3 服务的要求一致。
+func awsURIEncode(value string, encodeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			builder.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			builder.WriteByte(c)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,126 @@
+package helper
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 以下签名取自 AWS Signature Version 4 官方测试集与 IAM 文档示例, 使用文档中的示例凭据。
+var awsExampleCredentials = AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+func TestSignAWSRequestVectors(t *testing.T) {
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		service     string
+		want        string
+	}{
+		{
+			name:    "get-vanilla",
+			url:     "https://example.amazonaws.com/",
+			service: "service",
+			want:    "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:    "get-vanilla-query-order-key-case",
+			url:     "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			service: "service",
+			want:    "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:        "iam-list-users",
+			url:         "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			contentType: "application/x-www-form-urlencoded; charset=utf-8",
+			service:     "iam",
+			want:        "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		SignAWSRequest(req, nil, awsExampleCredentials, "us-east-1", tt.service, now)
+		if got := req.Header.Get("Authorization"); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+		if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+			t.Errorf("%s: X-Amz-Date = %s", tt.name, got)
+		}
+	}
+}
+
+func TestSignAWSRequestSessionToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	credentials := awsExampleCredentials
+	credentials.SessionToken = "session"
+	SignAWSRequest(req, nil, credentials, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "session" {
+		t.Fatalf("X-Amz-Security-Token = %q, want session", got)
+	}
+	const want = "SignedHeaders=host;x-amz-date;x-amz-security-token,"
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, want) {
+		t.Fatalf("Authorization = %s, want %s", got, want)
+	}
+}
+
+// Bedrock 模型 ID 中的冒号在地址中转义一次, 规范路径中再转义一次。
+func TestAWSCanonicalPathDoubleEncoding(t *testing.T) {
+	target, err := url.Parse("https://bedrock-runtime.us-east-1.amazonaws.com/model/" + AWSPathEscape("anthropic.claude-3-haiku-20240307-v1:0") + "/invoke")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := target.EscapedPath(), "/model/anthropic.claude-3-haiku-20240307-v1%3A0/invoke"; got != want {
+		t.Fatalf("EscapedPath() = %s, want %s", got, want)
+	}
+	if got, want := awsURIEncode(target.EscapedPath(), false), "/model/anthropic.claude-3-haiku-20240307-v1%253A0/invoke"; got != want {
+		t.Fatalf("canonical path = %s, want %s", got, want)
+	}
+}
+
+func TestAWSCanonicalQuery(t *testing.T) {
+	query := url.Values{"b": {"2", "1"}, "a": {"x y"}, "c": {"~/:"}}
+	if got, want := awsCanonicalQuery(query), "a=x%20y&b=1&b=2&c=~%2F%3A"; got != want {
+		t.Fatalf("awsCanonicalQuery() = %s, want %s", got, want)
+	}
+}
+
+func TestBedrockAnthropicModel(t *testing.T) {
+	tests := []struct {
+		modelID string
+		want    bool
+	}{
+		{"anthropic.claude-3-5-sonnet-20241022-v2:0", true},
+		{"us.anthropic.claude-3-7-sonnet-20250219-v1:0", true},
+		{"global.anthropic.claude-sonnet-4-20250514-v1:0", true},
+		{"arn:aws:bedrock:us-east-1::foundation-model/anthropic.claude-3-haiku-20240307-v1:0", true},
+		{"arn:aws:bedrock:us-east-1:123456789012:inference-profile/us.anthropic.claude-3-haiku-20240307-v1:0", true},
+		{"arn:aws:bedrock:us-east-1:123456789012:application-inference-profile/a1b2c3", true},
+		{"meta.llama3-70b-instruct-v1:0", false},
+		{"us.amazon.nova-pro-v1:0", false},
+		{"arn:aws:bedrock:us-east-1::foundation-model/mistral.mistral-large-2402-v1:0", false},
+	}
+	for _, tt := range tests {
+		if got := BedrockAnthropicModel(tt.modelID); got != tt.want {
+			t.Errorf("BedrockAnthropicModel(%q) = %v, want %v", tt.modelID, got, tt.want)
+		}
+	}
+}
+
+func TestParseAWSCredentials(t *testing.T) {
+	credentials, err := ParseAWSCredentials(" AKID:secret:token ")
+	if err != nil || credentials != (AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"}) {
+		t.Fatalf("ParseAWSCredentials() = %+v, %v", credentials, err)
+	}
+	if _, err := ParseAWSCredentials("AKID"); err == nil {
+		t.Fatal("ParseAWSCredentials() without secret succeeded")
+	}
+}
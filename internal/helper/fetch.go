@@ -3,8 +3,13 @@ package helper
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/bestruirui/octopus/internal/model"
 	"github.com/dlclark/regexp2"
@@ -22,6 +27,17 @@ func FetchModels(ctx context.Context, request model.Channel) ([]string, error) {
 		fetchModel, err = fetchAnthropicModels(client, ctx, request)
 	case model.ChannelProviderGemini:
 		fetchModel, err = fetchGeminiModels(client, ctx, request)
+	case model.ChannelProviderAzure:
+		fetchModel, err = fetchAzureModels(client, ctx, request)
+	case model.ChannelProviderBedrock:
+		fetchModel, err = fetchBedrockModels(client, ctx, request)
+	case model.ChannelProviderVertex:
+		fetchModel, err = fetchVertexModels(client, ctx, request)
+	case model.ChannelProviderOllama:
+		fetchModel, err = fetchOllamaModels(client, ctx, request)
+	case model.ChannelProviderMock:
+		// 模拟渠道接受任意模型名称, 这里只给出一个便于试用的示例模型。
+		fetchModel = []string{"mock-model"}
 	default:
 		fetchModel, err = fetchOpenAIModels(client, ctx, request)
 	}
@@ -54,13 +70,17 @@ func fetchOpenAIModels(client *http.Client, ctx context.Context, request model.C
 	if request.Type == model.ChannelProviderVolcengine {
 		baseURL = transformer.NormalizeBaseURL(request.BaseURL, "v3")
 	}
+	modelsURL := baseURL + "/models"
+	if request.Type == model.ChannelProviderCompatible {
+		modelsURL = strings.TrimRight(strings.TrimSuffix(request.BaseURL, "##"), "/") + request.Compatible.ModelsPath()
+	}
 	req, _ := http.NewRequestWithContext(
 		ctx,
 		http.MethodGet,
-		baseURL+"/models",
+		modelsURL,
 		nil,
 	)
-	req.Header.Set("Authorization", "Bearer "+request.Key)
+	setCompatibleAuth(req, request)
 	applyCustomHeaders(req, request)
 
 	resp, err := client.Do(req)
@@ -135,6 +155,203 @@ func fetchGeminiModels(client *http.Client, ctx context.Context, request model.C
 	return allModels, nil
 }
 
+// refer: https://learn.microsoft.com/azure/ai-services/openai/reference
+// Azure 按部署调用模型: 配置了部署映射时以映射的模型名称为准, 否则列出资源上可用的模型。
+func fetchAzureModels(client *http.Client, ctx context.Context, request model.Channel) ([]string, error) {
+	if len(request.Deployments) > 0 {
+		models := make([]string, 0, len(request.Deployments))
+		for name := range request.Deployments {
+			models = append(models, name)
+		}
+		slices.Sort(models)
+		return models, nil
+	}
+
+	req, _ := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		strings.TrimRight(strings.TrimSuffix(request.BaseURL, "##"), "/")+"/openai/models?api-version="+url.QueryEscape(request.AzureAPIVersion()),
+		nil,
+	)
+	req.Header.Set("Api-Key", request.Key)
+	applyCustomHeaders(req, request)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result model.OpenAIModelList
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(result.Data))
+	for _, m := range result.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// refer: https://docs.aws.amazon.com/bedrock/latest/APIReference/API_ListFoundationModels.html
+// 模型列表属于 Bedrock 控制面接口, 与推理接口的域名和签名服务名不同; 配置了 BaseURL 时同样以其为准。
+// Bedrock 渠道只按 Anthropic Messages 协议转发, 故只列出 Anthropic 的模型。
+func fetchBedrockModels(client *http.Client, ctx context.Context, request model.Channel) ([]string, error) {
+	credentials, err := ParseAWSCredentials(request.Key)
+	if err != nil {
+		return nil, err
+	}
+	baseURL := "https://bedrock." + request.Region + ".amazonaws.com"
+	if request.BaseURL != "" {
+		baseURL = BedrockRuntimeURL(request)
+	}
+	req, _ := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		baseURL+"/foundation-models?byOutputModality=TEXT&byProvider=Anthropic",
+		nil,
+	)
+	applyCustomHeaders(req, request)
+	SignAWSRequest(req, nil, credentials, request.Region, "bedrock", time.Now())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list bedrock models: %s: %s", resp.Status, body)
+	}
+
+	var result model.BedrockModelList
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(result.ModelSummaries))
+	for _, m := range result.ModelSummaries {
+		if BedrockAnthropicModel(m.ModelID) {
+			models = append(models, m.ModelID)
+		}
+	}
+	return models, nil
+}
+
+// refer: https://cloud.google.com/vertex-ai/docs/reference/rest/v1beta1/publishers.models/list
+// 列出 Google 与 Anthropic 两个发布方在 Vertex 上提供的模型。
+func fetchVertexModels(client *http.Client, ctx context.Context, request model.Channel) ([]string, error) {
+	credentials, err := ParseVertexCredentials(request.Key)
+	if err != nil {
+		return nil, err
+	}
+	token, err := VertexAccessToken(ctx, client, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	var allModels []string
+	for _, publisher := range []string{"google", "anthropic"} {
+		pageToken := ""
+		for {
+			result, err := fetchVertexModelPage(client, ctx, request, credentials, token, publisher, pageToken)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, m := range result.PublisherModels {
+				allModels = append(allModels, m.Name[strings.LastIndex(m.Name, "/")+1:])
+			}
+
+			if result.NextPageToken == "" {
+				break
+			}
+			pageToken = result.NextPageToken
+		}
+	}
+	return allModels, nil
+}
+
+// fetchVertexModelPage 请求发布方模型列表的一页, 每页的响应正文在返回前关闭。
+func fetchVertexModelPage(client *http.Client, ctx context.Context, request model.Channel, credentials VertexCredentials, token, publisher, pageToken string) (model.VertexModelList, error) {
+	req, _ := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		VertexEndpoint(request)+"/v1beta1/publishers/"+publisher+"/models",
+		nil,
+	)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Goog-User-Project", VertexProject(request, credentials))
+	applyCustomHeaders(req, request)
+	if pageToken != "" {
+		q := req.URL.Query()
+		q.Add("pageToken", pageToken)
+		req.URL.RawQuery = q.Encode()
+	}
+
+	var result model.VertexModelList
+	resp, err := client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return result, fmt.Errorf("list vertex models: %s: %s", resp.Status, body)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// refer: https://docs.ollama.com/api/tags
+// 本地 Ollama 不需要凭据; 配置了凭据时按 Bearer 发送, 以兼容加了认证的反向代理。
+func fetchOllamaModels(client *http.Client, ctx context.Context, request model.Channel) ([]string, error) {
+	req, _ := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		OllamaBaseURL(request)+"/api/tags",
+		nil,
+	)
+	if request.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+request.Key)
+	}
+	applyCustomHeaders(req, request)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result model.OllamaModelList
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(result.Models))
+	for _, m := range result.Models {
+		models = append(models, m.Name)
+	}
+	return models, nil
+}
+
+// OllamaBaseURL 返回 Ollama 渠道不含路径的服务地址, 未配置时使用本机默认端口。
+func OllamaBaseURL(channel model.Channel) string {
+	base := strings.TrimRight(strings.TrimSuffix(channel.BaseURL, "##"), "/")
+	if base == "" {
+		return "http://localhost:11434"
+	}
+	// 与 OpenAI 兼容接口共用一个 BaseURL 时, 用户可能填写了 /v1 后缀。
+	return strings.TrimSuffix(base, "/v1")
+}
+
 // refer: https://platform.claude.com/docs
 func fetchAnthropicModels(client *http.Client, ctx context.Context, request model.Channel) ([]string, error) {
 
@@ -188,6 +405,33 @@ func fetchAnthropicModels(client *http.Client, ctx context.Context, request mode
 	return allModels, nil
 }
 
+// setCompatibleAuth 按渠道的认证方式为模型列表请求设置凭据, 非 OpenAI 兼容渠道一律使用 Bearer 认证。
+func setCompatibleAuth(req *http.Request, channel model.Channel) {
+	if channel.Type != model.ChannelProviderCompatible {
+		req.Header.Set("Authorization", "Bearer "+channel.Key)
+		return
+	}
+	switch channel.Compatible.AuthScheme {
+	case model.CompatibleAuthHeader:
+		header := channel.Compatible.AuthHeader
+		if header == "" {
+			header = "Authorization"
+		}
+		req.Header.Set(header, channel.Key)
+	case model.CompatibleAuthQuery:
+		name := channel.Compatible.AuthHeader
+		if name == "" {
+			name = "key"
+		}
+		q := req.URL.Query()
+		q.Set(name, channel.Key)
+		req.URL.RawQuery = q.Encode()
+	case model.CompatibleAuthNone:
+	default:
+		req.Header.Set("Authorization", "Bearer "+channel.Key)
+	}
+}
+
 func applyCustomHeaders(req *http.Request, channel model.Channel) {
 	for _, header := range channel.CustomHeader {
 		if header.HeaderKey != "" {
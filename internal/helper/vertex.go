@@ -0,0 +1,142 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/utils/cache"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	vertexTokenURI    = "https://oauth2.googleapis.com/token"            // 服务账号未声明 token_uri 时使用的 Google OAuth 令牌接口。
+	vertexTokenScope  = "https://www.googleapis.com/auth/cloud-platform" // 调用 Vertex AI 所需的授权范围。
+	vertexTokenMargin = 5 * time.Minute                                  // 缓存的令牌在到期前多久视为失效, 避免请求途中过期。
+)
+
+// VertexCredentials 是 Vertex 渠道凭据中的 Google 服务账号密钥, 即控制台下载的 JSON 文件内容。
+type VertexCredentials struct {
+	ProjectID    string `json:"project_id"`     // 服务账号所属项目, 渠道未指定项目时使用。
+	PrivateKeyID string `json:"private_key_id"` // 私钥 ID, 写入断言的 kid。
+	PrivateKey   string `json:"private_key"`    // PEM 格式的 RSA 私钥。
+	ClientEmail  string `json:"client_email"`   // 服务账号邮箱, 作为断言的签发者。
+	TokenURI     string `json:"token_uri"`      // 换取访问令牌的接口地址, 可改为本地模拟服务。
+}
+
+// vertexToken 是缓存的访问令牌。
+type vertexToken struct {
+	value   string    // 访问令牌。
+	expires time.Time // 令牌到期时间。
+}
+
+var vertexTokenCache = cache.New[string, vertexToken](16) // 按服务账号和令牌接口缓存的访问令牌。
+
+// ParseVertexCredentials 解析 Vertex 渠道凭据中的服务账号 JSON。
+func ParseVertexCredentials(key string) (VertexCredentials, error) {
+	var credentials VertexCredentials
+	if err := json.Unmarshal([]byte(key), &credentials); err != nil {
+		return VertexCredentials{}, fmt.Errorf("vertex credentials must be a service account json: %w", err)
+	}
+	if credentials.ClientEmail == "" || credentials.PrivateKey == "" {
+		return VertexCredentials{}, fmt.Errorf("vertex service account json requires client_email and private_key")
+	}
+	if credentials.TokenURI == "" {
+		credentials.TokenURI = vertexTokenURI
+	}
+	return credentials, nil
+}
+
+// VertexProject 返回 Vertex 渠道使用的项目, 渠道未配置时取服务账号所属项目。
+func VertexProject(channel model.Channel, credentials VertexCredentials) string {
+	if channel.ProjectID != "" {
+		return channel.ProjectID
+	}
+	return credentials.ProjectID
+}
+
+// VertexEndpoint 返回 Vertex 渠道的接口地址: 配置了 BaseURL 时以其为准, 否则按区域拼接官方地址, global 区域使用全局地址。
+func VertexEndpoint(channel model.Channel) string {
+	if channel.BaseURL != "" {
+		return strings.TrimRight(strings.TrimSuffix(channel.BaseURL, "##"), "/")
+	}
+	if channel.Region == "" || channel.Region == "global" {
+		return "https://aiplatform.googleapis.com"
+	}
+	return "https://" + channel.Region + "-aiplatform.googleapis.com"
+}
+
+// VertexLocation 返回 Vertex 渠道请求路径中的区域, 未配置时使用 global。
+func VertexLocation(channel model.Channel) string {
+	if channel.Region == "" {
+		return "global"
+	}
+	return channel.Region
+}
+
+// VertexAccessToken 返回服务账号的 OAuth 访问令牌: 缓存中的令牌临近到期前直接复用, 否则以服务账号私钥签名的 JWT 断言向令牌接口换取。
+// refer: https://developers.google.com/identity/protocols/oauth2/service-account#authorizingrequests
+func VertexAccessToken(ctx context.Context, client *http.Client, credentials VertexCredentials) (string, error) {
+	cacheKey := credentials.ClientEmail + "|" + credentials.TokenURI
+	if token, ok := vertexTokenCache.Get(cacheKey); ok && time.Now().Add(vertexTokenMargin).Before(token.expires) {
+		return token.value, nil
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(credentials.PrivateKey))
+	if err != nil {
+		return "", fmt.Errorf("parse vertex private key: %w", err)
+	}
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   credentials.ClientEmail,
+		"scope": vertexTokenScope,
+		"aud":   credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if credentials.PrivateKeyID != "" {
+		assertion.Header["kid"] = credentials.PrivateKeyID
+	}
+	signed, err := assertion.SignedString(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {signed}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, credentials.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vertex token request failed: %s: %s", resp.Status, body)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"` // 访问令牌。
+		ExpiresIn   int64  `json:"expires_in"`   // 令牌有效秒数。
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("vertex token response has no access_token: %s", body)
+	}
+	vertexTokenCache.Set(cacheKey, vertexToken{value: result.AccessToken, expires: now.Add(time.Duration(result.ExpiresIn) * time.Second)})
+	return result.AccessToken, nil
+}
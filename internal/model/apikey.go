@@ -1,11 +1,56 @@
 package model
 
+import "time"
+
+// API Key 预算的重置周期。
+type BudgetPeriod string
+
+const (
+	BudgetPeriodDaily   BudgetPeriod = "daily"   // 每天零点重置。
+	BudgetPeriodWeekly  BudgetPeriod = "weekly"  // 每周一零点重置。
+	BudgetPeriodMonthly BudgetPeriod = "monthly" // 每月一日零点重置。
+)
+
 type APIKey struct {
-	ID              int     `json:"id" gorm:"primaryKey"`
-	Name            string  `json:"name" gorm:"not null"`
-	APIKey          string  `json:"api_key" gorm:"not null"`
-	Enabled         bool    `json:"enabled" gorm:"default:true"`
-	ExpireAt        int64   `json:"expire_at,omitempty"`
-	MaxCost         float64 `json:"max_cost,omitempty"`
-	SupportedModels string  `json:"supported_models,omitempty"`
+	ID              int                   `json:"id" gorm:"primaryKey"`
+	Name            string                `json:"name" gorm:"not null"`
+	APIKey          string                `json:"api_key" gorm:"not null"`
+	Enabled         bool                  `json:"enabled" gorm:"default:true"`
+	ExpireAt        int64                 `json:"expire_at,omitempty"`
+	MaxCost         float64               `json:"max_cost,omitempty"`
+	SupportedModels string                `json:"supported_models,omitempty"`
+	MaxRPM          int                   `json:"max_rpm,omitempty" binding:"omitempty,min=0"`                            // 每分钟最多放行的请求数, 0 表示不限制。
+	MaxTPM          int64                 `json:"max_tpm,omitempty" binding:"omitempty,min=0"`                            // 每分钟最多消耗的 Token 数, 按请求结束时的实际用量计入, 0 表示不限制。
+	MaxConcurrency  int                   `json:"max_concurrency,omitempty" binding:"omitempty,min=0"`                    // 同时处理中的请求数上限, 0 表示不限制。
+	BudgetPeriod    BudgetPeriod          `json:"budget_period,omitempty" binding:"omitempty,oneof=daily weekly monthly"` // 周期预算的重置周期, 为空表示不启用周期预算。
+	BudgetCost      float64               `json:"budget_cost,omitempty" binding:"omitempty,min=0"`                        // 每个周期内允许的费用, 周期开始时自动恢复。
+	GroupQuotas     map[string]GroupQuota `json:"group_quotas,omitempty" gorm:"serializer:json" binding:"omitempty,dive"` // 按分组名称配置的累计配额, 未配置的分组不限制。
+}
+
+// GroupQuota 是 API Key 在一个分组上的累计配额, 按该 API Key 请求此分组的全部用量计算, 任一项用尽即拒绝后续请求。
+type GroupQuota struct {
+	MaxCost   float64 `json:"max_cost,omitempty" binding:"omitempty,min=0"`   // 累计费用上限, 0 表示不限制。
+	MaxTokens int64   `json:"max_tokens,omitempty" binding:"omitempty,min=0"` // 累计输入与输出 Token 数上限, 0 表示不限制。
+}
+
+// RateLimited 判断 API Key 是否配置了任一限流项。
+func (k *APIKey) RateLimited() bool {
+	return k.MaxRPM > 0 || k.MaxTPM > 0 || k.MaxConcurrency > 0
+}
+
+// BudgetWindow 返回 now 所在预算周期的开始与结束时间, 按服务器本地时区划分; 未启用周期预算时返回零值。
+func (k *APIKey) BudgetWindow(now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch k.BudgetPeriod {
+	case BudgetPeriodDaily:
+		return today, today.AddDate(0, 0, 1)
+	case BudgetPeriodWeekly:
+		start := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+		return start, start.AddDate(0, 0, 7)
+	case BudgetPeriodMonthly:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	default:
+		return time.Time{}, time.Time{}
+	}
 }
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPIKeyBudgetWindow(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	tests := []struct {
+		name      string
+		period    BudgetPeriod
+		now       time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"daily", BudgetPeriodDaily, time.Date(2026, 3, 18, 14, 30, 0, 0, time.UTC),
+			time.Date(2026, 3, 18, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"daily at midnight", BudgetPeriodDaily, time.Date(2026, 3, 19, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, 3, 19, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"daily year end", BudgetPeriodDaily, time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC),
+			time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly midweek", BudgetPeriodWeekly, time.Date(2026, 3, 18, 9, 0, 0, 0, time.UTC),
+			time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 23, 0, 0, 0, 0, time.UTC)},
+		{"weekly sunday", BudgetPeriodWeekly, time.Date(2026, 3, 22, 23, 59, 0, 0, time.UTC),
+			time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 23, 0, 0, 0, 0, time.UTC)},
+		{"weekly monday", BudgetPeriodWeekly, time.Date(2026, 3, 23, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, 3, 23, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC)},
+		{"weekly across months", BudgetPeriodWeekly, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+			time.Date(2026, 2, 23, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"monthly 31st", BudgetPeriodMonthly, time.Date(2026, 1, 31, 18, 0, 0, 0, time.UTC),
+			time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly leap day", BudgetPeriodMonthly, time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC),
+			time.Date(2028, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly december", BudgetPeriodMonthly, time.Date(2026, 12, 15, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// 本地已进入四月而 UTC 仍在三月, 周期按服务器本地时区划分。
+		{"monthly local time zone", BudgetPeriodMonthly, time.Date(2026, 4, 1, 0, 30, 0, 0, shanghai),
+			time.Date(2026, 4, 1, 0, 0, 0, 0, shanghai), time.Date(2026, 5, 1, 0, 0, 0, 0, shanghai)},
+		// 夏令时开始当天只有 23 小时。
+		{"daily daylight saving", BudgetPeriodDaily, time.Date(2026, 3, 8, 12, 0, 0, 0, newYork),
+			time.Date(2026, 3, 8, 0, 0, 0, 0, newYork), time.Date(2026, 3, 9, 0, 0, 0, 0, newYork)},
+		{"disabled", "", time.Date(2026, 3, 18, 14, 30, 0, 0, time.UTC), time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		apiKey := APIKey{BudgetPeriod: tt.period}
+		start, end := apiKey.BudgetWindow(tt.now)
+		if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+			t.Errorf("%s: BudgetWindow(%s) = %s, %s, want %s, %s", tt.name, tt.now, start, end, tt.wantStart, tt.wantEnd)
+		}
+	}
+
+	apiKey := APIKey{BudgetPeriod: BudgetPeriodDaily}
+	if start, end := apiKey.BudgetWindow(time.Date(2026, 3, 8, 12, 0, 0, 0, newYork)); end.Sub(start) != 23*time.Hour {
+		t.Errorf("daylight saving day lasts %s, want 23h", end.Sub(start))
+	}
+}
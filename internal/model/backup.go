@@ -9,19 +9,23 @@ type DBDump struct {
 	ExportedAt   time.Time `json:"exported_at"`
 	IncludeStats bool      `json:"include_stats"`
 
-	Channels   []Channel   `json:"channels,omitempty"`
-	Groups     []Group     `json:"groups,omitempty"`
-	GroupItems []GroupItem `json:"group_items,omitempty"`
-	LLMInfos   []LLMInfo   `json:"llm_infos,omitempty"`
-	APIKeys    []APIKey    `json:"api_keys,omitempty"`
-	Settings   []Setting   `json:"settings,omitempty"`
+	Channels    []Channel    `json:"channels,omitempty"`
+	ChannelKeys []ChannelKey `json:"channel_keys,omitempty"`
+	Groups      []Group      `json:"groups,omitempty"`
+	GroupItems  []GroupItem  `json:"group_items,omitempty"`
+	LLMInfos    []LLMInfo    `json:"llm_infos,omitempty"`
+	APIKeys     []APIKey     `json:"api_keys,omitempty"`
+	Settings    []Setting    `json:"settings,omitempty"`
 
-	StatsTotal   []StatsTotal   `json:"stats_total,omitempty"`
-	StatsDaily   []StatsDaily   `json:"stats_daily,omitempty"`
-	StatsHourly  []StatsHourly  `json:"stats_hourly,omitempty"`
-	StatsModel   []StatsModel   `json:"stats_model,omitempty"`
-	StatsChannel []StatsChannel `json:"stats_channel,omitempty"`
-	StatsAPIKey  []StatsAPIKey  `json:"stats_api_key,omitempty"`
+	StatsTotal        []StatsTotal        `json:"stats_total,omitempty"`
+	StatsDaily        []StatsDaily        `json:"stats_daily,omitempty"`
+	StatsHourly       []StatsHourly       `json:"stats_hourly,omitempty"`
+	StatsModel        []StatsModel        `json:"stats_model,omitempty"`
+	StatsChannel      []StatsChannel      `json:"stats_channel,omitempty"`
+	StatsChannelKey   []StatsChannelKey   `json:"stats_channel_key,omitempty"`
+	StatsAPIKey       []StatsAPIKey       `json:"stats_api_key,omitempty"`
+	StatsAPIKeyModel  []StatsAPIKeyModel  `json:"stats_api_key_model,omitempty"`
+	StatsAPIKeyPeriod []StatsAPIKeyPeriod `json:"stats_api_key_period,omitempty"`
 }
 
 type DBImportResult struct {
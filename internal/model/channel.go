@@ -1,5 +1,7 @@
 package model
 
+import "strings"
+
 // 渠道使用的上游服务提供方。
 type ChannelProvider string
 
@@ -9,25 +11,149 @@ const (
 	ChannelProviderAnthropic       ChannelProvider = "anthropic"
 	ChannelProviderGemini          ChannelProvider = "gemini"
 	ChannelProviderVolcengine      ChannelProvider = "volcengine"
+	ChannelProviderAzure           ChannelProvider = "azure"
+	ChannelProviderBedrock         ChannelProvider = "bedrock"
+	ChannelProviderVertex          ChannelProvider = "vertex"
+	ChannelProviderCompatible      ChannelProvider = "openai_compatible"
+	ChannelProviderOllama          ChannelProvider = "ollama"
+	ChannelProviderMock            ChannelProvider = "mock"
+)
+
+// 渠道在多个密钥之间选择本轮密钥的策略。
+type ChannelKeyStrategy string
+
+const (
+	ChannelKeyStrategyRoundRobin ChannelKeyStrategy = "round_robin" // 按顺序轮流使用未冷却的密钥。
+	ChannelKeyStrategyLeastUsed  ChannelKeyStrategy = "least_used"  // 优先使用累计请求次数最少的未冷却密钥。
 )
 
 // 单个上游渠道的连接和转发配置。
 type Channel struct {
-	ID            int             `json:"id" gorm:"primaryKey"`                        // 渠道主键。
-	Name          string          `json:"name" gorm:"unique;not null"`                 // 渠道名称。
-	Type          ChannelProvider `json:"type"`                                        // 上游服务提供方。
-	Enabled       bool            `json:"enabled" gorm:"default:true"`                 // 渠道是否可用。
-	BaseURL       string          `json:"base_url"`                                    // 唯一的上游基础地址。
-	Key           string          `json:"key"`                                         // 唯一的上游访问凭据。
-	Model         string          `json:"model"`                                       // 自动同步的模型列表。
-	CustomModel   string          `json:"custom_model"`                                // 手动配置的模型列表。
-	Proxy         bool            `json:"proxy" gorm:"default:false"`                  // 是否使用代理。
-	AutoSync      bool            `json:"auto_sync" gorm:"default:false"`              // 是否自动同步模型。
-	CustomHeader  []CustomHeader  `json:"custom_header" gorm:"serializer:json"`        // 追加到上游请求的 Header。
-	ParamOverride *string         `json:"param_override"`                              // 请求参数覆盖配置。
-	ChannelProxy  *string         `json:"channel_proxy"`                               // 渠道专用代理地址。
-	Stats         *StatsChannel   `json:"stats,omitempty" gorm:"foreignKey:ChannelID"` // 渠道统计信息。
-	MatchRegex    *string         `json:"match_regex"`                                 // 模型同步过滤表达式。
+	ID              int                `json:"id" gorm:"primaryKey"`                                                                              // 渠道主键。
+	Name            string             `json:"name" gorm:"unique;not null"`                                                                       // 渠道名称。
+	Type            ChannelProvider    `json:"type"`                                                                                              // 上游服务提供方。
+	Enabled         bool               `json:"enabled" gorm:"default:true"`                                                                       // 渠道是否可用。
+	BaseURL         string             `json:"base_url"`                                                                                          // 唯一的上游基础地址。
+	Key             string             `json:"key"`                                                                                               // 主上游访问凭据。
+	Keys            []ChannelKey       `json:"keys,omitempty" gorm:"foreignKey:ChannelID"`                                                        // 与主凭据一起轮换使用的附加凭据。
+	KeyStrategy     ChannelKeyStrategy `json:"key_strategy" gorm:"not null;default:round_robin" binding:"omitempty,oneof=round_robin least_used"` // 多个凭据之间的选择策略。
+	Model           string             `json:"model"`                                                                                             // 自动同步的模型列表。
+	CustomModel     string             `json:"custom_model"`                                                                                      // 手动配置的模型列表。
+	Proxy           bool               `json:"proxy" gorm:"default:false"`                                                                        // 是否使用代理。
+	AutoSync        bool               `json:"auto_sync" gorm:"default:false"`                                                                    // 是否自动同步模型。
+	CustomHeader    []CustomHeader     `json:"custom_header" gorm:"serializer:json"`                                                              // 追加到上游请求的 Header。
+	ParamOverride   *string            `json:"param_override"`                                                                                    // 请求参数覆盖配置。
+	ChannelProxy    *string            `json:"channel_proxy"`                                                                                     // 渠道专用代理地址。
+	Stats           *StatsChannel      `json:"stats,omitempty" gorm:"foreignKey:ChannelID"`                                                       // 渠道统计信息。
+	KeyStats        []StatsChannelKey  `json:"key_stats,omitempty" gorm:"-"`                                                                      // 各凭据的统计信息。
+	MatchRegex      *string            `json:"match_regex"`                                                                                       // 模型同步过滤表达式。
+	PriceMultiplier float64            `json:"price_multiplier" gorm:"default:1"`                                                                 // 渠道实际价格相对价格表的倍率，用于费用路由和费用统计。
+	APIVersion      string             `json:"api_version"`                                                                                       // Azure 渠道请求使用的 api-version, 为空时使用默认版本。
+	Deployments     map[string]string  `json:"deployments" gorm:"serializer:json"`                                                                // Azure 渠道从模型名称到部署名称的映射, 未映射的模型以模型名称作为部署名称。
+	Region          string             `json:"region"`                                                                                            // Bedrock 渠道的 AWS 区域或 Vertex 渠道的 Google Cloud 区域; Bedrock 凭据格式为 AccessKeyID:SecretAccessKey。
+	ProjectID       string             `json:"project_id"`                                                                                        // Vertex 渠道的 Google Cloud 项目, 为空时取服务账号所属项目; Vertex 凭据为服务账号 JSON。
+	Compatible      CompatibleConfig   `json:"compatible" gorm:"serializer:json"`                                                                 // OpenAI 兼容渠道的认证方式和接口路径配置。
+	OllamaNative    bool               `json:"ollama_native" gorm:"default:false"`                                                                // Ollama 渠道的对话是否使用原生 /api/chat 接口, 否则使用其 OpenAI 兼容接口。
+	Mock            MockConfig         `json:"mock" gorm:"serializer:json"`                                                                       // 模拟渠道的应答配置。
+	MaxConcurrency  int                `json:"max_concurrency" binding:"omitempty,min=0"`                                                         // 同时进行的上游请求数上限, 0 表示不限制。
+	MaxRPM          int                `json:"max_rpm" binding:"omitempty,min=0"`                                                                 // 每分钟发出的上游请求数上限, 0 表示不限制。
+}
+
+// CostMultiplier 返回渠道生效的价格倍率，未配置或非正数时按价格表原价计算。
+func (c *Channel) CostMultiplier() float64 {
+	if c.PriceMultiplier <= 0 {
+		return 1
+	}
+	return c.PriceMultiplier
+}
+
+// AzureAPIVersion 返回 Azure 渠道生效的 api-version，未配置时使用默认的正式版本。
+func (c *Channel) AzureAPIVersion() string {
+	if c.APIVersion == "" {
+		return "2024-10-21"
+	}
+	return c.APIVersion
+}
+
+// OpenAI 兼容渠道的认证方式。
+type CompatibleAuthScheme string
+
+const (
+	CompatibleAuthBearer CompatibleAuthScheme = "bearer" // Authorization: Bearer 凭据, 未配置时的默认方式。
+	CompatibleAuthHeader CompatibleAuthScheme = "header" // 凭据原样放在 AuthHeader 指定的请求头中。
+	CompatibleAuthQuery  CompatibleAuthScheme = "query"  // 凭据放在 AuthHeader 指定名称的查询参数中。
+	CompatibleAuthNone   CompatibleAuthScheme = "none"   // 不发送凭据。
+)
+
+// 接口与 OpenAI 基本一致, 但认证方式或路径不同的上游的接口配置。
+// 路径模板相对于 BaseURL, 可以包含 {model} 占位符, 请求时替换为本轮上游模型。
+type CompatibleConfig struct {
+	AuthScheme    CompatibleAuthScheme `json:"auth_scheme" binding:"omitempty,oneof=bearer header query none"` // 认证方式。
+	AuthHeader    string               `json:"auth_header"`                                                    // header 方式的请求头名称或 query 方式的参数名称。
+	PathPrefix    string               `json:"path_prefix"`                                                    // 未单独配置模板的接口共用的路径前缀, 为空时为 /v1。
+	Paths         map[string]string    `json:"paths"`                                                          // 按 OpenAI 接口路径配置的路径模板, 如 chat/completions, embeddings。
+	ModelListPath string               `json:"model_list_path"`                                                // 模型列表的路径, 为空时为前缀加 /models。
+}
+
+// Path 返回 OpenAI 接口 endpoint 在上游的路径, endpoint 为不带前导斜杠的 OpenAI 路径, 如 chat/completions。
+func (c *CompatibleConfig) Path(endpoint, modelName string) string {
+	path, ok := c.Paths[endpoint]
+	if !ok {
+		path = c.prefix() + "/" + endpoint
+	}
+	return strings.ReplaceAll(path, "{model}", modelName)
+}
+
+// ModelsPath 返回模型列表在上游的路径。
+func (c *CompatibleConfig) ModelsPath() string {
+	if c.ModelListPath != "" {
+		return c.ModelListPath
+	}
+	return c.prefix() + "/models"
+}
+
+func (c *CompatibleConfig) prefix() string {
+	if c.PathPrefix == "" {
+		return "/v1"
+	}
+	return "/" + strings.Trim(c.PathPrefix, "/")
+}
+
+// 模拟渠道的应答方式。
+type MockMode string
+
+const (
+	MockModeEcho  MockMode = "echo"  // 原样返回最后一条用户消息的文本, 未配置时的默认方式。
+	MockModeFixed MockMode = "fixed" // 总是返回 Text。
+)
+
+// 模拟渠道在进程内应答请求的配置, 不访问网络, 用于测试分组的故障转移, 冷却和亲和行为, 以及无凭据试用。
+type MockConfig struct {
+	Mode                        MockMode `json:"mode" binding:"omitempty,oneof=echo fixed"`                // 应答方式。
+	Text                        string   `json:"text"`                                                     // fixed 方式返回的文本。
+	LatencyMilliseconds         int      `json:"latency_milliseconds" binding:"omitempty,min=0"`           // 返回响应头前的等待毫秒数。
+	FirstTokenDelayMilliseconds int      `json:"first_token_delay_milliseconds" binding:"omitempty,min=0"` // 流式响应在首个事件前额外等待的毫秒数。
+	FailureRate                 float64  `json:"failure_rate" binding:"omitempty,min=0,max=1"`             // 请求失败的概率。
+	FailureStatus               int      `json:"failure_status" binding:"omitempty,min=400,max=599"`       // 失败时的状态码, 未配置时为 500; 配置了状态码但失败概率为 0 时每个请求都失败。
+}
+
+// 渠道的一个附加上游访问凭据。
+type ChannelKey struct {
+	ID        int    `json:"id" gorm:"primaryKey"`             // 凭据主键, 同时作为凭据统计的标识。
+	ChannelID int    `json:"channel_id" gorm:"index;not null"` // 所属渠道 ID。
+	Key       string `json:"key" gorm:"not null"`              // 上游访问凭据。
+	Remark    string `json:"remark"`                           // 凭据备注。
+}
+
+// TableName 避开迁移 5 按旧结构读取并删除的 channel_keys 表。
+func (ChannelKey) TableName() string {
+	return "channel_extra_keys"
+}
+
+// 新增渠道附加凭据请求。
+type ChannelKeyAddRequest struct {
+	Key    string `json:"key" binding:"required"` // 上游访问凭据。
+	Remark string `json:"remark,omitempty"`       // 凭据备注。
 }
 
 // 追加到上游请求的单个 Header。
@@ -38,18 +164,31 @@ type CustomHeader struct {
 
 // ChannelUpdateRequest 渠道更新请求 - 仅包含变更的数据
 type ChannelUpdateRequest struct {
-	ID            int              `json:"id" binding:"required"`    // 待更新渠道的主键。
-	Name          *string          `json:"name,omitempty"`           // 新的渠道名称。
-	Type          *ChannelProvider `json:"type,omitempty"`           // 新的上游服务提供方。
-	Enabled       *bool            `json:"enabled,omitempty"`        // 新的启用状态。
-	BaseURL       *string          `json:"base_url,omitempty"`       // 新的上游基础地址。
-	Key           *string          `json:"key,omitempty"`            // 新的上游访问凭据。
-	Model         *string          `json:"model,omitempty"`          // 新的自动同步模型列表。
-	CustomModel   *string          `json:"custom_model,omitempty"`   // 新的自定义模型列表。
-	Proxy         *bool            `json:"proxy,omitempty"`          // 新的代理开关。
-	AutoSync      *bool            `json:"auto_sync,omitempty"`      // 新的自动同步开关。
-	CustomHeader  *[]CustomHeader  `json:"custom_header,omitempty"`  // 新的自定义 Header。
-	ChannelProxy  *string          `json:"channel_proxy,omitempty"`  // 新的渠道代理地址。
-	ParamOverride *string          `json:"param_override,omitempty"` // 新的参数覆盖配置。
-	MatchRegex    *string          `json:"match_regex,omitempty"`    // 新的模型过滤表达式。
+	ID              int                    `json:"id" binding:"required"`                                                   // 待更新渠道的主键。
+	Name            *string                `json:"name,omitempty"`                                                          // 新的渠道名称。
+	Type            *ChannelProvider       `json:"type,omitempty"`                                                          // 新的上游服务提供方。
+	Enabled         *bool                  `json:"enabled,omitempty"`                                                       // 新的启用状态。
+	BaseURL         *string                `json:"base_url,omitempty"`                                                      // 新的上游基础地址。
+	Key             *string                `json:"key,omitempty"`                                                           // 新的上游访问凭据。
+	Model           *string                `json:"model,omitempty"`                                                         // 新的自动同步模型列表。
+	CustomModel     *string                `json:"custom_model,omitempty"`                                                  // 新的自定义模型列表。
+	Proxy           *bool                  `json:"proxy,omitempty"`                                                         // 新的代理开关。
+	AutoSync        *bool                  `json:"auto_sync,omitempty"`                                                     // 新的自动同步开关。
+	CustomHeader    *[]CustomHeader        `json:"custom_header,omitempty"`                                                 // 新的自定义 Header。
+	ChannelProxy    *string                `json:"channel_proxy,omitempty"`                                                 // 新的渠道代理地址。
+	ParamOverride   *string                `json:"param_override,omitempty"`                                                // 新的参数覆盖配置。
+	MatchRegex      *string                `json:"match_regex,omitempty"`                                                   // 新的模型过滤表达式。
+	PriceMultiplier *float64               `json:"price_multiplier,omitempty"`                                              // 新的价格倍率。
+	KeyStrategy     *ChannelKeyStrategy    `json:"key_strategy,omitempty" binding:"omitempty,oneof=round_robin least_used"` // 新的凭据选择策略。
+	APIVersion      *string                `json:"api_version,omitempty"`                                                   // 新的 Azure api-version。
+	Deployments     *map[string]string     `json:"deployments,omitempty"`                                                   // 新的 Azure 部署映射。
+	Region          *string                `json:"region,omitempty"`                                                        // 新的 Bedrock 或 Vertex 区域。
+	ProjectID       *string                `json:"project_id,omitempty"`                                                    // 新的 Vertex 项目。
+	Compatible      *CompatibleConfig      `json:"compatible,omitempty"`                                                    // 新的 OpenAI 兼容接口配置, 需发送完整配置。
+	OllamaNative    *bool                  `json:"ollama_native,omitempty"`                                                 // 新的 Ollama 原生接口开关。
+	Mock            *MockConfig            `json:"mock,omitempty"`                                                          // 新的模拟渠道配置, 需发送完整配置。
+	MaxConcurrency  *int                   `json:"max_concurrency,omitempty" binding:"omitempty,min=0"`                     // 新的并发上限。
+	MaxRPM          *int                   `json:"max_rpm,omitempty" binding:"omitempty,min=0"`                             // 新的每分钟请求数上限。
+	KeysToAdd       []ChannelKeyAddRequest `json:"keys_to_add,omitempty"`                                                   // 待新增的附加凭据。
+	KeysToDelete    []int                  `json:"keys_to_delete,omitempty"`                                                // 待删除的附加凭据 ID。
 }
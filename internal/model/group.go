@@ -4,18 +4,34 @@ package model
 type GroupMode string
 
 const (
-	GroupModeManual   GroupMode = "manual"   // 只使用人工选中的成员。
-	GroupModeFailover GroupMode = "failover" // 按成员排序选择并在失败时切换。
+	GroupModeManual      GroupMode = "manual"       // 只使用人工选中的成员。
+	GroupModeFailover    GroupMode = "failover"     // 按成员排序选择并在失败时切换。
+	GroupModeLoadBalance GroupMode = "load_balance" // 按成员权重在可用成员间分摊请求。
+	GroupModeLatency     GroupMode = "latency"      // 优先选择近期观测最快的成员并偶尔探索其他成员。
+	GroupModeCost        GroupMode = "cost"         // 按预期费用从低到高选择并在失败时切换。
 )
 
+// Valid 判断分组模式是否为已支持的取值。
+func (m GroupMode) Valid() bool {
+	switch m {
+	case GroupModeManual, GroupModeFailover, GroupModeLoadBalance, GroupModeLatency, GroupModeCost:
+		return true
+	default:
+		return false
+	}
+}
+
 // 分组 Relay 的持久化配置，数据库中以 JSON 存储。
 type GroupRelayConfig struct {
-	MemberMaxAttempts                     int `json:"member_max_attempts" binding:"omitempty,min=1"`                        // 单个成员包含首次请求的总尝试次数，仅在故障转移模式生效。
+	MemberMaxAttempts                     int `json:"member_max_attempts" binding:"omitempty,min=1"`                        // 单个成员包含首次请求的总尝试次数，手动模式不生效。
 	MemberRetryIntervalSeconds            int `json:"member_retry_interval_seconds" binding:"omitempty,min=1"`              // 同一成员相邻两次尝试之间的等待秒数。
 	MemberNonStreamResponseTimeoutSeconds int `json:"member_non_stream_response_timeout_seconds" binding:"omitempty,min=1"` // 单个成员返回完整非流式响应的超时秒数。
 	MemberStreamFirstEventTimeoutSeconds  int `json:"member_stream_first_event_timeout_seconds" binding:"omitempty,min=1"`  // 单个成员返回首个有效流事件的超时秒数。
-	MemberCooldownSeconds                 int `json:"member_cooldown_seconds" binding:"omitempty,min=1"`                    // 单个成员耗尽尝试后被跳过的秒数，仅在故障转移模式生效。
+	MemberCooldownSeconds                 int `json:"member_cooldown_seconds" binding:"omitempty,min=1"`                    // 单个成员耗尽尝试后被跳过的秒数，手动模式不生效。
 	MemberAffinitySeconds                 int `json:"member_affinity_seconds" binding:"omitempty,min=0"`                    // 成员亲和时间:故障切换成功后继续保持当前成员的秒数;当前成员失败会立即结束亲和,0 表示不保持。
+	HedgeDelayMilliseconds                int `json:"hedge_delay_milliseconds" binding:"omitempty,min=0"`                   // 对冲延迟:首轮在此毫秒数内未取得首个有效响应时向下一个可用成员并发第二轮,0 表示不对冲，手动模式不生效。
+	MaxTotalAttempts                      int `json:"max_total_attempts" binding:"omitempty,min=0"`                         // 单个请求最多请求上游的总轮数，含对冲轮次，0 表示使用全局设置。
+	MaxTotalWaitSeconds                   int `json:"max_total_wait_seconds" binding:"omitempty,min=0"`                     // 单个请求提交响应前的最长总耗时秒数，0 表示使用全局设置。
 }
 
 // DefaultGroupRelayConfig 返回新分组使用的 Relay 默认配置。
@@ -55,16 +71,25 @@ func NormalizeGroupRelayConfig(config *GroupRelayConfig) {
 	if config.MemberAffinitySeconds < 0 {
 		config.MemberAffinitySeconds = defaults.MemberAffinitySeconds
 	}
+	if config.HedgeDelayMilliseconds < 0 {
+		config.HedgeDelayMilliseconds = defaults.HedgeDelayMilliseconds
+	}
+	if config.MaxTotalAttempts < 0 {
+		config.MaxTotalAttempts = defaults.MaxTotalAttempts
+	}
+	if config.MaxTotalWaitSeconds < 0 {
+		config.MaxTotalWaitSeconds = defaults.MaxTotalWaitSeconds
+	}
 }
 
 // 客户端模型名称及其可手动选择或故障转移的上游分组。
 type Group struct {
-	ID           int              `json:"id" gorm:"primaryKey"`                                                          // 分组主键。
-	Name         string           `json:"name" gorm:"unique;not null"`                                                   // 客户端请求使用的模型名称。
-	Mode         GroupMode        `json:"mode" gorm:"not null;default:manual" binding:"omitempty,oneof=manual failover"` // 选择成员的模式。
-	ActiveItemID int              `json:"active_item_id" gorm:"not null;default:0"`                                      // 手动模式指定的成员，故障转移模式保留但忽略该值，0 表示未指定。
-	RelayConfig  GroupRelayConfig `json:"relay_config" gorm:"serializer:json"`                                           // 该分组的 Relay 路由配置。
-	Items        []GroupItem      `json:"items,omitempty" gorm:"foreignKey:GroupID"`                                     // 该分组可手动选择或故障转移的渠道模型。
+	ID           int              `json:"id" gorm:"primaryKey"`                                                                                    // 分组主键。
+	Name         string           `json:"name" gorm:"unique;not null"`                                                                             // 客户端请求使用的模型名称。
+	Mode         GroupMode        `json:"mode" gorm:"not null;default:manual" binding:"omitempty,oneof=manual failover load_balance latency cost"` // 选择成员的模式。
+	ActiveItemID int              `json:"active_item_id" gorm:"not null;default:0"`                                                                // 手动模式指定的成员，其余模式保留但忽略该值，0 表示未指定。
+	RelayConfig  GroupRelayConfig `json:"relay_config" gorm:"serializer:json"`                                                                     // 该分组的 Relay 路由配置。
+	Items        []GroupItem      `json:"items,omitempty" gorm:"foreignKey:GroupID"`                                                               // 该分组可手动选择或故障转移的渠道模型。
 }
 
 // 分组内一个可选择的渠道模型。
@@ -74,17 +99,18 @@ type GroupItem struct {
 	ChannelID int    `json:"channel_id" gorm:"not null;index:idx_group_channel_model,unique"` // 实际上游渠道 ID。
 	ModelName string `json:"model_name" gorm:"not null;index:idx_group_channel_model,unique"` // 该渠道实际请求的模型名称。
 	Priority  int    `json:"priority"`                                                        // Priority 决定界面展示和故障转移模式下的成员切换顺序。
+	Weight    int    `json:"weight" gorm:"not null;default:1"`                                // Weight 决定负载均衡模式下分摊给该成员的流量比例，最小为 1。
 }
 
 // 分组普通配置和成员变更请求。
 type GroupUpdateRequest struct {
-	ID            int                      `json:"id" binding:"required"`                                    // 待更新的分组主键。
-	Name          *string                  `json:"name,omitempty"`                                           // Name 仅在名称变更时发送。
-	Mode          *GroupMode               `json:"mode,omitempty" binding:"omitempty,oneof=manual failover"` // Mode 仅在选择模式变更时发送。
-	RelayConfig   *GroupRelayConfig        `json:"relay_config,omitempty"`                                   // RelayConfig 仅在 Relay 配置变更时发送完整配置。
-	ItemsToAdd    []GroupItemAddRequest    `json:"items_to_add,omitempty"`                                   // 待新增的分组项。
-	ItemsToUpdate []GroupItemUpdateRequest `json:"items_to_update,omitempty"`                                // 待调整展示和故障转移顺序的分组项。
-	ItemsToDelete []int                    `json:"items_to_delete,omitempty"`                                // 待删除的分组项 ID。
+	ID            int                      `json:"id" binding:"required"`                                                              // 待更新的分组主键。
+	Name          *string                  `json:"name,omitempty"`                                                                     // Name 仅在名称变更时发送。
+	Mode          *GroupMode               `json:"mode,omitempty" binding:"omitempty,oneof=manual failover load_balance latency cost"` // Mode 仅在选择模式变更时发送。
+	RelayConfig   *GroupRelayConfig        `json:"relay_config,omitempty"`                                                             // RelayConfig 仅在 Relay 配置变更时发送完整配置。
+	ItemsToAdd    []GroupItemAddRequest    `json:"items_to_add,omitempty"`                                                             // 待新增的分组项。
+	ItemsToUpdate []GroupItemUpdateRequest `json:"items_to_update,omitempty"`                                                          // 待调整展示顺序、故障转移顺序或权重的分组项。
+	ItemsToDelete []int                    `json:"items_to_delete,omitempty"`                                                          // 待删除的分组项 ID。
 }
 
 // 手动模式下切换或清空分组成员的请求。
@@ -97,10 +123,12 @@ type GroupItemAddRequest struct {
 	ChannelID int    `json:"channel_id" binding:"required"` // 实际上游渠道 ID。
 	ModelName string `json:"model_name" binding:"required"` // 该渠道实际请求的模型名称。
 	Priority  int    `json:"priority,omitempty"`            // 分组项的界面展示和故障转移顺序。
+	Weight    int    `json:"weight,omitempty"`              // 分组项的负载均衡权重，缺省为 1。
 }
 
-// 分组项展示和故障转移顺序更新请求。
+// 分组项展示顺序、故障转移顺序和权重更新请求。
 type GroupItemUpdateRequest struct {
-	ID       int `json:"id" binding:"required"` // 待更新的分组项主键。
-	Priority int `json:"priority,omitempty"`    // 新的界面展示和故障转移顺序。
+	ID       int  `json:"id" binding:"required"` // 待更新的分组项主键。
+	Priority int  `json:"priority,omitempty"`    // 新的界面展示和故障转移顺序。
+	Weight   *int `json:"weight,omitempty"`      // 新的负载均衡权重，仅在权重变更时发送。
 }
@@ -1,10 +1,30 @@
 package model
 
+import "maps"
+
 type LLMPrice struct {
-	Input      float64 `json:"input"`
-	Output     float64 `json:"output"`
-	CacheRead  float64 `json:"cache_read"`
-	CacheWrite float64 `json:"cache_write"`
+	Input       float64            `json:"input"`
+	Output      float64            `json:"output"`
+	CacheRead   float64            `json:"cache_read"`
+	CacheWrite  float64            `json:"cache_write"`
+	Image       float64            `json:"image"`                                        // 每张图片的默认价格。
+	ImageSizes  map[string]float64 `json:"image_sizes,omitempty" gorm:"serializer:json"` // 按尺寸覆盖的每张图片价格, 键为 1024x1024 等尺寸。
+	AudioSecond float64            `json:"audio_second"`                                 // 每秒输入音频的价格, 用于语音转写。
+	Character   float64            `json:"character"`                                    // 每百万输入字符的价格, 用于语音合成。
+}
+
+// ImagePrice 返回指定尺寸每张图片的价格, 未单独定价的尺寸按默认价格计算。
+func (p LLMPrice) ImagePrice(size string) float64 {
+	if price, ok := p.ImageSizes[size]; ok {
+		return price
+	}
+	return p.Image
+}
+
+// Equal 报告两个价格是否完全相同, 按尺寸定价表按内容比较。
+func (p LLMPrice) Equal(other LLMPrice) bool {
+	return p.Input == other.Input && p.Output == other.Output && p.CacheRead == other.CacheRead && p.CacheWrite == other.CacheWrite &&
+		p.Image == other.Image && maps.Equal(p.ImageSizes, other.ImageSizes) && p.AudioSecond == other.AudioSecond && p.Character == other.Character
 }
 
 type LLMInfo struct {
@@ -41,6 +61,33 @@ type OpenAIModelList struct {
 	Object string        `json:"object"`
 	Data   []OpenAIModel `json:"data"`
 }
+type BedrockModel struct {
+	ModelID      string `json:"modelId"`
+	ModelName    string `json:"modelName"`
+	ProviderName string `json:"providerName"`
+}
+
+type BedrockModelList struct {
+	ModelSummaries []BedrockModel `json:"modelSummaries"`
+}
+
+type VertexModel struct {
+	Name string `json:"name"`
+}
+
+type VertexModelList struct {
+	PublisherModels []VertexModel `json:"publisherModels"`
+	NextPageToken   string        `json:"nextPageToken"`
+}
+
+type OllamaModel struct {
+	Name string `json:"name"`
+}
+
+type OllamaModelList struct {
+	Models []OllamaModel `json:"models"`
+}
+
 type AnthropicModel struct {
 	ID          string `json:"id"`
 	CreatedAt   string `json:"created_at"`
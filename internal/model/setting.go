@@ -14,6 +14,10 @@ const (
 	SettingKeyModelInfoUpdateInterval SettingKey = "model_info_update_interval" // 模型信息更新间隔(小时)
 	SettingKeySyncLLMInterval         SettingKey = "sync_llm_interval"          // LLM 同步间隔(小时)
 	SettingKeyCORSAllowOrigins        SettingKey = "cors_allow_origins"         // 跨域白名单(逗号分隔, 如 "example.com,example2.com"). 为空不允许跨域, "*"允许所有
+	SettingKeyRelayMaxTotalAttempts   SettingKey = "relay_max_total_attempts"   // 单个请求最多请求上游的总轮数, 分组未配置时生效, 0 表示不限制
+	SettingKeyRelayMaxTotalWait       SettingKey = "relay_max_total_wait"       // 单个请求提交响应前的最长总耗时(秒), 分组未配置时生效, 0 表示不限制
+	SettingKeyRelayDefaultMaxOutput   SettingKey = "relay_default_max_output"   // 请求未声明输出上限时, 预估最坏情况费用所用的输出 Token 数
+	SettingKeyRelayUnestimatedBudget  SettingKey = "relay_unestimated_budget"   // 无法预估费用的请求要求 API Key 至少剩余的预算, 剩余预算更少时拒绝
 )
 
 type Setting struct {
@@ -24,10 +28,14 @@ type Setting struct {
 func DefaultSettings() []Setting {
 	return []Setting{
 		{Key: SettingKeyProxyURL, Value: ""},
-		{Key: SettingKeyStatsSaveInterval, Value: "10"},       // 默认10分钟保存一次统计信息
-		{Key: SettingKeyCORSAllowOrigins, Value: ""},          // CORS 默认不允许跨域，设置为 "*" 才允许所有来源
-		{Key: SettingKeyModelInfoUpdateInterval, Value: "24"}, // 默认24小时更新一次模型信息
-		{Key: SettingKeySyncLLMInterval, Value: "24"},         // 默认24小时同步一次LLM
+		{Key: SettingKeyStatsSaveInterval, Value: "10"},        // 默认10分钟保存一次统计信息
+		{Key: SettingKeyCORSAllowOrigins, Value: ""},           // CORS 默认不允许跨域，设置为 "*" 才允许所有来源
+		{Key: SettingKeyModelInfoUpdateInterval, Value: "24"},  // 默认24小时更新一次模型信息
+		{Key: SettingKeySyncLLMInterval, Value: "24"},          // 默认24小时同步一次LLM
+		{Key: SettingKeyRelayMaxTotalAttempts, Value: "10"},    // 默认单个请求最多请求上游10轮
+		{Key: SettingKeyRelayMaxTotalWait, Value: "300"},       // 默认单个请求最多等待300秒仍未取得响应即放弃
+		{Key: SettingKeyRelayDefaultMaxOutput, Value: "32000"}, // 默认按32000个输出Token预估未声明输出上限的请求
+		{Key: SettingKeyRelayUnestimatedBudget, Value: "1"},    // 默认无法预估费用的请求要求至少剩余1的预算
 	}
 }
 
@@ -39,6 +47,24 @@ func (s *Setting) Validate() error {
 			return fmt.Errorf("model info update interval must be an integer")
 		}
 		return nil
+	case SettingKeyRelayMaxTotalAttempts, SettingKeyRelayMaxTotalWait:
+		value, err := strconv.Atoi(s.Value)
+		if err != nil || value < 0 {
+			return fmt.Errorf("relay limit must be a non-negative integer")
+		}
+		return nil
+	case SettingKeyRelayDefaultMaxOutput:
+		value, err := strconv.Atoi(s.Value)
+		if err != nil || value < 0 {
+			return fmt.Errorf("default max output must be a non-negative integer")
+		}
+		return nil
+	case SettingKeyRelayUnestimatedBudget:
+		value, err := strconv.ParseFloat(s.Value, 64)
+		if err != nil || value < 0 {
+			return fmt.Errorf("unestimated request budget must be a non-negative number")
+		}
+		return nil
 	case SettingKeyProxyURL:
 		if s.Value == "" {
 			return nil
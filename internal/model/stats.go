@@ -38,11 +38,33 @@ type StatsChannel struct {
 	StatsMetrics
 }
 
+// StatsChannelKey 是渠道单个凭据的统计, KeyID 为 0 表示渠道主凭据。
+type StatsChannelKey struct {
+	ChannelID int `json:"channel_id" gorm:"primaryKey;autoIncrement:false"`
+	KeyID     int `json:"key_id" gorm:"primaryKey;autoIncrement:false"`
+	StatsMetrics
+}
+
 type StatsAPIKey struct {
 	APIKeyID int `json:"api_key_id" gorm:"primaryKey"`
 	StatsMetrics
 }
 
+// StatsAPIKeyModel 是 API Key 按请求的模型名称, 即分组名称划分的统计。
+type StatsAPIKeyModel struct {
+	APIKeyID int    `json:"api_key_id" gorm:"primaryKey;autoIncrement:false"`
+	Model    string `json:"model" gorm:"primaryKey"`
+	StatsMetrics
+}
+
+// StatsAPIKeyPeriod 是 API Key 在一个预算周期内的统计, 周期结束后保留为历史记录。
+type StatsAPIKeyPeriod struct {
+	APIKeyID int          `json:"api_key_id" gorm:"primaryKey;autoIncrement:false"`
+	Period   BudgetPeriod `json:"period" gorm:"primaryKey"`
+	Start    string       `json:"start" gorm:"primaryKey"` // 周期开始日期，格式：20060102
+	StatsMetrics
+}
+
 // Add aggregates another StatsMetrics into the current one.
 func (s *StatsMetrics) Add(delta StatsMetrics) {
 	s.InputToken += delta.InputToken
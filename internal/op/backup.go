@@ -25,6 +25,9 @@ func DBExportAll(ctx context.Context, includeStats bool) (*model.DBDump, error)
 	if err := conn.Find(&d.Channels).Error; err != nil {
 		return nil, fmt.Errorf("export channels: %w", err)
 	}
+	if err := conn.Find(&d.ChannelKeys).Error; err != nil {
+		return nil, fmt.Errorf("export channel_keys: %w", err)
+	}
 	if err := conn.Find(&d.Groups).Error; err != nil {
 		return nil, fmt.Errorf("export groups: %w", err)
 	}
@@ -57,9 +60,18 @@ func DBExportAll(ctx context.Context, includeStats bool) (*model.DBDump, error)
 		if err := conn.Find(&d.StatsChannel).Error; err != nil {
 			return nil, fmt.Errorf("export stats_channel: %w", err)
 		}
+		if err := conn.Find(&d.StatsChannelKey).Error; err != nil {
+			return nil, fmt.Errorf("export stats_channel_key: %w", err)
+		}
 		if err := conn.Find(&d.StatsAPIKey).Error; err != nil {
 			return nil, fmt.Errorf("export stats_api_key: %w", err)
 		}
+		if err := conn.Find(&d.StatsAPIKeyModel).Error; err != nil {
+			return nil, fmt.Errorf("export stats_api_key_model: %w", err)
+		}
+		if err := conn.Find(&d.StatsAPIKeyPeriod).Error; err != nil {
+			return nil, fmt.Errorf("export stats_api_key_period: %w", err)
+		}
 	}
 
 	return d, nil
@@ -84,6 +96,11 @@ func DBImportIncremental(ctx context.Context, dump *model.DBDump) (*model.DBImpo
 		} else {
 			res.RowsAffected["channels"] = n
 		}
+		if n, err := createDoNothing(tx, dump.ChannelKeys); err != nil {
+			return fmt.Errorf("import channel_keys: %w", err)
+		} else {
+			res.RowsAffected["channel_keys"] = n
+		}
 		if n, err := createDoNothing(tx, dump.Groups); err != nil {
 			return fmt.Errorf("import groups: %w", err)
 		} else {
@@ -136,11 +153,26 @@ func DBImportIncremental(ctx context.Context, dump *model.DBDump) (*model.DBImpo
 			} else {
 				res.RowsAffected["stats_channel"] = n
 			}
+			if n, err := createUpsertAll(tx, dump.StatsChannelKey, []clause.Column{{Name: "channel_id"}, {Name: "key_id"}}); err != nil {
+				return fmt.Errorf("import stats_channel_key: %w", err)
+			} else {
+				res.RowsAffected["stats_channel_key"] = n
+			}
 			if n, err := createUpsertAll(tx, dump.StatsAPIKey, []clause.Column{{Name: "api_key_id"}}); err != nil {
 				return fmt.Errorf("import stats_api_key: %w", err)
 			} else {
 				res.RowsAffected["stats_api_key"] = n
 			}
+			if n, err := createUpsertAll(tx, dump.StatsAPIKeyModel, []clause.Column{{Name: "api_key_id"}, {Name: "model"}}); err != nil {
+				return fmt.Errorf("import stats_api_key_model: %w", err)
+			} else {
+				res.RowsAffected["stats_api_key_model"] = n
+			}
+			if n, err := createUpsertAll(tx, dump.StatsAPIKeyPeriod, []clause.Column{{Name: "api_key_id"}, {Name: "period"}, {Name: "start"}}); err != nil {
+				return fmt.Errorf("import stats_api_key_period: %w", err)
+			} else {
+				res.RowsAffected["stats_api_key_period"] = n
+			}
 		}
 
 		return nil
@@ -87,6 +87,57 @@ func ChannelUpdate(req *model.ChannelUpdateRequest, ctx context.Context) (*model
 		selectFields = append(selectFields, "match_regex")
 		updates.MatchRegex = req.MatchRegex
 	}
+	if req.PriceMultiplier != nil {
+		selectFields = append(selectFields, "price_multiplier")
+		updates.PriceMultiplier = *req.PriceMultiplier
+	}
+	if req.KeyStrategy != nil {
+		selectFields = append(selectFields, "key_strategy")
+		updates.KeyStrategy = *req.KeyStrategy
+	}
+	if req.APIVersion != nil {
+		selectFields = append(selectFields, "api_version")
+		updates.APIVersion = *req.APIVersion
+	}
+	if req.Deployments != nil {
+		selectFields = append(selectFields, "deployments")
+		updates.Deployments = *req.Deployments
+	}
+	if req.Region != nil {
+		selectFields = append(selectFields, "region")
+		updates.Region = *req.Region
+	}
+	if req.ProjectID != nil {
+		selectFields = append(selectFields, "project_id")
+		updates.ProjectID = *req.ProjectID
+	}
+	if req.Compatible != nil {
+		selectFields = append(selectFields, "compatible")
+		updates.Compatible = *req.Compatible
+	}
+	if req.OllamaNative != nil {
+		selectFields = append(selectFields, "ollama_native")
+		updates.OllamaNative = *req.OllamaNative
+	}
+	if req.Mock != nil {
+		selectFields = append(selectFields, "mock")
+		updates.Mock = *req.Mock
+	}
+	if req.MaxConcurrency != nil {
+		selectFields = append(selectFields, "max_concurrency")
+		updates.MaxConcurrency = *req.MaxConcurrency
+	}
+	if req.MaxRPM != nil {
+		selectFields = append(selectFields, "max_rpm")
+		updates.MaxRPM = *req.MaxRPM
+	}
+	newKeys := make([]model.ChannelKey, len(req.KeysToAdd))
+	for i, key := range req.KeysToAdd {
+		newKeys[i] = model.ChannelKey{ChannelID: req.ID, Key: strings.TrimSpace(key.Key), Remark: key.Remark}
+		if newKeys[i].Key == "" {
+			return nil, fmt.Errorf("channel key cannot be empty")
+		}
+	}
 
 	var modelNames []string
 	if req.Model != nil || req.CustomModel != nil {
@@ -133,7 +184,20 @@ func ChannelUpdate(req *model.ChannelUpdateRequest, ctx context.Context) (*model
 				return err
 			}
 		}
-		if err := tx.First(&channel, req.ID).Error; err != nil {
+		if len(req.KeysToDelete) > 0 {
+			if err := tx.Where("channel_id = ? AND key_id IN ?", req.ID, req.KeysToDelete).Delete(&model.StatsChannelKey{}).Error; err != nil {
+				return fmt.Errorf("failed to delete channel key stats: %w", err)
+			}
+			if err := tx.Where("id IN ? AND channel_id = ?", req.KeysToDelete, req.ID).Delete(&model.ChannelKey{}).Error; err != nil {
+				return fmt.Errorf("failed to delete channel keys: %w", err)
+			}
+		}
+		if len(newKeys) > 0 {
+			if err := tx.Create(&newKeys).Error; err != nil {
+				return fmt.Errorf("failed to create channel keys: %w", err)
+			}
+		}
+		if err := tx.Preload("Keys").First(&channel, req.ID).Error; err != nil {
 			return fmt.Errorf("failed to load updated channel: %w", err)
 		}
 		return nil
@@ -143,6 +207,9 @@ func ChannelUpdate(req *model.ChannelUpdateRequest, ctx context.Context) (*model
 
 	// 先移除分组缓存中的失效成员，再暴露渠道的新模型配置。
 	groupItemCleanupCache(groupIDs, itemIDs)
+	if len(req.KeysToDelete) > 0 {
+		statsChannelKeyCacheDel(req.ID, req.KeysToDelete...)
+	}
 	channelCache.Set(channel.ID, channel)
 	return &channel, nil
 }
@@ -179,6 +246,14 @@ func ChannelDel(id int, ctx context.Context) error {
 		if err := tx.Where("channel_id = ?", id).Delete(&model.StatsChannel{}).Error; err != nil {
 			return fmt.Errorf("failed to delete channel stats: %w", err)
 		}
+		if err := tx.Where("channel_id = ?", id).Delete(&model.StatsChannelKey{}).Error; err != nil {
+			return fmt.Errorf("failed to delete channel key stats: %w", err)
+		}
+
+		// 删除附加凭据
+		if err := tx.Where("channel_id = ?", id).Delete(&model.ChannelKey{}).Error; err != nil {
+			return fmt.Errorf("failed to delete channel keys: %w", err)
+		}
 
 		// 删除渠道
 		if err := tx.Delete(&model.Channel{}, id).Error; err != nil {
@@ -197,6 +272,7 @@ func ChannelDel(id int, ctx context.Context) error {
 	statsChannelCache.Del(id)
 	delete(statsChannelCacheNeedUpdate, id)
 	statsChannelCacheNeedUpdateLock.Unlock()
+	statsChannelKeyCacheDel(id)
 	return nil
 }
 
@@ -229,7 +305,7 @@ func ChannelGet(id int) (model.Channel, error) {
 // channelRefreshCache 从数据库刷新全部渠道缓存。
 func channelRefreshCache(ctx context.Context) error {
 	channels := []model.Channel{}
-	if err := db.GetDB().WithContext(ctx).Find(&channels).Error; err != nil {
+	if err := db.GetDB().WithContext(ctx).Preload("Keys").Find(&channels).Error; err != nil {
 		log.Warnf("failed to get channels: %v", err)
 		return err
 	}
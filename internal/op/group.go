@@ -121,6 +121,7 @@ func GroupUpdate(req *model.GroupUpdateRequest, ctx context.Context) (*model.Gro
 			ChannelID: item.ChannelID,
 			ModelName: item.ModelName,
 			Priority:  item.Priority,
+			Weight:    item.Weight,
 		}
 	}
 	if err := normalizeAndValidateGroupItems(newItems); err != nil {
@@ -158,21 +159,31 @@ func GroupUpdate(req *model.GroupUpdateRequest, ctx context.Context) (*model.Gro
 			}
 		}
 
-		// 批量更新 items
+		// 批量更新 items；权重只改写明确携带的分组项，其余保持原值。
 		if len(req.ItemsToUpdate) > 0 {
 			ids := make([]int, len(req.ItemsToUpdate))
 			priorityCase := "CASE id"
+			weightCase := "CASE id"
+			weighted := false
 			for i, item := range req.ItemsToUpdate {
 				ids[i] = item.ID
 				priorityCase += fmt.Sprintf(" WHEN %d THEN %d", item.ID, item.Priority)
+				if item.Weight != nil {
+					weightCase += fmt.Sprintf(" WHEN %d THEN %d", item.ID, max(*item.Weight, 1))
+					weighted = true
+				}
 			}
 			priorityCase += " END"
+			weightCase += " ELSE weight END"
 
+			// CASE 至少需要一个 WHEN 分支, 没有分组项携带权重时不改写权重列。
+			columns := map[string]interface{}{"priority": gorm.Expr(priorityCase)}
+			if weighted {
+				columns["weight"] = gorm.Expr(weightCase)
+			}
 			if err := tx.Model(&model.GroupItem{}).
 				Where("id IN ? AND group_id = ?", ids, req.ID).
-				Updates(map[string]interface{}{
-					"priority": gorm.Expr(priorityCase),
-				}).Error; err != nil {
+				Updates(columns).Error; err != nil {
 				return fmt.Errorf("failed to update items: %w", err)
 			}
 		}
@@ -279,10 +290,11 @@ func GroupDel(id int, ctx context.Context) error {
 	return nil
 }
 
-// normalizeAndValidateGroupItems 规范化分组成员模型名，并验证引用的渠道模型真实存在。
+// normalizeAndValidateGroupItems 规范化分组成员模型名和权重，并验证引用的渠道模型真实存在。
 func normalizeAndValidateGroupItems(items []model.GroupItem) error {
 	for i := range items {
 		items[i].ModelName = strings.TrimSpace(items[i].ModelName)
+		items[i].Weight = max(items[i].Weight, 1)
 		item := items[i]
 		if item.ModelName == "" {
 			return fmt.Errorf("group item model name is required")
@@ -0,0 +1,125 @@
+package op
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bestruirui/octopus/internal/db"
+	"github.com/bestruirui/octopus/internal/model"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "octopus-op-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := 1
+	if err := db.InitDB("sqlite", filepath.Join(dir, "octopus.db"), false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else if err := InitCache(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		code = m.Run()
+	}
+	_ = db.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// createTestGroup 创建一个带两个模型的渠道和引用这两个模型的分组, name 同时用作渠道名与分组名。
+func createTestGroup(t *testing.T, name string, items []model.GroupItem) model.Group {
+	t.Helper()
+	ctx := context.Background()
+	channel := model.Channel{Name: name, Type: model.ChannelProviderOpenAI, Enabled: true, BaseURL: "https://example.com/v1", Model: "m1,m2"}
+	if err := ChannelCreate(&channel, ctx); err != nil {
+		t.Fatalf("ChannelCreate() error = %v", err)
+	}
+	for i := range items {
+		items[i].ChannelID = channel.ID
+	}
+	group := model.Group{Name: name, Mode: model.GroupModeLoadBalance, Items: items}
+	if err := GroupCreate(&group, ctx); err != nil {
+		t.Fatalf("GroupCreate() error = %v", err)
+	}
+	return group
+}
+
+func TestGroupUpdatePriorityWithoutWeights(t *testing.T) {
+	group := createTestGroup(t, "priority-only", []model.GroupItem{
+		{ModelName: "m1", Priority: 1, Weight: 3},
+		{ModelName: "m2", Priority: 2, Weight: 5},
+	})
+	first, second := group.Items[0], group.Items[1]
+
+	// 只调整顺序的请求不携带权重, 两个成员交换顺序后各自保留原有权重。
+	updated, err := GroupUpdate(&model.GroupUpdateRequest{
+		ID: group.ID,
+		ItemsToUpdate: []model.GroupItemUpdateRequest{
+			{ID: first.ID, Priority: 2},
+			{ID: second.ID, Priority: 1},
+		},
+	}, context.Background())
+	if err != nil {
+		t.Fatalf("GroupUpdate() error = %v", err)
+	}
+	if len(updated.Items) != 2 || updated.Items[0].ID != second.ID || updated.Items[1].ID != first.ID {
+		t.Fatalf("items after reorder = %+v", updated.Items)
+	}
+	if updated.Items[0].Weight != 5 || updated.Items[1].Weight != 3 {
+		t.Errorf("weights after reorder = %d, %d, want 5, 3", updated.Items[0].Weight, updated.Items[1].Weight)
+	}
+}
+
+func TestGroupUpdateWeights(t *testing.T) {
+	group := createTestGroup(t, "weights", []model.GroupItem{
+		{ModelName: "m1", Priority: 1},
+		{ModelName: "m2", Priority: 2, Weight: 4},
+	})
+	first, second := group.Items[0], group.Items[1]
+	if first.Weight != 1 {
+		t.Errorf("default weight = %d, want 1", first.Weight)
+	}
+
+	// 只改写携带权重的成员, 小于 1 的权重按 1 保存。
+	weight, zero := 7, 0
+	updated, err := GroupUpdate(&model.GroupUpdateRequest{
+		ID: group.ID,
+		ItemsToUpdate: []model.GroupItemUpdateRequest{
+			{ID: first.ID, Priority: 1, Weight: &weight},
+			{ID: second.ID, Priority: 2},
+		},
+	}, context.Background())
+	if err != nil {
+		t.Fatalf("GroupUpdate() error = %v", err)
+	}
+	if updated.Items[0].Weight != 7 || updated.Items[1].Weight != 4 {
+		t.Errorf("weights = %d, %d, want 7, 4", updated.Items[0].Weight, updated.Items[1].Weight)
+	}
+
+	updated, err = GroupUpdate(&model.GroupUpdateRequest{
+		ID:            group.ID,
+		ItemsToUpdate: []model.GroupItemUpdateRequest{{ID: second.ID, Priority: 2, Weight: &zero}},
+	}, context.Background())
+	if err != nil {
+		t.Fatalf("GroupUpdate() error = %v", err)
+	}
+	if updated.Items[1].Weight != 1 {
+		t.Errorf("zero weight saved as %d, want 1", updated.Items[1].Weight)
+	}
+
+	// 缓存与数据库中的权重一致。
+	if err := groupRefreshCache(context.Background()); err != nil {
+		t.Fatalf("groupRefreshCache() error = %v", err)
+	}
+	cached, err := GroupGetByName("weights")
+	if err != nil {
+		t.Fatalf("GroupGetByName() error = %v", err)
+	}
+	if cached.Items[0].Weight != 7 || cached.Items[1].Weight != 1 {
+		t.Errorf("reloaded weights = %d, %d, want 7, 1", cached.Items[0].Weight, cached.Items[1].Weight)
+	}
+}
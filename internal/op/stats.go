@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -28,6 +30,16 @@ var statsChannelCache = cache.New[int, model.StatsChannel](16)
 var statsChannelCacheNeedUpdate = make(map[int]struct{})
 var statsChannelCacheNeedUpdateLock sync.Mutex
 
+// channelKeyStatsID 标识一个渠道凭据的统计, keyID 为 0 表示渠道主凭据。
+type channelKeyStatsID struct {
+	channelID int
+	keyID     int
+}
+
+var statsChannelKeyCache = cache.New[channelKeyStatsID, model.StatsChannelKey](16)
+var statsChannelKeyCacheNeedUpdate = make(map[channelKeyStatsID]struct{})
+var statsChannelKeyCacheNeedUpdateLock sync.Mutex
+
 var statsModelCache = cache.New[int, model.StatsModel](16)
 var statsModelCacheNeedUpdate = make(map[int]struct{})
 var statsModelCacheNeedUpdateLock sync.Mutex
@@ -36,6 +48,27 @@ var statsAPIKeyCache = cache.New[int, model.StatsAPIKey](16)
 var statsAPIKeyCacheNeedUpdate = make(map[int]struct{})
 var statsAPIKeyCacheNeedUpdateLock sync.Mutex
 
+// apiKeyModelStatsID 标识 API Key 在一个模型上的统计。
+type apiKeyModelStatsID struct {
+	apiKeyID int
+	model    string
+}
+
+var statsAPIKeyModelCache = cache.New[apiKeyModelStatsID, model.StatsAPIKeyModel](16)
+var statsAPIKeyModelCacheNeedUpdate = make(map[apiKeyModelStatsID]struct{})
+var statsAPIKeyModelCacheNeedUpdateLock sync.Mutex
+
+// apiKeyPeriodStatsID 标识 API Key 一个预算周期的统计。
+type apiKeyPeriodStatsID struct {
+	apiKeyID int
+	period   model.BudgetPeriod
+	start    string
+}
+
+var statsAPIKeyPeriodCache = cache.New[apiKeyPeriodStatsID, model.StatsAPIKeyPeriod](16)
+var statsAPIKeyPeriodCacheNeedUpdate = make(map[apiKeyPeriodStatsID]struct{})
+var statsAPIKeyPeriodCacheNeedUpdateLock sync.Mutex
+
 func StatsSaveDBTask() {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
@@ -74,6 +107,14 @@ func StatsSaveDB(ctx context.Context) error {
 	statsChannelCacheNeedUpdate = make(map[int]struct{})
 	statsChannelCacheNeedUpdateLock.Unlock()
 
+	statsChannelKeyCacheNeedUpdateLock.Lock()
+	channelKeyIDs := make([]channelKeyStatsID, 0, len(statsChannelKeyCacheNeedUpdate))
+	for id := range statsChannelKeyCacheNeedUpdate {
+		channelKeyIDs = append(channelKeyIDs, id)
+	}
+	statsChannelKeyCacheNeedUpdate = make(map[channelKeyStatsID]struct{})
+	statsChannelKeyCacheNeedUpdateLock.Unlock()
+
 	statsModelCacheNeedUpdateLock.Lock()
 	modelIDs := make([]int, 0, len(statsModelCacheNeedUpdate))
 	for id := range statsModelCacheNeedUpdate {
@@ -90,21 +131,54 @@ func StatsSaveDB(ctx context.Context) error {
 	statsAPIKeyCacheNeedUpdate = make(map[int]struct{})
 	statsAPIKeyCacheNeedUpdateLock.Unlock()
 
-	if err := persistStatsSnapshots(ctx, totalSnap, dailySnap, hourlyAll, channelIDs, modelIDs, apiKeyIDs); err != nil {
-		restoreStatsDirty(channelIDs, modelIDs, apiKeyIDs)
+	apiKeyModelIDs := takeAPIKeyModelDirty()
+	apiKeyPeriodIDs := takeAPIKeyPeriodDirty()
+
+	if err := persistStatsSnapshots(ctx, totalSnap, dailySnap, hourlyAll, channelIDs, channelKeyIDs, modelIDs, apiKeyIDs, apiKeyModelIDs, apiKeyPeriodIDs); err != nil {
+		restoreStatsDirty(channelIDs, channelKeyIDs, modelIDs, apiKeyIDs, apiKeyModelIDs, apiKeyPeriodIDs)
 		return err
 	}
 	return nil
 }
 
+// takeAPIKeyModelDirty 取出并清空待持久化的 API Key 模型统计标记。
+func takeAPIKeyModelDirty() []apiKeyModelStatsID {
+	statsAPIKeyModelCacheNeedUpdateLock.Lock()
+	defer statsAPIKeyModelCacheNeedUpdateLock.Unlock()
+	ids := make([]apiKeyModelStatsID, 0, len(statsAPIKeyModelCacheNeedUpdate))
+	for id := range statsAPIKeyModelCacheNeedUpdate {
+		ids = append(ids, id)
+	}
+	statsAPIKeyModelCacheNeedUpdate = make(map[apiKeyModelStatsID]struct{})
+	return ids
+}
+
+// takeAPIKeyPeriodDirty 取出并清空待持久化的 API Key 周期统计标记。
+func takeAPIKeyPeriodDirty() []apiKeyPeriodStatsID {
+	statsAPIKeyPeriodCacheNeedUpdateLock.Lock()
+	defer statsAPIKeyPeriodCacheNeedUpdateLock.Unlock()
+	ids := make([]apiKeyPeriodStatsID, 0, len(statsAPIKeyPeriodCacheNeedUpdate))
+	for id := range statsAPIKeyPeriodCacheNeedUpdate {
+		ids = append(ids, id)
+	}
+	statsAPIKeyPeriodCacheNeedUpdate = make(map[apiKeyPeriodStatsID]struct{})
+	return ids
+}
+
 // restoreStatsDirty 在统计持久化失败后恢复本批待写标记。
-func restoreStatsDirty(channelIDs, modelIDs, apiKeyIDs []int) {
+func restoreStatsDirty(channelIDs []int, channelKeyIDs []channelKeyStatsID, modelIDs, apiKeyIDs []int, apiKeyModelIDs []apiKeyModelStatsID, apiKeyPeriodIDs []apiKeyPeriodStatsID) {
 	statsChannelCacheNeedUpdateLock.Lock()
 	for _, id := range channelIDs {
 		statsChannelCacheNeedUpdate[id] = struct{}{}
 	}
 	statsChannelCacheNeedUpdateLock.Unlock()
 
+	statsChannelKeyCacheNeedUpdateLock.Lock()
+	for _, id := range channelKeyIDs {
+		statsChannelKeyCacheNeedUpdate[id] = struct{}{}
+	}
+	statsChannelKeyCacheNeedUpdateLock.Unlock()
+
 	statsModelCacheNeedUpdateLock.Lock()
 	for _, id := range modelIDs {
 		statsModelCacheNeedUpdate[id] = struct{}{}
@@ -116,6 +190,18 @@ func restoreStatsDirty(channelIDs, modelIDs, apiKeyIDs []int) {
 		statsAPIKeyCacheNeedUpdate[id] = struct{}{}
 	}
 	statsAPIKeyCacheNeedUpdateLock.Unlock()
+
+	statsAPIKeyModelCacheNeedUpdateLock.Lock()
+	for _, id := range apiKeyModelIDs {
+		statsAPIKeyModelCacheNeedUpdate[id] = struct{}{}
+	}
+	statsAPIKeyModelCacheNeedUpdateLock.Unlock()
+
+	statsAPIKeyPeriodCacheNeedUpdateLock.Lock()
+	for _, id := range apiKeyPeriodIDs {
+		statsAPIKeyPeriodCacheNeedUpdate[id] = struct{}{}
+	}
+	statsAPIKeyPeriodCacheNeedUpdateLock.Unlock()
 }
 
 func persistStatsSnapshots(
@@ -124,8 +210,11 @@ func persistStatsSnapshots(
 	dailySnap model.StatsDaily,
 	hourlyAll [24]model.StatsHourly,
 	channelIDs []int,
+	channelKeyIDs []channelKeyStatsID,
 	modelIDs []int,
 	apiKeyIDs []int,
+	apiKeyModelIDs []apiKeyModelStatsID,
+	apiKeyPeriodIDs []apiKeyPeriodStatsID,
 ) error {
 	dbConn := db.GetDB().WithContext(ctx)
 
@@ -162,6 +251,16 @@ func persistStatsSnapshots(
 		}
 	}
 
+	for _, id := range channelKeyIDs {
+		key, ok := statsChannelKeyCache.Get(id)
+		if !ok {
+			continue
+		}
+		if result := dbConn.Save(&key); result.Error != nil {
+			return result.Error
+		}
+	}
+
 	for _, id := range modelIDs {
 		m, ok := statsModelCache.Get(id)
 		if !ok {
@@ -182,6 +281,26 @@ func persistStatsSnapshots(
 		}
 	}
 
+	for _, id := range apiKeyModelIDs {
+		m, ok := statsAPIKeyModelCache.Get(id)
+		if !ok {
+			continue
+		}
+		if result := dbConn.Save(&m); result.Error != nil {
+			return result.Error
+		}
+	}
+
+	for _, id := range apiKeyPeriodIDs {
+		period, ok := statsAPIKeyPeriodCache.Get(id)
+		if !ok {
+			continue
+		}
+		if result := dbConn.Save(&period); result.Error != nil {
+			return result.Error
+		}
+	}
+
 	return nil
 }
 
@@ -205,6 +324,14 @@ func statsSaveDBWithDailyOverride(ctx context.Context, dailyOverride model.Stats
 	statsChannelCacheNeedUpdate = make(map[int]struct{})
 	statsChannelCacheNeedUpdateLock.Unlock()
 
+	statsChannelKeyCacheNeedUpdateLock.Lock()
+	channelKeyIDs := make([]channelKeyStatsID, 0, len(statsChannelKeyCacheNeedUpdate))
+	for id := range statsChannelKeyCacheNeedUpdate {
+		channelKeyIDs = append(channelKeyIDs, id)
+	}
+	statsChannelKeyCacheNeedUpdate = make(map[channelKeyStatsID]struct{})
+	statsChannelKeyCacheNeedUpdateLock.Unlock()
+
 	statsModelCacheNeedUpdateLock.Lock()
 	modelIDs := make([]int, 0, len(statsModelCacheNeedUpdate))
 	for id := range statsModelCacheNeedUpdate {
@@ -221,8 +348,11 @@ func statsSaveDBWithDailyOverride(ctx context.Context, dailyOverride model.Stats
 	statsAPIKeyCacheNeedUpdate = make(map[int]struct{})
 	statsAPIKeyCacheNeedUpdateLock.Unlock()
 
-	if err := persistStatsSnapshots(ctx, totalSnap, dailyOverride, hourlyAll, channelIDs, modelIDs, apiKeyIDs); err != nil {
-		restoreStatsDirty(channelIDs, modelIDs, apiKeyIDs)
+	apiKeyModelIDs := takeAPIKeyModelDirty()
+	apiKeyPeriodIDs := takeAPIKeyPeriodDirty()
+
+	if err := persistStatsSnapshots(ctx, totalSnap, dailyOverride, hourlyAll, channelIDs, channelKeyIDs, modelIDs, apiKeyIDs, apiKeyModelIDs, apiKeyPeriodIDs); err != nil {
+		restoreStatsDirty(channelIDs, channelKeyIDs, modelIDs, apiKeyIDs, apiKeyModelIDs, apiKeyPeriodIDs)
 		return err
 	}
 	return nil
@@ -275,6 +405,52 @@ func StatsChannelUpdate(channelID int, metrics model.StatsMetrics) error {
 	return nil
 }
 
+// StatsChannelKeyUpdate 累加仍然存在的渠道凭据统计并标记为待持久化, keyID 为 0 表示渠道主凭据。
+func StatsChannelKeyUpdate(channelID, keyID int, metrics model.StatsMetrics) error {
+	statsChannelKeyCacheNeedUpdateLock.Lock()
+	defer statsChannelKeyCacheNeedUpdateLock.Unlock()
+	if _, ok := channelCache.Get(channelID); !ok {
+		return nil
+	}
+	id := channelKeyStatsID{channelID: channelID, keyID: keyID}
+	keyCache, ok := statsChannelKeyCache.Get(id)
+	if !ok {
+		keyCache = model.StatsChannelKey{
+			ChannelID: channelID,
+			KeyID:     keyID,
+		}
+	}
+	keyCache.StatsMetrics.Add(metrics)
+	statsChannelKeyCache.Set(id, keyCache)
+	statsChannelKeyCacheNeedUpdate[id] = struct{}{}
+	return nil
+}
+
+// StatsChannelKeyList 返回指定渠道已有统计的全部凭据统计, 按凭据 ID 升序排列。
+func StatsChannelKeyList(channelID int) []model.StatsChannelKey {
+	stats := make([]model.StatsChannelKey, 0)
+	for id, v := range statsChannelKeyCache.GetAll() {
+		if id.channelID == channelID {
+			stats = append(stats, v)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].KeyID < stats[j].KeyID })
+	return stats
+}
+
+// statsChannelKeyCacheDel 移除渠道凭据统计缓存, 未指定 keyIDs 时移除该渠道的全部凭据统计; 数据库记录由调用方删除。
+func statsChannelKeyCacheDel(channelID int, keyIDs ...int) {
+	statsChannelKeyCacheNeedUpdateLock.Lock()
+	defer statsChannelKeyCacheNeedUpdateLock.Unlock()
+	for id := range statsChannelKeyCache.GetAll() {
+		if id.channelID != channelID || (len(keyIDs) > 0 && !slices.Contains(keyIDs, id.keyID)) {
+			continue
+		}
+		statsChannelKeyCache.Del(id)
+		delete(statsChannelKeyCacheNeedUpdate, id)
+	}
+}
+
 func StatsHourlyUpdate(metrics model.StatsMetrics) error {
 	now := time.Now()
 	nowHour := now.Hour()
@@ -331,6 +507,12 @@ func StatsAPIKeyUpdate(apiKeyID int, metrics model.StatsMetrics) error {
 }
 
 func StatsAPIKeyDel(id int) error {
+	if err := statsAPIKeyModelDel(id); err != nil {
+		return err
+	}
+	if err := statsAPIKeyPeriodDel(id); err != nil {
+		return err
+	}
 	statsAPIKeyCacheNeedUpdateLock.Lock()
 	if _, ok := statsAPIKeyCache.Get(id); !ok {
 		statsAPIKeyCacheNeedUpdateLock.Unlock()
@@ -342,6 +524,137 @@ func StatsAPIKeyDel(id int) error {
 	return db.GetDB().Delete(&model.StatsAPIKey{}, id).Error
 }
 
+// StatsAPIKeyModelUpdate 累加 API Key 在指定模型上的统计并标记为待持久化, modelName 为客户端请求的模型名称, 即分组名称。
+func StatsAPIKeyModelUpdate(apiKeyID int, modelName string, metrics model.StatsMetrics) error {
+	statsAPIKeyModelCacheNeedUpdateLock.Lock()
+	defer statsAPIKeyModelCacheNeedUpdateLock.Unlock()
+	id := apiKeyModelStatsID{apiKeyID: apiKeyID, model: modelName}
+	stats, ok := statsAPIKeyModelCache.Get(id)
+	if !ok {
+		stats = model.StatsAPIKeyModel{
+			APIKeyID: apiKeyID,
+			Model:    modelName,
+		}
+	}
+	stats.StatsMetrics.Add(metrics)
+	statsAPIKeyModelCache.Set(id, stats)
+	statsAPIKeyModelCacheNeedUpdate[id] = struct{}{}
+	return nil
+}
+
+// StatsAPIKeyModelGet 返回 API Key 在指定模型上的统计, 尚无统计时返回零值。
+func StatsAPIKeyModelGet(apiKeyID int, modelName string) model.StatsAPIKeyModel {
+	if stats, ok := statsAPIKeyModelCache.Get(apiKeyModelStatsID{apiKeyID: apiKeyID, model: modelName}); ok {
+		return stats
+	}
+	return model.StatsAPIKeyModel{APIKeyID: apiKeyID, Model: modelName}
+}
+
+// StatsAPIKeyModelList 返回 API Key 已有统计的全部模型统计, 按模型名称排列。
+func StatsAPIKeyModelList(apiKeyID int) []model.StatsAPIKeyModel {
+	stats := make([]model.StatsAPIKeyModel, 0)
+	for id, v := range statsAPIKeyModelCache.GetAll() {
+		if id.apiKeyID == apiKeyID {
+			stats = append(stats, v)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Model < stats[j].Model })
+	return stats
+}
+
+// statsAPIKeyModelDel 移除 API Key 全部模型统计的缓存与数据库记录。
+func statsAPIKeyModelDel(apiKeyID int) error {
+	statsAPIKeyModelCacheNeedUpdateLock.Lock()
+	for id := range statsAPIKeyModelCache.GetAll() {
+		if id.apiKeyID == apiKeyID {
+			statsAPIKeyModelCache.Del(id)
+			delete(statsAPIKeyModelCacheNeedUpdate, id)
+		}
+	}
+	statsAPIKeyModelCacheNeedUpdateLock.Unlock()
+	return db.GetDB().Where("api_key_id = ?", apiKeyID).Delete(&model.StatsAPIKeyModel{}).Error
+}
+
+// StatsAPIKeyPeriodUpdate 把用量累加到 API Key 当前预算周期的统计并标记为待持久化, 未启用周期预算的 API Key 不记录。
+// 只访问缓存, 调用方需先以 StatsAPIKeyPeriodLoad 载入当前周期; 周期尚未载入时返回错误, 本次用量不计入周期统计。
+func StatsAPIKeyPeriodUpdate(apiKeyID int, metrics model.StatsMetrics) error {
+	apiKey, ok := apiKeyCache.Get(apiKeyID)
+	if !ok || apiKey.BudgetPeriod == "" {
+		return nil
+	}
+	id := apiKeyPeriodStatsIDOf(apiKey, time.Now())
+	statsAPIKeyPeriodCacheNeedUpdateLock.Lock()
+	defer statsAPIKeyPeriodCacheNeedUpdateLock.Unlock()
+	stats, ok := statsAPIKeyPeriodCache.Get(id)
+	if !ok {
+		return fmt.Errorf("api key %d period stats starting %s not loaded", apiKeyID, id.start)
+	}
+	stats.StatsMetrics.Add(metrics)
+	statsAPIKeyPeriodCache.Set(id, stats)
+	statsAPIKeyPeriodCacheNeedUpdate[id] = struct{}{}
+	return nil
+}
+
+// StatsAPIKeyPeriodLoad 载入 API Key 当前预算周期的统计, 周期轮换时从数据库读取新周期; 未启用周期预算的 API Key 不处理。
+// 未命中缓存时会访问数据库, 应在持有请求状态锁之前调用。
+func StatsAPIKeyPeriodLoad(apiKeyID int) error {
+	apiKey, ok := apiKeyCache.Get(apiKeyID)
+	if !ok {
+		return nil
+	}
+	_, err := StatsAPIKeyPeriodGet(apiKey)
+	return err
+}
+
+// StatsAPIKeyPeriodGet 返回 API Key 当前预算周期的统计, 未启用周期预算时返回零值。
+func StatsAPIKeyPeriodGet(apiKey model.APIKey) (model.StatsAPIKeyPeriod, error) {
+	if apiKey.BudgetPeriod == "" {
+		return model.StatsAPIKeyPeriod{}, nil
+	}
+	statsAPIKeyPeriodCacheNeedUpdateLock.Lock()
+	defer statsAPIKeyPeriodCacheNeedUpdateLock.Unlock()
+	return statsAPIKeyPeriodLoadLocked(apiKey, time.Now())
+}
+
+// apiKeyPeriodStatsIDOf 返回 now 所在预算周期的统计键。
+func apiKeyPeriodStatsIDOf(apiKey model.APIKey, now time.Time) apiKeyPeriodStatsID {
+	start, _ := apiKey.BudgetWindow(now)
+	return apiKeyPeriodStatsID{apiKeyID: apiKey.ID, period: apiKey.BudgetPeriod, start: start.Format("20060102")}
+}
+
+// statsAPIKeyPeriodLoadLocked 返回 now 所在预算周期的统计: 缓存未命中时从数据库读取, 新周期从零开始, 并移除该 API Key 已持久化的其他周期缓存; 调用方必须持有锁。
+func statsAPIKeyPeriodLoadLocked(apiKey model.APIKey, now time.Time) (model.StatsAPIKeyPeriod, error) {
+	id := apiKeyPeriodStatsIDOf(apiKey, now)
+	if stats, ok := statsAPIKeyPeriodCache.Get(id); ok {
+		return stats, nil
+	}
+	stats := model.StatsAPIKeyPeriod{APIKeyID: id.apiKeyID, Period: id.period, Start: id.start}
+	result := db.GetDB().Where("api_key_id = ? AND period = ? AND start = ?", id.apiKeyID, id.period, id.start).Limit(1).Find(&stats)
+	if result.Error != nil {
+		return model.StatsAPIKeyPeriod{}, fmt.Errorf("failed to get api key period stats: %w", result.Error)
+	}
+	for cached := range statsAPIKeyPeriodCache.GetAll() {
+		if _, dirty := statsAPIKeyPeriodCacheNeedUpdate[cached]; cached.apiKeyID == apiKey.ID && !dirty {
+			statsAPIKeyPeriodCache.Del(cached)
+		}
+	}
+	statsAPIKeyPeriodCache.Set(id, stats)
+	return stats, nil
+}
+
+// statsAPIKeyPeriodDel 移除 API Key 全部周期统计的缓存与数据库记录。
+func statsAPIKeyPeriodDel(apiKeyID int) error {
+	statsAPIKeyPeriodCacheNeedUpdateLock.Lock()
+	for id := range statsAPIKeyPeriodCache.GetAll() {
+		if id.apiKeyID == apiKeyID {
+			statsAPIKeyPeriodCache.Del(id)
+			delete(statsAPIKeyPeriodCacheNeedUpdate, id)
+		}
+	}
+	statsAPIKeyPeriodCacheNeedUpdateLock.Unlock()
+	return db.GetDB().Where("api_key_id = ?", apiKeyID).Delete(&model.StatsAPIKeyPeriod{}).Error
+}
+
 func StatsTotalGet() model.StatsTotal {
 	statsTotalCacheLock.RLock()
 	defer statsTotalCacheLock.RUnlock()
@@ -483,6 +796,20 @@ func statsRefreshCache(ctx context.Context) error {
 		statsChannelCache.Set(v.ChannelID, v)
 	}
 
+	var loadedChannelKeys []model.StatsChannelKey
+	result = dbConn.Find(&loadedChannelKeys)
+	if result.Error != nil {
+		return fmt.Errorf("failed to get channel key stats: %v", result.Error)
+	}
+
+	statsChannelKeyCache.Clear()
+	statsChannelKeyCacheNeedUpdateLock.Lock()
+	statsChannelKeyCacheNeedUpdate = make(map[channelKeyStatsID]struct{})
+	statsChannelKeyCacheNeedUpdateLock.Unlock()
+	for _, v := range loadedChannelKeys {
+		statsChannelKeyCache.Set(channelKeyStatsID{channelID: v.ChannelID, keyID: v.KeyID}, v)
+	}
+
 	var loadedAPIKeys []model.StatsAPIKey
 	result = dbConn.Find(&loadedAPIKeys)
 	if result.Error != nil {
@@ -497,6 +824,26 @@ func statsRefreshCache(ctx context.Context) error {
 		statsAPIKeyCache.Set(v.APIKeyID, v)
 	}
 
+	var loadedAPIKeyModels []model.StatsAPIKeyModel
+	result = dbConn.Find(&loadedAPIKeyModels)
+	if result.Error != nil {
+		return fmt.Errorf("failed to get api key model stats: %v", result.Error)
+	}
+
+	statsAPIKeyModelCache.Clear()
+	statsAPIKeyModelCacheNeedUpdateLock.Lock()
+	statsAPIKeyModelCacheNeedUpdate = make(map[apiKeyModelStatsID]struct{})
+	statsAPIKeyModelCacheNeedUpdateLock.Unlock()
+	for _, v := range loadedAPIKeyModels {
+		statsAPIKeyModelCache.Set(apiKeyModelStatsID{apiKeyID: v.APIKeyID, model: v.Model}, v)
+	}
+
+	// 周期统计按需从数据库读取当前周期, 此处只清空缓存。
+	statsAPIKeyPeriodCache.Clear()
+	statsAPIKeyPeriodCacheNeedUpdateLock.Lock()
+	statsAPIKeyPeriodCacheNeedUpdate = make(map[apiKeyPeriodStatsID]struct{})
+	statsAPIKeyPeriodCacheNeedUpdateLock.Unlock()
+
 	statsHourlyCacheLock.Lock()
 	statsHourlyCache = [24]model.StatsHourly{}
 	for _, v := range loadedHourly {
@@ -0,0 +1,62 @@
+package op
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+)
+
+func TestStatsAPIKeyPeriodRollover(t *testing.T) {
+	ctx := context.Background()
+	apiKey := model.APIKey{Name: "period", APIKey: "sk-test-period", Enabled: true, BudgetPeriod: model.BudgetPeriodDaily, BudgetCost: 10}
+	if err := APIKeyCreate(&apiKey, ctx); err != nil {
+		t.Fatalf("APIKeyCreate() error = %v", err)
+	}
+
+	// 累加只访问缓存, 当前周期尚未载入时报告错误而不读取数据库。
+	if err := StatsAPIKeyPeriodUpdate(apiKey.ID, model.StatsMetrics{InputCost: 1}); err == nil {
+		t.Fatal("StatsAPIKeyPeriodUpdate() before load succeeded")
+	}
+	if err := StatsAPIKeyPeriodLoad(apiKey.ID); err != nil {
+		t.Fatalf("StatsAPIKeyPeriodLoad() error = %v", err)
+	}
+	if err := StatsAPIKeyPeriodUpdate(apiKey.ID, model.StatsMetrics{InputCost: 3, OutputCost: 4}); err != nil {
+		t.Fatalf("StatsAPIKeyPeriodUpdate() error = %v", err)
+	}
+	current, err := StatsAPIKeyPeriodGet(apiKey)
+	if err != nil {
+		t.Fatalf("StatsAPIKeyPeriodGet() error = %v", err)
+	}
+	if spent := current.StatsMetrics.InputCost + current.StatsMetrics.OutputCost; spent != 7 {
+		t.Errorf("spent = %v, want 7", spent)
+	}
+
+	// 持久化后进入下一周期, 已用费用从零开始, 上一周期的记录保留在数据库中。
+	if err := StatsSaveDB(ctx); err != nil {
+		t.Fatalf("StatsSaveDB() error = %v", err)
+	}
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	statsAPIKeyPeriodCacheNeedUpdateLock.Lock()
+	next, err := statsAPIKeyPeriodLoadLocked(apiKey, tomorrow)
+	statsAPIKeyPeriodCacheNeedUpdateLock.Unlock()
+	if err != nil {
+		t.Fatalf("load next period error = %v", err)
+	}
+	if next.Start == current.Start {
+		t.Fatalf("next period starts %s, same as current", next.Start)
+	}
+	if spent := next.StatsMetrics.InputCost + next.StatsMetrics.OutputCost; spent != 0 {
+		t.Errorf("next period spent = %v, want 0", spent)
+	}
+
+	// 回到当前周期时从数据库重新读取已持久化的费用。
+	reloaded, err := StatsAPIKeyPeriodGet(apiKey)
+	if err != nil {
+		t.Fatalf("StatsAPIKeyPeriodGet() error = %v", err)
+	}
+	if spent := reloaded.StatsMetrics.InputCost + reloaded.StatsMetrics.OutputCost; spent != 7 {
+		t.Errorf("reloaded spent = %v, want 7", spent)
+	}
+}
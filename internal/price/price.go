@@ -175,7 +175,7 @@ func GetLLMPrice(modelName string) *model.LLMPrice {
 				matchedModelID = modelID
 				matchedSegmentCount = len(modelIDSegments)
 				ambiguous = false
-			} else if len(modelIDSegments) == matchedSegmentCount && llmPrice[matchedModelID] != price {
+			} else if len(modelIDSegments) == matchedSegmentCount && !llmPrice[matchedModelID].Equal(price) {
 				ambiguous = true
 			}
 			break
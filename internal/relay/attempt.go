@@ -0,0 +1,136 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/op"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+	"github.com/tidwall/sjson"
+)
+
+// errHedgeLost 是对冲中落后一方被取消的原因, 该轮不计为成员故障。
+var errHedgeLost = errors.New("hedged round lost to a faster round")
+
+// attempt 是一轮在独立 goroutine 中请求上游的尝试; 对冲时同一请求可能同时存在两轮, 各自持有独立的上下文、计时器和请求副本。
+type attempt struct {
+	item      model.GroupItem         // 本轮目标成员。
+	channel   model.Channel           // 本轮目标渠道。
+	key       *channelKey             // 本轮使用的渠道凭据, 全部凭据冷却而未请求上游时为 nil; 投递前只由本轮 goroutine 写入。
+	round     int                     // 本轮在请求状态中的轮次序号。
+	ctx       context.Context         // 本轮上游调用的上下文。
+	cancel    context.CancelCauseFunc // 以指定原因结束本轮。
+	timeout   *roundTimeoutError      // 本轮适用的首个有效响应时限。
+	startedAt time.Time               // 本轮上游调用的开始时间, 用于统计首个有效响应耗时。
+	result    *upstreamResponse       // 本轮取得的可提交响应, 失败时为 nil。
+	err       error                   // 本轮失败原因。
+}
+
+// roundRequest 复制客户端请求并写入成员配置的真实模型; 每轮持有独立副本, 对冲的并发轮次互不干扰。
+func roundRequest(raw *httpclient.Request, format llm.APIFormat, modelName string, streaming bool) (*httpclient.Request, error) {
+	request := *raw
+	request.Headers = raw.Headers.Clone()
+	if format == llm.APIFormatGeminiContents {
+		request.URL = setGeminiModel(raw.URL, modelName)
+		return &request, nil
+	}
+	if isMultipart(raw.Headers) {
+		body, err := setMultipartValue(raw.Headers, raw.Body, "model", modelName)
+		if err != nil {
+			return nil, err
+		}
+		request.Body = body
+		return &request, nil
+	}
+	body, err := sjson.SetBytes(raw.Body, "model", modelName)
+	if err != nil {
+		return nil, err
+	}
+	// OpenAI Chat 与文本补全的流式响应需显式要求上游在末尾附带用量。
+	if streaming && (format == llm.APIFormatOpenAIChatCompletion || format == APIFormatOpenAICompletion) {
+		body, err = sjson.SetBytes(body, "stream_options.include_usage", true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	request.Body = body
+	return &request, nil
+}
+
+// startAttempt 登记一轮上游请求并在后台发送, 取得首个有效响应或失败后把本轮投递到 done, 返回的尝试在投递前只可用于取消。
+// 人工中止以普通取消结束本轮, 超时以超时原因结束本轮; 首个有效响应必须在分组配置的时限内取得: 非流式为完整响应, 流式为首个有效事件。
+// 本轮占用渠道的并发与每分钟请求数名额直至本轮上下文结束; 渠道在选中后已被其他请求占满时不登记本轮并返回 nil。
+func startAttempt(ctx context.Context, request *RequestState, format llm.APIFormat, raw *httpclient.Request, group model.Group, item model.GroupItem, channel model.Channel, streaming, hedge bool, done chan<- *attempt) *attempt {
+	roundCtx, cancelRound := context.WithCancelCause(ctx)
+	if !acquireChannelSlot(roundCtx, channel) {
+		cancelRound(nil)
+		return nil
+	}
+	a := &attempt{
+		item:      item,
+		channel:   channel,
+		ctx:       roundCtx,
+		cancel:    cancelRound,
+		timeout:   newRoundTimeout(group.RelayConfig, streaming),
+		startedAt: time.Now(),
+	}
+	a.round = request.startRound(func() { cancelRound(context.Canceled) }, channel, item.ModelName, hedge)
+	timer := time.AfterFunc(a.timeout.timeout, func() { cancelRound(a.timeout) })
+
+	go func() {
+		// 按渠道的凭据策略选出本轮凭据, 全部凭据冷却时不再请求上游。
+		var result *upstreamResponse
+		key, err := pickChannelKey(channel)
+		if err == nil {
+			a.key = &key
+			channel.Key = key.value
+			result, err = sendRound(roundCtx, format, raw, channel, streaming)
+		}
+		// 计时器已经触发说明本轮超时; 即使随后取得了响应, 其上下文也已被取消而无法继续读取, 同样按超时失败处理。
+		if !timer.Stop() {
+			if err == nil {
+				result.close()
+			}
+			result, err = nil, a.timeout
+		}
+		a.result, a.err = result, err
+		done <- a
+	}()
+	return a
+}
+
+// interrupted 判断失败的本轮是否由人工中止: 仅本轮上下文结束且并非超时, 调用方须先排除客户端取消。
+func (a *attempt) interrupted() bool {
+	return a.ctx.Err() != nil && !errors.Is(a.err, a.timeout)
+}
+
+// abandonAttempts 在后台等待 n 个已被取消的对冲轮次结束, 归还其资源并把各自的耗时与用量计入所属渠道和成员。
+// 落后轮次不计入路由失败, 其上游调用可能已经产生费用, 故仍按实际结果记入渠道统计。
+func abandonAttempts(request *RequestState, group model.Group, done <-chan *attempt, n int) {
+	for range n {
+		a := <-done
+		request.abandonRound(a.round)
+		releaseRouteProbe(group, a.item.ID)
+		metrics := model.StatsMetrics{RequestFailed: 1}
+		if a.err == nil {
+			a.result.close()
+			metrics = usageMetrics(a.channel.ID, a.item.ModelName, a.result.usage, a.result.units)
+			metrics.RequestSuccess = 1
+		}
+		a.cancel(nil)
+		metrics.WaitTime = time.Since(a.startedAt).Milliseconds()
+		a.recordStats(metrics)
+	}
+}
+
+// recordStats 将本轮结果计入所属渠道, 所用凭据和成员模型的统计。
+func (a *attempt) recordStats(metrics model.StatsMetrics) {
+	_ = op.StatsChannelUpdate(a.channel.ID, metrics)
+	if a.key != nil {
+		_ = op.StatsChannelKeyUpdate(a.channel.ID, a.key.id, metrics)
+	}
+	_ = op.StatsModelUpdate(model.StatsModel{ID: a.item.ID, Name: a.item.ModelName, ChannelID: a.channel.ID, StatsMetrics: metrics})
+}
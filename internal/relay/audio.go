@@ -0,0 +1,113 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+const (
+	// APIFormatOpenAIAudioTranscription 是 OpenAI 语音转写接口的客户端协议, 请求体为上传音频文件的 multipart 表单。
+	APIFormatOpenAIAudioTranscription llm.APIFormat = "openai/audio_transcription"
+	// APIFormatOpenAIAudioSpeech 是 OpenAI 语音合成接口的客户端协议, 响应体为音频二进制流。
+	APIFormatOpenAIAudioSpeech llm.APIFormat = "openai/audio_speech"
+)
+
+// transcriptionResponse 是语音转写 JSON 响应中计费所需的字段; text, srt 等文本格式的响应不含用量。
+type transcriptionResponse struct {
+	Duration float64 `json:"duration"` // verbose_json 格式给出的音频时长, 单位为秒。
+	Usage    *struct {
+		Type         string  `json:"type"`          // 用量类型, duration 按时长计费, tokens 按 Token 计费。
+		Seconds      float64 `json:"seconds"`       // 按时长计费时的音频秒数。
+		InputTokens  int64   `json:"input_tokens"`  // 按 Token 计费时的输入 Token 数。
+		OutputTokens int64   `json:"output_tokens"` // 按 Token 计费时的输出 Token 数。
+	} `json:"usage"`
+}
+
+// sendAudio 以同协议透传方式请求渠道的语音接口, 目前只有 OpenAI 兼容渠道支持。
+func sendAudio(ctx context.Context, format llm.APIFormat, raw *httpclient.Request, channel model.Channel) (*upstreamResponse, error) {
+	if !openAICompatible(channel.Type) {
+		return nil, fmt.Errorf("channel provider %s does not support %s", channel.Type, format)
+	}
+	request, err := buildPassthroughRequest(format, raw, channel)
+	if err != nil {
+		return nil, err
+	}
+	if format == APIFormatOpenAIAudioSpeech {
+		return sendSpeech(ctx, raw, request, channel)
+	}
+	return sendTranscription(ctx, request, channel)
+}
+
+// sendTranscription 请求语音转写并按上游给出的音频时长或 Token 用量计费; 文本格式的响应无法取得用量, 只计次数不计费用。
+func sendTranscription(ctx context.Context, request *httpclient.Request, channel model.Channel) (*upstreamResponse, error) {
+	response, err := doUnaryRequest(ctx, request, channel)
+	if err != nil {
+		return nil, err
+	}
+	result := &upstreamResponse{body: slices.Clone(response.Body), header: response.Headers.Clone()}
+
+	var parsed transcriptionResponse
+	if json.Unmarshal(response.Body, &parsed) != nil {
+		return result, nil
+	}
+	result.units.audioSeconds = parsed.Duration
+	if parsed.Usage != nil {
+		switch parsed.Usage.Type {
+		case "duration":
+			result.units.audioSeconds = parsed.Usage.Seconds
+		case "tokens":
+			result.usage = &llm.Usage{
+				PromptTokens:     parsed.Usage.InputTokens,
+				CompletionTokens: parsed.Usage.OutputTokens,
+				TotalTokens:      parsed.Usage.InputTokens + parsed.Usage.OutputTokens,
+			}
+		}
+	}
+	return result, nil
+}
+
+// sendSpeech 请求语音合成并在取得成功响应头后立即返回, 音频正文留给提交阶段边读边写给客户端。
+// 费用按请求文本的字符数计算, 与响应内容无关; 首个有效响应的时限只约束响应头的到达。
+func sendSpeech(ctx context.Context, raw *httpclient.Request, request *httpclient.Request, channel model.Channel) (*upstreamResponse, error) {
+	var speech struct {
+		Input string `json:"input"` // 待合成的文本。
+	}
+	if err := json.Unmarshal(raw.Body, &speech); err != nil {
+		return nil, err
+	}
+
+	client, err := channelHTTPClient(channel)
+	if err != nil {
+		return nil, err
+	}
+	rawRequest, err := httpclient.BuildHttpRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(rawRequest)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		failure, readErr := io.ReadAll(response.Body)
+		response.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		return nil, &upstreamError{status: response.StatusCode, body: failure, retryAfter: parseRetryAfter(response.Header), err: fmt.Errorf("upstream responded %s", response.Status)}
+	}
+	return &upstreamResponse{
+		header: response.Header.Clone(),
+		stream: response.Body,
+		units:  unitUsage{characters: int64(utf8.RuneCountInString(speech.Input))},
+	}, nil
+}
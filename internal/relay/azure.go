@@ -0,0 +1,62 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+// azureDeployment 返回模型在 Azure 渠道上的部署名称, 未配置映射时部署名称即模型名称。
+func azureDeployment(channel model.Channel, modelName string) string {
+	if deployment := channel.Deployments[modelName]; deployment != "" {
+		return deployment
+	}
+	return modelName
+}
+
+// azureRequestURL 返回 Azure 渠道上模型部署的接口地址; Azure 的接口路径不带 /v1 版本号, 版本由 api-version 参数决定。
+func azureRequestURL(channel model.Channel, format llm.APIFormat, modelName string) string {
+	base := strings.TrimRight(strings.TrimSuffix(channel.BaseURL, "##"), "/")
+	return base + "/openai/deployments/" + url.PathEscape(azureDeployment(channel, modelName)) + upstreamPath(format) +
+		"?api-version=" + url.QueryEscape(channel.AzureAPIVersion())
+}
+
+// azureAuth 返回 Azure 渠道的认证配置, Azure 以 api-key 请求头而不是 Bearer 令牌认证。
+func azureAuth(channel model.Channel) *httpclient.AuthConfig {
+	return &httpclient.AuthConfig{Type: httpclient.AuthTypeAPIKey, APIKey: channel.Key, HeaderKey: "api-key"}
+}
+
+// requestModel 返回上游请求体中的模型名称, 支持 JSON 与 multipart 表单请求体。
+func requestModel(request *httpclient.Request) (string, error) {
+	if isMultipart(request.Headers) {
+		return multipartValue(request.Headers, request.Body, "model")
+	}
+	var metadata struct {
+		Model string `json:"model"` // 上游请求的模型名称。
+	}
+	if err := json.Unmarshal(request.Body, &metadata); err != nil {
+		return "", err
+	}
+	return metadata.Model, nil
+}
+
+// rewriteAzureRequest 把按 OpenAI 协议转换得到的上游请求改写为 Azure 部署地址和 api-key 认证。
+func rewriteAzureRequest(channel model.Channel, request *httpclient.Request) error {
+	modelName, err := requestModel(request)
+	if err != nil {
+		return err
+	}
+	request.URL = azureRequestURL(channel, llm.APIFormatOpenAIChatCompletion, modelName)
+	if request.Headers == nil {
+		request.Headers = http.Header{}
+	}
+	request.Headers.Del("Authorization")
+	request.Headers.Set("api-key", channel.Key)
+	request.Auth = azureAuth(channel)
+	return nil
+}
@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+func TestAzureRequestURL(t *testing.T) {
+	deployments := map[string]string{"gpt-4o": "prod-4o"}
+	tests := []struct {
+		name    string
+		channel model.Channel
+		format  llm.APIFormat
+		model   string
+		want    string
+	}{
+		{"mapped deployment", model.Channel{BaseURL: "https://res.openai.azure.com", Deployments: deployments}, llm.APIFormatOpenAIChatCompletion, "gpt-4o",
+			"https://res.openai.azure.com/openai/deployments/prod-4o/chat/completions?api-version=2024-10-21"},
+		{"unmapped model is the deployment", model.Channel{BaseURL: "https://res.openai.azure.com", Deployments: deployments}, llm.APIFormatOpenAIChatCompletion, "gpt-4o-mini",
+			"https://res.openai.azure.com/openai/deployments/gpt-4o-mini/chat/completions?api-version=2024-10-21"},
+		{"trailing slash", model.Channel{BaseURL: "https://res.openai.azure.com/"}, llm.APIFormatOpenAIEmbedding, "text-embedding-3-small",
+			"https://res.openai.azure.com/openai/deployments/text-embedding-3-small/embeddings?api-version=2024-10-21"},
+		{"raw marker and trailing slash", model.Channel{BaseURL: "https://res.openai.azure.com/##"}, llm.APIFormatOpenAIResponse, "o3",
+			"https://res.openai.azure.com/openai/deployments/o3/responses?api-version=2024-10-21"},
+		{"configured version", model.Channel{BaseURL: "https://res.openai.azure.com", APIVersion: "2025-04-01-preview"}, llm.APIFormatOpenAIImageGeneration, "gpt-image-1",
+			"https://res.openai.azure.com/openai/deployments/gpt-image-1/images/generations?api-version=2025-04-01-preview"},
+		{"deployment escaped", model.Channel{BaseURL: "https://res.openai.azure.com", Deployments: map[string]string{"m": "team a/m"}}, llm.APIFormatOpenAIChatCompletion, "m",
+			"https://res.openai.azure.com/openai/deployments/team%20a%2Fm/chat/completions?api-version=2024-10-21"},
+	}
+	for _, tt := range tests {
+		if got := azureRequestURL(tt.channel, tt.format, tt.model); got != tt.want {
+			t.Errorf("%s: azureRequestURL() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteAzureRequest(t *testing.T) {
+	channel := model.Channel{BaseURL: "https://res.openai.azure.com##", Key: "azure-key", Deployments: map[string]string{"gpt-4o": "prod-4o"}}
+	tests := []struct {
+		name    string
+		request *httpclient.Request
+		want    string
+	}{
+		{"mapped deployment", &httpclient.Request{
+			URL:     "https://res.openai.azure.com/v1/chat/completions",
+			Headers: http.Header{"Authorization": {"Bearer azure-key"}, "Content-Type": {"application/json"}},
+			Body:    []byte(`{"model":"gpt-4o"}`),
+			Auth:    &httpclient.AuthConfig{Type: httpclient.AuthTypeBearer, APIKey: "azure-key"},
+		}, "https://res.openai.azure.com/openai/deployments/prod-4o/chat/completions?api-version=2024-10-21"},
+		{"unmapped model without headers", &httpclient.Request{
+			URL:  "https://res.openai.azure.com/v1/chat/completions",
+			Body: []byte(`{"model":"gpt-4o-mini"}`),
+		}, "https://res.openai.azure.com/openai/deployments/gpt-4o-mini/chat/completions?api-version=2024-10-21"},
+	}
+	for _, tt := range tests {
+		if err := rewriteAzureRequest(channel, tt.request); err != nil {
+			t.Errorf("%s: rewriteAzureRequest() error = %v", tt.name, err)
+			continue
+		}
+		if tt.request.URL != tt.want {
+			t.Errorf("%s: URL = %q, want %q", tt.name, tt.request.URL, tt.want)
+		}
+		if got := tt.request.Headers.Get("Authorization"); got != "" {
+			t.Errorf("%s: Authorization = %q, want removed", tt.name, got)
+		}
+		if got := tt.request.Headers.Get("api-key"); got != "azure-key" {
+			t.Errorf("%s: api-key = %q, want the channel key", tt.name, got)
+		}
+		if auth := tt.request.Auth; auth == nil || auth.Type != httpclient.AuthTypeAPIKey || auth.HeaderKey != "api-key" || auth.APIKey != "azure-key" {
+			t.Errorf("%s: Auth = %+v, want api-key header auth", tt.name, auth)
+		}
+	}
+	if err := rewriteAzureRequest(channel, &httpclient.Request{Body: []byte(`not json`)}); err == nil {
+		t.Error("rewriteAzureRequest() on invalid body succeeded")
+	}
+}
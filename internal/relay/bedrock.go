@@ -0,0 +1,304 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/helper"
+	"github.com/bestruirui/octopus/internal/model"
+)
+
+const (
+	bedrockAnthropicVersion = "bedrock-2023-05-31" // Bedrock 上 Anthropic 模型要求的请求体 anthropic_version。
+	bedrockMaxFrameSize     = 16 << 20             // 单个 event-stream 帧允许的最大字节数, 防止损坏的长度字段导致过量分配。
+)
+
+// bedrockTransport 把 Anthropic Messages 请求改写为 Bedrock 的 invoke 或 invoke-with-response-stream 请求并以 SigV4 签名,
+// 流式响应的 AWS event-stream 帧解码为 Anthropic SSE 事件。透传与跨协议转换都按 Anthropic 协议构造请求, 只在发出前改写; 只支持 Anthropic 模型, 其他模型家族在发出前拒绝。
+type bedrockTransport struct {
+	base        http.RoundTripper     // 实际发送请求的传输层。
+	channel     model.Channel         // 本轮请求的 Bedrock 渠道, Key 为本轮选中的凭据。
+	credentials helper.AWSCredentials // 由本轮凭据解析得到的访问密钥。
+}
+
+func (t *bedrockTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(request.URL.Path, "/messages") {
+		return nil, fmt.Errorf("bedrock channels only support anthropic messages, got %s", request.URL.Path)
+	}
+	body, err := readRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+	payload, modelID, streaming, err := anthropicPlatformPayload(body, request.Header, bedrockAnthropicVersion)
+	if err != nil {
+		return nil, err
+	}
+	// 其他模型家族的 invoke 请求体与 Anthropic 不兼容, 在发出前明确拒绝, 不让上游返回难以理解的参数错误。
+	if !helper.BedrockAnthropicModel(modelID) {
+		return nil, fmt.Errorf("bedrock channels only support anthropic models, got %s", modelID)
+	}
+	// Bedrock 的流式方式由地址决定, 请求体不接受 stream 字段。
+	delete(payload, "stream")
+	body, err = json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	action, accept := "invoke", "application/json"
+	if streaming {
+		action, accept = "invoke-with-response-stream", "application/vnd.amazon.eventstream"
+	}
+	target, err := url.Parse(helper.BedrockRuntimeURL(t.channel) + "/model/" + helper.AWSPathEscape(modelID) + "/" + action)
+	if err != nil {
+		return nil, err
+	}
+
+	outbound := request.Clone(request.Context())
+	outbound.URL = target
+	outbound.Host = ""
+	outbound.Body = io.NopCloser(bytes.NewReader(body))
+	outbound.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	outbound.ContentLength = int64(len(body))
+	for _, name := range []string{"Authorization", "X-Api-Key", "Anthropic-Version", "Anthropic-Beta"} {
+		outbound.Header.Del(name)
+	}
+	outbound.Header.Set("Content-Type", "application/json")
+	outbound.Header.Set("Accept", accept)
+	helper.SignAWSRequest(outbound, body, t.credentials, t.channel.Region, "bedrock", time.Now())
+
+	response, err := t.base.RoundTrip(outbound)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case response.StatusCode >= http.StatusBadRequest:
+		return bedrockErrorResponse(response)
+	case streaming && strings.HasPrefix(response.Header.Get("Content-Type"), "application/vnd.amazon.eventstream"):
+		response.Body = newEventStreamReader(response.Body)
+		response.Header.Set("Content-Type", "text/event-stream")
+		response.Header.Del("Content-Length")
+		response.ContentLength = -1
+	}
+	return response, nil
+}
+
+// anthropicPlatformPayload 解析发往云平台的 Anthropic Messages 请求体, 返回去掉 model 字段后的请求体字段, 模型和是否流式。
+// 云平台的模型由地址决定; 平台要求的 anthropic_version 和请求头中的 beta 特性写入请求体。
+func anthropicPlatformPayload(body []byte, header http.Header, version string) (map[string]json.RawMessage, string, bool, error) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, "", false, fmt.Errorf("decode anthropic request: %w", err)
+	}
+	var modelID string
+	if err := json.Unmarshal(payload["model"], &modelID); err != nil || modelID == "" {
+		return nil, "", false, errors.New("anthropic request requires a model")
+	}
+	var streaming bool
+	if raw, ok := payload["stream"]; ok {
+		streaming, _ = strconv.ParseBool(string(raw))
+	}
+	delete(payload, "model")
+	if _, ok := payload["anthropic_version"]; !ok {
+		payload["anthropic_version"] = json.RawMessage(strconv.Quote(version))
+	}
+	if beta := header.Values("Anthropic-Beta"); len(beta) > 0 {
+		if _, ok := payload["anthropic_beta"]; !ok {
+			var features []string
+			for _, value := range beta {
+				for _, feature := range strings.Split(value, ",") {
+					if feature = strings.TrimSpace(feature); feature != "" {
+						features = append(features, feature)
+					}
+				}
+			}
+			if encoded, err := json.Marshal(features); err == nil {
+				payload["anthropic_beta"] = encoded
+			}
+		}
+	}
+	return payload, modelID, streaming, nil
+}
+
+// bedrockErrorResponse 把 Bedrock 的错误响应体改写为 Anthropic 错误格式, 状态码和其余响应头保持不变。
+func bedrockErrorResponse(response *http.Response) (*http.Response, error) {
+	body, err := readResponseBody(response)
+	if err != nil {
+		return nil, err
+	}
+	var failure struct {
+		Message string `json:"message"` // Bedrock 给出的错误说明。
+	}
+	if json.Unmarshal(body, &failure) != nil || failure.Message == "" {
+		failure.Message = string(body)
+	}
+	errorType, _, _ := strings.Cut(response.Header.Get("X-Amzn-Errortype"), ":")
+	setResponseBody(response, anthropicErrorBody(errorType, failure.Message))
+	return response, nil
+}
+
+// anthropicErrorBody 返回 Anthropic 格式的错误正文。
+func anthropicErrorBody(errorType, message string) []byte {
+	if errorType == "" {
+		errorType = "api_error"
+	}
+	body, _ := json.Marshal(map[string]any{
+		"type":  "error",
+		"error": map[string]string{"type": errorType, "message": message},
+	})
+	return body
+}
+
+// eventStreamReader 把 AWS event-stream 二进制帧逐帧解码为 SSE 文本: chunk 事件中 base64 编码的 Anthropic 事件原样成为一个 SSE 事件,
+// 异常帧转换为 Anthropic error 事件。
+type eventStreamReader struct {
+	source  io.ReadCloser // 上游响应正文。
+	reader  *bufio.Reader // 带缓冲的上游正文读取器。
+	pending bytes.Buffer  // 已解码尚未读出的 SSE 文本。
+	err     error         // 读取或解码上游帧时的终止错误, 读完 pending 后返回。
+}
+
+func newEventStreamReader(source io.ReadCloser) *eventStreamReader {
+	return &eventStreamReader{source: source, reader: bufio.NewReader(source)}
+}
+
+func (r *eventStreamReader) Read(p []byte) (int, error) {
+	for r.pending.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.decodeFrame()
+	}
+	return r.pending.Read(p)
+}
+
+func (r *eventStreamReader) Close() error {
+	return r.source.Close()
+}
+
+// decodeFrame 读取并校验一个完整帧, 把其中的事件以 SSE 格式写入 pending; 帧边界处的 EOF 表示流正常结束。
+func (r *eventStreamReader) decodeFrame() error {
+	prelude := make([]byte, 12)
+	if _, err := io.ReadFull(r.reader, prelude); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return errors.New("bedrock event stream truncated")
+		}
+		return err
+	}
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLength := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return errors.New("bedrock event stream prelude checksum mismatch")
+	}
+	if total > bedrockMaxFrameSize || uint64(total) < 16+uint64(headersLength) {
+		return fmt.Errorf("bedrock event stream frame length %d is invalid", total)
+	}
+	frame := make([]byte, total)
+	copy(frame, prelude)
+	if _, err := io.ReadFull(r.reader, frame[12:]); err != nil {
+		return fmt.Errorf("bedrock event stream truncated: %w", err)
+	}
+	if crc32.ChecksumIEEE(frame[:total-4]) != binary.BigEndian.Uint32(frame[total-4:]) {
+		return errors.New("bedrock event stream message checksum mismatch")
+	}
+	headers, err := parseEventStreamHeaders(frame[12 : 12+headersLength])
+	if err != nil {
+		return err
+	}
+	payload := frame[12+headersLength : total-4]
+
+	switch headers[":message-type"] {
+	case "event":
+		if headers[":event-type"] != "chunk" {
+			return nil
+		}
+		var chunk struct {
+			Bytes []byte `json:"bytes"` // base64 编码的 Anthropic 流事件。
+		}
+		if err := json.Unmarshal(payload, &chunk); err != nil {
+			return fmt.Errorf("decode bedrock chunk: %w", err)
+		}
+		var event struct {
+			Type string `json:"type"` // Anthropic 事件类型。
+		}
+		if err := json.Unmarshal(chunk.Bytes, &event); err != nil {
+			return fmt.Errorf("decode bedrock chunk event: %w", err)
+		}
+		r.writeEvent(event.Type, chunk.Bytes)
+	case "exception":
+		var failure struct {
+			Message string `json:"message"` // 异常说明。
+		}
+		if json.Unmarshal(payload, &failure) != nil || failure.Message == "" {
+			failure.Message = string(payload)
+		}
+		r.writeEvent("error", anthropicErrorBody(headers[":exception-type"], failure.Message))
+	case "error":
+		r.writeEvent("error", anthropicErrorBody(headers[":error-code"], headers[":error-message"]))
+	}
+	return nil
+}
+
+// writeEvent 以单行 data 写入一个 SSE 事件。
+func (r *eventStreamReader) writeEvent(eventType string, data []byte) {
+	var compact bytes.Buffer
+	if json.Compact(&compact, data) == nil {
+		data = compact.Bytes()
+	}
+	fmt.Fprintf(&r.pending, "event: %s\ndata: %s\n\n", eventType, data)
+}
+
+// parseEventStreamHeaders 解析帧头, 只保留字符串类型的值, 其余类型按长度跳过。
+func parseEventStreamHeaders(data []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	invalid := errors.New("bedrock event stream headers are malformed")
+	for len(data) > 0 {
+		nameLength := int(data[0])
+		if len(data) < 1+nameLength+1 {
+			return nil, invalid
+		}
+		name := string(data[1 : 1+nameLength])
+		valueType := data[1+nameLength]
+		data = data[2+nameLength:]
+
+		var size int
+		switch valueType {
+		case 0, 1: // 布尔值, 值由类型本身表示。
+		case 2:
+			size = 1
+		case 3:
+			size = 2
+		case 4:
+			size = 4
+		case 5, 8:
+			size = 8
+		case 9:
+			size = 16
+		case 6, 7:
+			if len(data) < 2 {
+				return nil, invalid
+			}
+			size = 2 + int(binary.BigEndian.Uint16(data[:2]))
+		default:
+			return nil, invalid
+		}
+		if len(data) < size {
+			return nil, invalid
+		}
+		if valueType == 7 {
+			headers[name] = string(data[2:size])
+		}
+		data = data[size:]
+	}
+	return headers, nil
+}
@@ -0,0 +1,231 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/helper"
+	"github.com/bestruirui/octopus/internal/model"
+)
+
+// eventStreamFrame 按 AWS event-stream 格式编码一帧, headers 全部为字符串类型。
+func eventStreamFrame(headers [][2]string, payload []byte) []byte {
+	var encoded bytes.Buffer
+	for _, header := range headers {
+		encoded.WriteByte(byte(len(header[0])))
+		encoded.WriteString(header[0])
+		encoded.WriteByte(7)
+		binary.Write(&encoded, binary.BigEndian, uint16(len(header[1])))
+		encoded.WriteString(header[1])
+	}
+	total := 12 + encoded.Len() + len(payload) + 4
+	frame := make([]byte, 0, total)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(total))
+	frame = binary.BigEndian.AppendUint32(frame, uint32(encoded.Len()))
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+	frame = append(frame, encoded.Bytes()...)
+	frame = append(frame, payload...)
+	return binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+}
+
+// chunkFrame 编码一个携带 Anthropic 流事件的 chunk 帧。
+func chunkFrame(event string) []byte {
+	payload, _ := json.Marshal(map[string]string{"bytes": base64.StdEncoding.EncodeToString([]byte(event))})
+	return eventStreamFrame([][2]string{{":event-type", "chunk"}, {":content-type", "application/json"}, {":message-type", "event"}}, payload)
+}
+
+// bedrockStream 是 invoke-with-response-stream 一次完整响应的帧序列, 帧头与 Bedrock 返回的帧相同, 夹带一个应被忽略的非 chunk 事件。
+func bedrockStream() []byte {
+	var stream bytes.Buffer
+	stream.Write(chunkFrame(`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-haiku","content":[],"usage":{"input_tokens":12,"output_tokens":1}}}`))
+	stream.Write(chunkFrame(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`))
+	stream.Write(eventStreamFrame([][2]string{{":event-type", "metadata"}, {":message-type", "event"}}, []byte(`{}`)))
+	stream.Write(chunkFrame(`{"type":"message_stop","amazon-bedrock-invocationMetrics":{"inputTokenCount":12,"outputTokenCount":5}}`))
+	return stream.Bytes()
+}
+
+func TestEventStreamReader(t *testing.T) {
+	stream := bedrockStream()
+	stream = append(stream, eventStreamFrame([][2]string{{":exception-type", "throttlingException"}, {":message-type", "exception"}}, []byte(`{"message":"Too many requests"}`))...)
+
+	got, err := io.ReadAll(newEventStreamReader(io.NopCloser(bytes.NewReader(stream))))
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	want := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"claude-3-haiku\",\"content\":[],\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n" +
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n" +
+		"event: message_stop\ndata: {\"type\":\"message_stop\",\"amazon-bedrock-invocationMetrics\":{\"inputTokenCount\":12,\"outputTokenCount\":5}}\n\n" +
+		"event: error\ndata: {\"error\":{\"message\":\"Too many requests\",\"type\":\"throttlingException\"},\"type\":\"error\"}\n\n"
+	if string(got) != want {
+		t.Fatalf("decoded stream:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEventStreamReaderRejectsCorruptFrames(t *testing.T) {
+	frame := chunkFrame(`{"type":"ping"}`)
+	tests := []struct {
+		name   string
+		stream func() []byte
+		want   string
+	}{
+		{"prelude checksum", func() []byte {
+			corrupt := bytes.Clone(frame)
+			corrupt[9] ^= 0xff
+			return corrupt
+		}, "prelude checksum mismatch"},
+		{"message checksum", func() []byte {
+			corrupt := bytes.Clone(frame)
+			corrupt[len(corrupt)-6] ^= 0xff
+			return corrupt
+		}, "message checksum mismatch"},
+		{"truncated prelude", func() []byte { return frame[:6] }, "truncated"},
+		{"truncated message", func() []byte { return frame[:len(frame)-2] }, "truncated"},
+		{"oversized length", func() []byte {
+			corrupt := bytes.Clone(frame[:12])
+			binary.BigEndian.PutUint32(corrupt[0:4], bedrockMaxFrameSize+1)
+			binary.BigEndian.PutUint32(corrupt[8:12], crc32.ChecksumIEEE(corrupt[:8]))
+			return corrupt
+		}, "is invalid"},
+	}
+	for _, tt := range tests {
+		_, err := io.ReadAll(newEventStreamReader(io.NopCloser(bytes.NewReader(tt.stream()))))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// bedrockStub 启动模拟 Bedrock 推理接口的本地服务, 按收到的请求重新计算 SigV4 签名并与请求头比对, 再由 respond 校验请求并写出响应。
+func bedrockStub(t *testing.T, credentials helper.AWSCredentials, respond func(w http.ResponseWriter, r *http.Request, body []byte)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			t.Errorf("X-Amz-Date = %q: %v", r.Header.Get("X-Amz-Date"), err)
+		}
+		expected, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+		expected.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+		helper.SignAWSRequest(expected, body, credentials, "us-east-1", "bedrock", signedAt)
+		if got, want := r.Header.Get("Authorization"), expected.Header.Get("Authorization"); got != want {
+			t.Errorf("Authorization = %s, want %s", got, want)
+		}
+		respond(w, r, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func bedrockRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodPost, "https://api.anthropic.com/v1/messages", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Api-Key", "AKID:secret")
+	request.Header.Set("Anthropic-Version", "2023-06-01")
+	request.Header.Set("Anthropic-Beta", "tools-2024-04-04, output-128k-2025-02-19")
+	return request
+}
+
+func TestBedrockTransportStreaming(t *testing.T) {
+	credentials := helper.AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	server := bedrockStub(t, credentials, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if got, want := r.URL.EscapedPath(), "/model/anthropic.claude-3-haiku-20240307-v1%3A0/invoke-with-response-stream"; got != want {
+			t.Errorf("path = %s, want %s", got, want)
+		}
+		if r.Header.Get("X-Api-Key") != "" || r.Header.Get("Anthropic-Version") != "" {
+			t.Errorf("anthropic headers forwarded to bedrock: %v", r.Header)
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("request body: %v", err)
+			return
+		}
+		if payload["anthropic_version"] != bedrockAnthropicVersion {
+			t.Errorf("anthropic_version = %v", payload["anthropic_version"])
+		}
+		if _, ok := payload["model"]; ok {
+			t.Errorf("model forwarded in body")
+		}
+		if _, ok := payload["stream"]; ok {
+			t.Errorf("stream forwarded in body")
+		}
+		if beta, _ := json.Marshal(payload["anthropic_beta"]); string(beta) != `["tools-2024-04-04","output-128k-2025-02-19"]` {
+			t.Errorf("anthropic_beta = %s", beta)
+		}
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		w.Write(bedrockStream())
+	})
+
+	transport := &bedrockTransport{base: http.DefaultTransport, channel: model.Channel{BaseURL: server.URL, Region: "us-east-1"}, credentials: credentials}
+	response, err := transport.RoundTrip(bedrockRequest(t, `{"model":"anthropic.claude-3-haiku-20240307-v1:0","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"Hi"}]}`))
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	defer response.Body.Close()
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", got)
+	}
+	events, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	if got := strings.Count(string(events), "\n\n"); got != 3 {
+		t.Errorf("decoded %d events, want 3:\n%s", got, events)
+	}
+	if !strings.HasPrefix(string(events), "event: message_start\n") || !strings.Contains(string(events), `"text":"Hello"`) {
+		t.Errorf("unexpected stream:\n%s", events)
+	}
+}
+
+func TestBedrockTransportError(t *testing.T) {
+	credentials := helper.AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"}
+	server := bedrockStub(t, credentials, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if got, want := r.URL.EscapedPath(), "/model/us.anthropic.claude-3-haiku-20240307-v1%3A0/invoke"; got != want {
+			t.Errorf("path = %s, want %s", got, want)
+		}
+		if got := r.Header.Get("X-Amz-Security-Token"); got != "token" {
+			t.Errorf("X-Amz-Security-Token = %q, want token", got)
+		}
+		w.Header().Set("X-Amzn-Errortype", "ValidationException:http://internal.amazon.com/coral/com.amazon.bedrock/")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"max_tokens: Field required"}`))
+	})
+
+	transport := &bedrockTransport{base: http.DefaultTransport, channel: model.Channel{BaseURL: server.URL, Region: "us-east-1"}, credentials: credentials}
+	response, err := transport.RoundTrip(bedrockRequest(t, `{"model":"us.anthropic.claude-3-haiku-20240307-v1:0","messages":[{"role":"user","content":"Hi"}]}`))
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", response.StatusCode)
+	}
+	if want := `{"error":{"message":"max_tokens: Field required","type":"ValidationException"},"type":"error"}`; string(body) != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+}
+
+func TestBedrockTransportRejectsNonAnthropicModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request for unsupported model reached bedrock: %s", r.URL)
+	}))
+	defer server.Close()
+
+	transport := &bedrockTransport{base: http.DefaultTransport, channel: model.Channel{BaseURL: server.URL, Region: "us-east-1"}, credentials: helper.AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}}
+	_, err := transport.RoundTrip(bedrockRequest(t, `{"model":"meta.llama3-70b-instruct-v1:0","max_tokens":16,"messages":[{"role":"user","content":"Hi"}]}`))
+	if err == nil || !strings.Contains(err.Error(), "only support anthropic models") {
+		t.Fatalf("RoundTrip() error = %v, want unsupported model error", err)
+	}
+}
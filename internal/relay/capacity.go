@@ -0,0 +1,171 @@
+package relay
+
+import (
+	"context"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/op"
+	"github.com/looplj/axonhub/llm"
+)
+
+// capacityRecheck 是全部成员渠道满载时重新选择目标的最长等待时间; 并发名额归还会提前唤醒, 每分钟请求数名额只能随时间恢复。
+const capacityRecheck = time.Second
+
+// ChannelLoad 是一个渠道的实时占用, 跨使用该渠道的全部分组共享。
+type ChannelLoad struct {
+	InFlight       int `json:"in_flight"`       // 正在进行的上游轮次数。
+	MaxConcurrency int `json:"max_concurrency"` // 渠道配置的并发上限, 0 表示不限制。
+	RecentRequests int `json:"recent_requests"` // 最近一分钟发出的上游轮次数, 只在配置了每分钟请求数上限时记录。
+	MaxRPM         int `json:"max_rpm"`         // 渠道配置的每分钟请求数上限, 0 表示不限制。
+}
+
+// channelLoad 是一个渠道的占用记录。
+type channelLoad struct {
+	inflight int         // 正在进行的上游轮次数。
+	starts   []time.Time // 窗口内发出上游轮次的时间, 按时间先后排列。
+}
+
+var (
+	channelLoads  = make(map[int]*channelLoad) // channelLoads 按渠道 ID 保存占用记录, 由 routeMu 保护。
+	capacityFreed = make(chan struct{})        // capacityFreed 在任一渠道归还名额时关闭并替换, 唤醒等待名额的请求, 由 routeMu 保护。
+)
+
+// channelSaturatedLocked 判断渠道是否已达并发或每分钟请求数上限; 渠道不存在时不视为满载, 交由调用方发现; 调用方必须持有锁。
+func channelSaturatedLocked(channelID int, now time.Time) bool {
+	channel, err := op.ChannelGet(channelID)
+	if err != nil {
+		return false
+	}
+	load := channelLoads[channelID]
+	if load == nil {
+		return false
+	}
+	load.prune(now)
+	return (channel.MaxConcurrency > 0 && load.inflight >= channel.MaxConcurrency) ||
+		(channel.MaxRPM > 0 && len(load.starts) >= channel.MaxRPM)
+}
+
+// groupSaturated 判断分组没有可用成员是否因为成员渠道满载: 存在能处理客户端协议 format, 未在冷却中或冷却已到期, 但渠道已满载的成员。
+func groupSaturated(group model.Group, format llm.APIFormat) bool {
+	routeMu.Lock()
+	defer routeMu.Unlock()
+
+	now := time.Now()
+	route := routes[group.ID]
+	for _, item := range formatItems(group.Items, format) {
+		if group.Mode == model.GroupModeManual && item.ID != group.ActiveItemID {
+			continue
+		}
+		if route != nil {
+			if deadline, cooling := route.Cooldowns[item.ID]; cooling && deadline > now.UnixMilli() {
+				continue
+			}
+		}
+		if channelSaturatedLocked(item.ChannelID, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireChannelSlot 为一轮上游请求占用渠道的并发与每分钟请求数名额, 渠道已满载时返回 false; 名额在本轮上下文结束时归还。
+// 选择成员时已跳过满载渠道, 并发请求同时选中同一渠道时由此处裁决, 落选的请求重新选择目标。
+func acquireChannelSlot(ctx context.Context, channel model.Channel) bool {
+	if channel.MaxConcurrency <= 0 && channel.MaxRPM <= 0 {
+		return true
+	}
+
+	routeMu.Lock()
+	defer routeMu.Unlock()
+
+	now := time.Now()
+	if channelSaturatedLocked(channel.ID, now) {
+		return false
+	}
+	load := channelLoads[channel.ID]
+	if load == nil {
+		load = &channelLoad{}
+		channelLoads[channel.ID] = load
+	}
+	load.inflight++
+	if channel.MaxRPM > 0 {
+		load.starts = append(load.starts, now)
+	}
+	publishChannelLocked(channel.ID)
+	context.AfterFunc(ctx, func() { releaseChannelSlot(channel.ID) })
+	return true
+}
+
+// releaseChannelSlot 归还渠道的并发名额并唤醒等待名额的请求。
+func releaseChannelSlot(channelID int) {
+	routeMu.Lock()
+	defer routeMu.Unlock()
+
+	load := channelLoads[channelID]
+	if load == nil {
+		return
+	}
+	load.inflight--
+	if load.inflight == 0 && len(load.starts) == 0 {
+		delete(channelLoads, channelID)
+	}
+	close(capacityFreed)
+	capacityFreed = make(chan struct{})
+	publishChannelLocked(channelID)
+}
+
+// waitCapacity 在全部成员渠道满载时等待任一渠道归还名额或 capacityRecheck 到期, 且不越过非零的 deadline; 客户端断开时以取消终态定稿并返回 false。
+func (r *RequestState) waitCapacity(ctx context.Context, deadline time.Time) bool {
+	routeMu.Lock()
+	freed := capacityFreed
+	routeMu.Unlock()
+
+	delay := capacityRecheck
+	if !deadline.IsZero() {
+		delay = min(delay, time.Until(deadline))
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		r.markCanceled(ctx.Err(), "", nil)
+		return false
+	case <-freed:
+		return true
+	case <-timer.C:
+		return true
+	}
+}
+
+// channelLoadLocked 返回渠道当前的占用与配置的上限; 调用方必须持有锁。
+func channelLoadLocked(channelID int, now time.Time) ChannelLoad {
+	var result ChannelLoad
+	if channel, err := op.ChannelGet(channelID); err == nil {
+		result.MaxConcurrency, result.MaxRPM = channel.MaxConcurrency, channel.MaxRPM
+	}
+	if load := channelLoads[channelID]; load != nil {
+		load.prune(now)
+		result.InFlight, result.RecentRequests = load.inflight, len(load.starts)
+	}
+	return result
+}
+
+// publishChannelLocked 向包含该渠道成员的全部分组发布路由状态; 调用方必须持有锁。
+func publishChannelLocked(channelID int) {
+	for _, route := range routes {
+		if route.channelIDs[channelID] {
+			publishRouteLocked(route)
+		}
+	}
+}
+
+// prune 移除已经滑出每分钟窗口的发出记录。
+func (l *channelLoad) prune(now time.Time) {
+	start := now.Add(-rateLimitWindow)
+	index := 0
+	for index < len(l.starts) && !l.starts[index].After(start) {
+		index++
+	}
+	l.starts = l.starts[index:]
+}
@@ -1,11 +1,16 @@
 package relay
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/bestruirui/octopus/internal/helper"
 	"github.com/bestruirui/octopus/internal/model"
 	"github.com/looplj/axonhub/llm"
 	"github.com/looplj/axonhub/llm/auth"
@@ -18,8 +23,9 @@ import (
 	"github.com/looplj/axonhub/llm/transformer/openai/responses"
 	"github.com/tidwall/sjson"
 )
-// buildOutbound 按渠道协议构造出站转换器, 并判断客户端请求能否直接透传。
-func buildOutbound(channel model.Channel, format llm.APIFormat) (transformer.Outbound, bool, error) {
+
+// buildOutbound 按渠道协议构造出站转换器, 并判断客户端请求能否直接透传; modelName 是本轮上游模型, Vertex 渠道据此选择发布方协议。
+func buildOutbound(channel model.Channel, format llm.APIFormat, modelName string) (transformer.Outbound, bool, error) {
 	key := auth.NewStaticKeyProvider(channel.Key)
 	switch channel.Type {
 	case model.ChannelProviderOpenAI:
@@ -33,18 +39,126 @@ func buildOutbound(channel model.Channel, format llm.APIFormat) (transformer.Out
 		return outbound, format == llm.APIFormatAnthropicMessage, err
 	case model.ChannelProviderGemini:
 		outbound, err := gemini.NewOutboundTransformerWithConfig(gemini.Config{BaseURL: channel.BaseURL, APIKeyProvider: key})
-		return outbound, false, err
+		return outbound, format == llm.APIFormatGeminiContents, err
 	case model.ChannelProviderVolcengine:
 		outbound, err := doubao.NewOutboundTransformerWithConfig(&doubao.Config{BaseURL: channel.BaseURL, APIKeyProvider: key})
 		return outbound, false, err
+	case model.ChannelProviderBedrock:
+		// Bedrock 按 Anthropic 协议构造请求, 由 bedrockTransport 在发出前改写为 invoke 接口并签名。
+		outbound, err := anthropic.NewOutboundTransformerWithConfig(&anthropic.Config{Type: anthropic.PlatformDirect, BaseURL: helper.BedrockRuntimeURL(channel), APIKeyProvider: key})
+		return outbound, format == llm.APIFormatAnthropicMessage, err
+	case model.ChannelProviderVertex:
+		// Vertex 按模型发布方使用 Anthropic 或 Gemini 协议构造请求, 由 vertexTransport 在发出前改写为 Vertex 地址并认证。
+		if vertexAnthropicModel(modelName) {
+			outbound, err := anthropic.NewOutboundTransformerWithConfig(&anthropic.Config{Type: anthropic.PlatformDirect, BaseURL: helper.VertexEndpoint(channel), APIKeyProvider: key})
+			return outbound, format == llm.APIFormatAnthropicMessage, err
+		}
+		outbound, err := gemini.NewOutboundTransformerWithConfig(gemini.Config{BaseURL: helper.VertexEndpoint(channel), APIKeyProvider: key})
+		return outbound, format == llm.APIFormatGeminiContents, err
+	case model.ChannelProviderOllama:
+		// 使用原生接口时仍按 OpenAI Chat 协议构造请求, 由 ollamaTransport 改写为 /api/chat。
+		outbound, err := openai.NewOutboundTransformerWithConfig(&openai.Config{PlatformType: openai.PlatformOpenAI, BaseURL: helper.OllamaBaseURL(channel), APIKeyProvider: key})
+		return outbound, format == llm.APIFormatOpenAIChatCompletion, err
+	case model.ChannelProviderMock:
+		// 模拟渠道原生应答 OpenAI Chat, Anthropic 与 Gemini 请求, 其余协议转换为 OpenAI Chat 后由 mockTransport 应答。
+		switch format {
+		case llm.APIFormatAnthropicMessage:
+			outbound, err := anthropic.NewOutboundTransformerWithConfig(&anthropic.Config{Type: anthropic.PlatformDirect, BaseURL: mockBaseURL, APIKeyProvider: key})
+			return outbound, true, err
+		case llm.APIFormatGeminiContents:
+			outbound, err := gemini.NewOutboundTransformerWithConfig(gemini.Config{BaseURL: mockBaseURL, APIKeyProvider: key})
+			return outbound, true, err
+		default:
+			outbound, err := openai.NewOutboundTransformerWithConfig(&openai.Config{PlatformType: openai.PlatformOpenAI, BaseURL: mockBaseURL, APIKeyProvider: key})
+			return outbound, format == llm.APIFormatOpenAIChatCompletion, err
+		}
+	case model.ChannelProviderAzure, model.ChannelProviderCompatible:
+		// 跨协议请求按 OpenAI Chat 协议构造, 地址和认证在发出前由 OnOutboundRawRequest 改写为渠道的形式。
+		outbound, err := openai.NewOutboundTransformerWithConfig(&openai.Config{PlatformType: openai.PlatformOpenAI, BaseURL: channel.BaseURL, APIKeyProvider: key})
+		return outbound, format == llm.APIFormatOpenAIChatCompletion, err
 	default:
 		return nil, false, fmt.Errorf("unsupported channel provider: %s", channel.Type)
 	}
 }
 
+// channelHTTPClient 返回请求渠道使用的 HTTP 客户端; Bedrock, Vertex 与使用原生接口的 Ollama 渠道返回在发出前改写请求的客户端副本,
+// 不影响共享的原客户端; 模拟渠道返回在进程内应答的客户端。
+func channelHTTPClient(channel model.Channel) (*http.Client, error) {
+	if channel.Type == model.ChannelProviderMock {
+		return &http.Client{Transport: &mockTransport{config: channel.Mock}}, nil
+	}
+	client, err := helper.ChannelHttpClient(&channel)
+	if err != nil {
+		return nil, err
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	var transport http.RoundTripper
+	switch channel.Type {
+	case model.ChannelProviderBedrock:
+		credentials, err := helper.ParseAWSCredentials(channel.Key)
+		if err != nil {
+			return nil, err
+		}
+		transport = &bedrockTransport{base: base, channel: channel, credentials: credentials}
+	case model.ChannelProviderVertex:
+		credentials, err := helper.ParseVertexCredentials(channel.Key)
+		if err != nil {
+			return nil, err
+		}
+		transport = &vertexTransport{base: base, channel: channel, credentials: credentials}
+	case model.ChannelProviderOllama:
+		if !channel.OllamaNative {
+			return client, nil
+		}
+		transport = &ollamaTransport{base: base}
+	default:
+		return client, nil
+	}
+	wrapped := *client
+	wrapped.Transport = transport
+	return &wrapped, nil
+}
+
+// readRequestBody 读出并关闭请求正文。
+func readRequestBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil {
+		return nil, nil
+	}
+	defer request.Body.Close()
+	return io.ReadAll(request.Body)
+}
+
+// readResponseBody 读出并关闭响应正文。
+func readResponseBody(response *http.Response) ([]byte, error) {
+	defer response.Body.Close()
+	return io.ReadAll(response.Body)
+}
+
+// setResponseBody 把响应正文替换为 JSON 格式的 body。
+func setResponseBody(response *http.Response, body []byte) {
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	response.ContentLength = int64(len(body))
+	response.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	response.Header.Set("Content-Type", "application/json")
+}
+
+// openAICompatible 判断渠道是否提供 OpenAI 的 Embedding, 图片, 语音和文本补全等附属接口, 可以同协议透传这些请求。
+func openAICompatible(provider model.ChannelProvider) bool {
+	switch provider {
+	case model.ChannelProviderOpenAI, model.ChannelProviderOpenAIResponses, model.ChannelProviderAzure, model.ChannelProviderCompatible, model.ChannelProviderOllama:
+		return true
+	default:
+		return false
+	}
+}
+
 // applyChannelConfig 按渠道配置覆盖上游请求的参数并追加自定义 Header; model 与 stream 由转发流程决定, 不允许覆盖。
 func applyChannelConfig(channel model.Channel, request *httpclient.Request) error {
-	if channel.ParamOverride != nil && *channel.ParamOverride != "" {
+	// 参数覆盖按 JSON 路径改写请求体, multipart 表单请求不适用。
+	if channel.ParamOverride != nil && *channel.ParamOverride != "" && !isMultipart(request.Headers) {
 		var overrides map[string]json.RawMessage
 		if err := json.Unmarshal([]byte(*channel.ParamOverride), &overrides); err != nil {
 			return fmt.Errorf("invalid channel parameter override: %w", err)
@@ -0,0 +1,164 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+// errorClass 是一轮上游失败对转发流程的含义。
+type errorClass int
+
+const (
+	errorClassRetryable errorClass = iota // 普通失败: 计入成员失败次数并按配置重试或换目标。
+	errorClassClient                      // 请求本身无效: 换成员也不会成功, 立即以上游状态码返回客户端。
+	errorClassAuth                        // 渠道凭据无效: 标记渠道密钥失效, 成员立即进入冷却。
+	errorClassThrottled                   // 上游限流或暂不可用: 有 Retry-After 时按其冷却成员。
+)
+
+// 以非鉴权状态码下发、但正文表明凭据无效的错误标记。
+var authErrorMarkers = []string{"invalid_api_key", "API_KEY_INVALID", "authentication_error"}
+
+// upstreamError 是上游以错误状态码拒绝本轮请求的失败, 保留状态码、原始正文和建议的重试间隔供分类使用。
+type upstreamError struct {
+	status     int           // 上游响应状态码。
+	body       []byte        // 上游错误响应的原始正文。
+	retryAfter time.Duration // 上游 Retry-After 建议的等待时间, 0 表示未给出。
+	err        error         // 底层错误。
+}
+
+func (e *upstreamError) Error() string {
+	if len(e.body) == 0 {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.err, e.body)
+}
+
+func (e *upstreamError) Unwrap() error {
+	return e.err
+}
+
+// message 返回上游错误正文中的可读消息, 无法识别结构时返回原始正文。
+func (e *upstreamError) message() string {
+	var payload struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(e.body, &payload); err == nil {
+		var detail struct {
+			Message string `json:"message"`
+		}
+		var text string
+		switch {
+		case json.Unmarshal(payload.Error, &detail) == nil && detail.Message != "":
+			return detail.Message
+		case json.Unmarshal(payload.Error, &text) == nil && text != "":
+			return text
+		case payload.Message != "":
+			return payload.Message
+		}
+	}
+	if len(e.body) == 0 {
+		return e.err.Error()
+	}
+	return string(e.body)
+}
+
+// classifyError 判断一轮失败的类别; 没有上游状态码的失败一律按普通失败处理。
+func classifyError(err error) (errorClass, *upstreamError) {
+	var failure *upstreamError
+	if !errors.As(err, &failure) {
+		return errorClassRetryable, nil
+	}
+	for _, marker := range authErrorMarkers {
+		if strings.Contains(string(failure.body), marker) {
+			return errorClassAuth, failure
+		}
+	}
+	switch failure.status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return errorClassClient, failure
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errorClassAuth, failure
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return errorClassThrottled, failure
+	default:
+		return errorClassRetryable, failure
+	}
+}
+
+// newUpstreamError 将库返回的上游状态码错误包装为可分类的失败, 其余错误原样返回。
+// 库错误不携带响应头, Retry-After 由 retryAfterTransport 在传输层另行记录。
+func newUpstreamError(err error, body []byte, recorder *retryAfterTransport) error {
+	var failure *httpclient.Error
+	if !errors.As(err, &failure) {
+		return err
+	}
+	if len(body) == 0 {
+		body = failure.Body
+	}
+	return &upstreamError{status: failure.StatusCode, body: body, retryAfter: recorder.value(), err: err}
+}
+
+// parseRetryAfter 解析上游建议的重试等待时间, 支持 Retry-After 的秒数与 HTTP 日期两种形式以及毫秒形式的 retry-after-ms。
+func parseRetryAfter(header http.Header) time.Duration {
+	if value := header.Get("Retry-After-Ms"); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// retryAfterTransport 包装渠道的 HTTP 传输层, 记录本轮最后一个错误响应给出的 Retry-After。
+type retryAfterTransport struct {
+	base       http.RoundTripper // 渠道原有的传输层。
+	mu         sync.Mutex        // 保护 retryAfter。
+	retryAfter time.Duration     // 最后一个错误响应建议的等待时间。
+}
+
+// recordRetryAfter 返回使用记录传输层的客户端副本, 不影响渠道共享的原客户端。
+func recordRetryAfter(client *http.Client) (*http.Client, *retryAfterTransport) {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	recorder := &retryAfterTransport{base: base}
+	wrapped := *client
+	wrapped.Transport = recorder
+	return &wrapped, recorder
+}
+
+func (t *retryAfterTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.base.RoundTrip(request)
+	if err == nil && response.StatusCode >= http.StatusBadRequest {
+		t.mu.Lock()
+		t.retryAfter = parseRetryAfter(response.Header)
+		t.mu.Unlock()
+	}
+	return response, err
+}
+
+// value 返回记录的等待时间。
+func (t *retryAfterTransport) value() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.retryAfter
+}
@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"absent", http.Header{}, 0},
+		{"seconds", http.Header{"Retry-After": {"30"}}, 30 * time.Second},
+		{"negative seconds", http.Header{"Retry-After": {"-5"}}, 0},
+		{"milliseconds", http.Header{"Retry-After-Ms": {"1500"}}, 1500 * time.Millisecond},
+		{"milliseconds take precedence", http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"10"}}, 250 * time.Millisecond},
+		{"invalid milliseconds fall back", http.Header{"Retry-After-Ms": {"soon"}, "Retry-After": {"10"}}, 10 * time.Second},
+		{"past date", http.Header{"Retry-After": {"Wed, 21 Oct 2015 07:28:00 GMT"}}, 0},
+		{"garbage", http.Header{"Retry-After": {"later"}}, 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header); got != tt.want {
+			t.Errorf("%s: parseRetryAfter() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryAfterDate(t *testing.T) {
+	at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	got := parseRetryAfter(http.Header{"Retry-After": {at}})
+	if got <= 58*time.Second || got > time.Minute {
+		t.Fatalf("parseRetryAfter(%q) = %v, want about one minute", at, got)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	upstream := func(status int, body string) error {
+		return &upstreamError{status: status, body: []byte(body), err: fmt.Errorf("status %d", status)}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want errorClass
+	}{
+		{"transport error", errors.New("connection reset"), errorClassRetryable},
+		{"bad request", upstream(http.StatusBadRequest, `{"error":{"message":"bad"}}`), errorClassClient},
+		{"payload too large", upstream(http.StatusRequestEntityTooLarge, ""), errorClassClient},
+		{"unprocessable", upstream(http.StatusUnprocessableEntity, ""), errorClassClient},
+		{"unauthorized", upstream(http.StatusUnauthorized, ""), errorClassAuth},
+		{"forbidden", upstream(http.StatusForbidden, ""), errorClassAuth},
+		{"auth marker on bad request", upstream(http.StatusBadRequest, `{"error":{"status":"INVALID_ARGUMENT","reason":"API_KEY_INVALID"}}`), errorClassAuth},
+		{"too many requests", upstream(http.StatusTooManyRequests, ""), errorClassThrottled},
+		{"service unavailable", upstream(http.StatusServiceUnavailable, ""), errorClassThrottled},
+		{"server error", upstream(http.StatusInternalServerError, ""), errorClassRetryable},
+		{"wrapped", fmt.Errorf("round failed: %w", upstream(http.StatusTooManyRequests, "")), errorClassThrottled},
+	}
+	for _, tt := range tests {
+		got, failure := classifyError(tt.err)
+		if got != tt.want {
+			t.Errorf("%s: classifyError() = %v, want %v", tt.name, got, tt.want)
+		}
+		var target *upstreamError
+		if errors.As(tt.err, &target) && failure != target {
+			t.Errorf("%s: classifyError() failure = %v, want %v", tt.name, failure, target)
+		}
+	}
+}
+
+func TestUpstreamErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"openai", `{"error":{"message":"model overloaded","type":"server_error"}}`, "model overloaded"},
+		{"string error", `{"error":"quota exceeded"}`, "quota exceeded"},
+		{"top-level message", `{"message":"not found"}`, "not found"},
+		{"plain text", "upstream exploded", "upstream exploded"},
+		{"empty", "", "status 500"},
+	}
+	for _, tt := range tests {
+		failure := &upstreamError{status: http.StatusInternalServerError, body: []byte(tt.body), err: errors.New("status 500")}
+		if got := failure.message(); got != tt.want {
+			t.Errorf("%s: message() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package relay
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+// compatibleRequestURL 返回 OpenAI 兼容渠道上客户端协议对应接口的地址, 路径按渠道配置的模板生成, 凭据放在查询参数时一并写入。
+func compatibleRequestURL(channel model.Channel, format llm.APIFormat, modelName string) string {
+	base := strings.TrimRight(strings.TrimSuffix(channel.BaseURL, "##"), "/")
+	target := base + channel.Compatible.Path(strings.TrimPrefix(upstreamPath(format), "/"), modelName)
+	if channel.Compatible.AuthScheme != model.CompatibleAuthQuery {
+		return target
+	}
+	name := channel.Compatible.AuthHeader
+	if name == "" {
+		name = "key"
+	}
+	separator := "?"
+	if strings.Contains(target, "?") {
+		separator = "&"
+	}
+	return target + separator + url.QueryEscape(name) + "=" + url.QueryEscape(channel.Key)
+}
+
+// compatibleAuth 返回 OpenAI 兼容渠道以请求头认证时的认证配置; 凭据放在查询参数或不认证时返回 nil。
+// header 方式未配置请求头名称时, 凭据不带 Bearer 前缀放在 Authorization 中。
+func compatibleAuth(channel model.Channel) *httpclient.AuthConfig {
+	switch channel.Compatible.AuthScheme {
+	case model.CompatibleAuthHeader:
+		header := channel.Compatible.AuthHeader
+		if header == "" {
+			header = "Authorization"
+		}
+		return &httpclient.AuthConfig{Type: httpclient.AuthTypeAPIKey, APIKey: channel.Key, HeaderKey: header}
+	case model.CompatibleAuthQuery, model.CompatibleAuthNone:
+		return nil
+	default:
+		return &httpclient.AuthConfig{Type: httpclient.AuthTypeBearer, APIKey: channel.Key}
+	}
+}
+
+// rewriteCompatibleRequest 把按 OpenAI 协议转换得到的上游请求改写为渠道配置的接口路径和认证方式。
+func rewriteCompatibleRequest(channel model.Channel, request *httpclient.Request) error {
+	modelName, err := requestModel(request)
+	if err != nil {
+		return err
+	}
+	request.URL = compatibleRequestURL(channel, llm.APIFormatOpenAIChatCompletion, modelName)
+	if request.Headers == nil {
+		request.Headers = http.Header{}
+	}
+	request.Headers.Del("Authorization")
+	request.Auth = compatibleAuth(channel)
+	switch {
+	case request.Auth == nil:
+	case request.Auth.Type == httpclient.AuthTypeBearer:
+		request.Headers.Set("Authorization", "Bearer "+channel.Key)
+	default:
+		request.Headers.Set(request.Auth.HeaderKey, channel.Key)
+	}
+	return nil
+}
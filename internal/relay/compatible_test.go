@@ -0,0 +1,109 @@
+package relay
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+func TestCompatibleRequestURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		config model.CompatibleConfig
+		format llm.APIFormat
+		want   string
+	}{
+		{"default prefix", "https://api.example.com", model.CompatibleConfig{}, llm.APIFormatOpenAIChatCompletion,
+			"https://api.example.com/v1/chat/completions"},
+		{"trailing slash", "https://api.example.com/", model.CompatibleConfig{PathPrefix: "/api/paas/v4/"}, llm.APIFormatOpenAIEmbedding,
+			"https://api.example.com/api/paas/v4/embeddings"},
+		{"raw marker and trailing slash", "https://api.example.com/##", model.CompatibleConfig{PathPrefix: "openai"}, llm.APIFormatOpenAIChatCompletion,
+			"https://api.example.com/openai/chat/completions"},
+		{"model template", "https://api.example.com", model.CompatibleConfig{Paths: map[string]string{"chat/completions": "/models/{model}/chat"}}, llm.APIFormatOpenAIChatCompletion,
+			"https://api.example.com/models/m1/chat"},
+		{"template only for its endpoint", "https://api.example.com", model.CompatibleConfig{Paths: map[string]string{"chat/completions": "/chat"}}, llm.APIFormatOpenAIEmbedding,
+			"https://api.example.com/v1/embeddings"},
+		{"query key", "https://api.example.com", model.CompatibleConfig{AuthScheme: model.CompatibleAuthQuery, AuthHeader: "api_key"}, llm.APIFormatOpenAIChatCompletion,
+			"https://api.example.com/v1/chat/completions?api_key=k%2B1"},
+		{"query key default name", "https://api.example.com", model.CompatibleConfig{AuthScheme: model.CompatibleAuthQuery}, llm.APIFormatOpenAIChatCompletion,
+			"https://api.example.com/v1/chat/completions?key=k%2B1"},
+		{"query key after template query", "https://api.example.com", model.CompatibleConfig{AuthScheme: model.CompatibleAuthQuery, Paths: map[string]string{"chat/completions": "/chat?version=2"}}, llm.APIFormatOpenAIChatCompletion,
+			"https://api.example.com/chat?version=2&key=k%2B1"},
+		{"header auth leaves url alone", "https://api.example.com", model.CompatibleConfig{AuthScheme: model.CompatibleAuthHeader, AuthHeader: "api_key"}, llm.APIFormatOpenAIChatCompletion,
+			"https://api.example.com/v1/chat/completions"},
+	}
+	for _, tt := range tests {
+		channel := model.Channel{BaseURL: tt.base, Key: "k+1", Compatible: tt.config}
+		if got := compatibleRequestURL(channel, tt.format, "m1"); got != tt.want {
+			t.Errorf("%s: compatibleRequestURL() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompatibleAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		config model.CompatibleConfig
+		want   *httpclient.AuthConfig
+	}{
+		{"default bearer", model.CompatibleConfig{}, &httpclient.AuthConfig{Type: httpclient.AuthTypeBearer, APIKey: "k"}},
+		{"bearer", model.CompatibleConfig{AuthScheme: model.CompatibleAuthBearer}, &httpclient.AuthConfig{Type: httpclient.AuthTypeBearer, APIKey: "k"}},
+		{"named header", model.CompatibleConfig{AuthScheme: model.CompatibleAuthHeader, AuthHeader: "X-Api-Key"}, &httpclient.AuthConfig{Type: httpclient.AuthTypeAPIKey, APIKey: "k", HeaderKey: "X-Api-Key"}},
+		{"header without name", model.CompatibleConfig{AuthScheme: model.CompatibleAuthHeader}, &httpclient.AuthConfig{Type: httpclient.AuthTypeAPIKey, APIKey: "k", HeaderKey: "Authorization"}},
+		{"query", model.CompatibleConfig{AuthScheme: model.CompatibleAuthQuery}, nil},
+		{"none", model.CompatibleConfig{AuthScheme: model.CompatibleAuthNone}, nil},
+	}
+	for _, tt := range tests {
+		got := compatibleAuth(model.Channel{Key: "k", Compatible: tt.config})
+		if (got == nil) != (tt.want == nil) || (got != nil && (got.Type != tt.want.Type || got.APIKey != tt.want.APIKey || got.HeaderKey != tt.want.HeaderKey)) {
+			t.Errorf("%s: compatibleAuth() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteCompatibleRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  model.CompatibleConfig
+		url     string
+		headers http.Header // 改写后应有的认证相关请求头, 空值表示不应存在。
+	}{
+		{"bearer", model.CompatibleConfig{}, "https://api.example.com/v1/chat/completions",
+			http.Header{"Authorization": {"Bearer k"}}},
+		{"header", model.CompatibleConfig{AuthScheme: model.CompatibleAuthHeader, AuthHeader: "X-Api-Key"}, "https://api.example.com/v1/chat/completions",
+			http.Header{"Authorization": {""}, "X-Api-Key": {"k"}}},
+		{"query", model.CompatibleConfig{AuthScheme: model.CompatibleAuthQuery, Paths: map[string]string{"chat/completions": "/chat/{model}?v=1"}}, "https://api.example.com/chat/m1?v=1&key=k",
+			http.Header{"Authorization": {""}}},
+		{"none", model.CompatibleConfig{AuthScheme: model.CompatibleAuthNone}, "https://api.example.com/v1/chat/completions",
+			http.Header{"Authorization": {""}}},
+	}
+	for _, tt := range tests {
+		channel := model.Channel{BaseURL: "https://api.example.com", Key: "k", Compatible: tt.config}
+		// 转换得到的请求带有按标准 OpenAI 方式生成的 Bearer 认证, 改写后应被渠道配置的认证取代。
+		request := &httpclient.Request{
+			URL:     "https://api.example.com/v1/chat/completions",
+			Headers: http.Header{"Authorization": {"Bearer k"}, "Content-Type": {"application/json"}},
+			Body:    []byte(`{"model":"m1"}`),
+			Auth:    &httpclient.AuthConfig{Type: httpclient.AuthTypeBearer, APIKey: "k"},
+		}
+		if err := rewriteCompatibleRequest(channel, request); err != nil {
+			t.Errorf("%s: rewriteCompatibleRequest() error = %v", tt.name, err)
+			continue
+		}
+		if request.URL != tt.url {
+			t.Errorf("%s: URL = %q, want %q", tt.name, request.URL, tt.url)
+		}
+		for name, values := range tt.headers {
+			if got := request.Headers.Get(name); got != values[0] {
+				t.Errorf("%s: %s = %q, want %q", tt.name, name, got, values[0])
+			}
+		}
+		if want := compatibleAuth(channel); (request.Auth == nil) != (want == nil) {
+			t.Errorf("%s: Auth = %+v, want %+v", tt.name, request.Auth, want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+// APIFormatOpenAICompletion 是 OpenAI 旧版文本补全接口 /v1/completions 的客户端协议。
+const APIFormatOpenAICompletion llm.APIFormat = "openai/completions"
+
+// completionChatFields 是文本补全请求中可以原样带入 Chat 请求的字段, 其余如 echo, best_of, suffix 在 Chat 中没有对应。
+var completionChatFields = []string{
+	"model", "max_tokens", "temperature", "top_p", "n", "stop", "presence_penalty", "frequency_penalty",
+	"logit_bias", "user", "seed", "stream", "stream_options",
+}
+
+// completionChoice 是文本补全响应和流事件中的单个候选。
+type completionChoice struct {
+	Text         string  `json:"text"`          // 生成的文本, 流事件中为本次增量。
+	Index        int     `json:"index"`         // 候选序号。
+	Logprobs     any     `json:"logprobs"`      // 对数概率, 转换得到的响应中恒为 null。
+	FinishReason *string `json:"finish_reason"` // 结束原因, 流事件中未结束时为 null。
+}
+
+// completionResponse 是文本补全的响应体, 也是流式响应中单个事件的形状。
+type completionResponse struct {
+	ID      string             `json:"id"`              // 响应 ID。
+	Object  string             `json:"object"`          // 固定为 text_completion。
+	Created int64              `json:"created"`         // 创建时间戳。
+	Model   string             `json:"model"`           // 上游实际使用的模型名称。
+	Choices []completionChoice `json:"choices"`         // 生成的候选。
+	Usage   *completionUsage   `json:"usage,omitempty"` // 用量, 流式响应只出现在末尾事件中。
+}
+
+// completionUsage 是文本补全与 Chat 共用的用量形状。
+type completionUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`     // 输入 Token 数。
+	CompletionTokens int64 `json:"completion_tokens"` // 输出 Token 数。
+	TotalTokens      int64 `json:"total_tokens"`      // 总 Token 数。
+}
+
+// llmUsage 转换为统一用量。
+func (u *completionUsage) llmUsage() *llm.Usage {
+	if u == nil {
+		return nil
+	}
+	return &llm.Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
+
+// chatCompletion 是 Chat 响应和流事件中转换为文本补全所需的字段。
+type chatCompletion struct {
+	ID      string `json:"id"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index   int `json:"index"`
+		Message *struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Delta *struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *completionUsage `json:"usage"`
+}
+
+// sendCompletion 请求文本补全: OpenAI 类型渠道原样透传 /completions, 其余渠道先转换为 Chat 请求, 响应再转换回文本补全格式。
+func sendCompletion(ctx context.Context, raw *httpclient.Request, channel model.Channel, streaming bool) (*upstreamResponse, error) {
+	if openAICompatible(channel.Type) {
+		return sendCompletionPassthrough(ctx, raw, channel, streaming)
+	}
+
+	chatRaw, err := completionToChatRequest(raw)
+	if err != nil {
+		return nil, err
+	}
+	modelName, err := requestModel(chatRaw)
+	if err != nil {
+		return nil, err
+	}
+	outbound, _, err := buildOutbound(channel, llm.APIFormatOpenAIChatCompletion, modelName)
+	if err != nil {
+		return nil, err
+	}
+	result, err := sendConverted(ctx, llm.APIFormatOpenAIChatCompletion, chatRaw, channel, outbound, streaming)
+	if err != nil {
+		return nil, err
+	}
+	if streaming {
+		result.convert = chatEventToCompletion
+		if result.first, err = chatEventToCompletion(result.first); err != nil {
+			result.close()
+			return nil, err
+		}
+		return result, nil
+	}
+	if result.body, err = chatToCompletionResponse(result.body); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sendCompletionPassthrough 以同协议透传方式请求 OpenAI 类型渠道的 /completions 接口。
+func sendCompletionPassthrough(ctx context.Context, raw *httpclient.Request, channel model.Channel, streaming bool) (*upstreamResponse, error) {
+	request, err := buildPassthroughRequest(APIFormatOpenAICompletion, raw, channel)
+	if err != nil {
+		return nil, err
+	}
+	if streaming {
+		client, err := channelHTTPClient(channel)
+		if err != nil {
+			return nil, err
+		}
+		return sendPassthroughStream(ctx, APIFormatOpenAICompletion, request, client)
+	}
+
+	response, err := doUnaryRequest(ctx, request, channel)
+	if err != nil {
+		return nil, err
+	}
+	var parsed completionResponse
+	if err := json.Unmarshal(response.Body, &parsed); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, response.Body)
+	}
+	if len(parsed.Choices) == 0 {
+		return nil, fmt.Errorf("upstream completion response has no choices: %s", response.Body)
+	}
+	return &upstreamResponse{body: slices.Clone(response.Body), header: response.Headers.Clone(), usage: parsed.Usage.llmUsage()}, nil
+}
+
+// completionToChatRequest 把文本补全请求转换为单条用户消息的 Chat 请求; Chat 没有批量输入, 多个提示词的请求无法转换。
+func completionToChatRequest(raw *httpclient.Request) (*httpclient.Request, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw.Body, &fields); err != nil {
+		return nil, err
+	}
+	prompt, err := completionPrompt(fields["prompt"])
+	if err != nil {
+		return nil, err
+	}
+
+	chat := make(map[string]any, len(completionChatFields)+1)
+	for _, field := range completionChatFields {
+		if value, ok := fields[field]; ok {
+			chat[field] = value
+		}
+	}
+	chat["messages"] = []map[string]string{{"role": "user", "content": prompt}}
+	body, err := json.Marshal(chat)
+	if err != nil {
+		return nil, err
+	}
+
+	request := *raw
+	request.Headers = raw.Headers.Clone()
+	request.Body = body
+	return &request, nil
+}
+
+// completionPrompt 返回文本补全请求中唯一的文本提示词。
+func completionPrompt(prompt json.RawMessage) (string, error) {
+	var single string
+	if err := json.Unmarshal(prompt, &single); err == nil {
+		return single, nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(prompt, &multiple); err == nil {
+		if len(multiple) == 1 {
+			return multiple[0], nil
+		}
+		return "", errors.New("batched prompts require an openai channel")
+	}
+	return "", errors.New("prompt must be a string to be converted for this channel")
+}
+
+// chatToCompletionResponse 把 Chat 非流式响应转换为文本补全响应。
+func chatToCompletionResponse(body []byte) ([]byte, error) {
+	var chat chatCompletion
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, body)
+	}
+	completion := completionResponse{ID: chat.ID, Object: "text_completion", Created: chat.Created, Model: chat.Model, Usage: chat.Usage}
+	for _, choice := range chat.Choices {
+		text := ""
+		if choice.Message != nil {
+			text = choice.Message.Content
+		}
+		completion.Choices = append(completion.Choices, completionChoice{Text: text, Index: choice.Index, FinishReason: choice.FinishReason})
+	}
+	return json.Marshal(completion)
+}
+
+// chatEventToCompletion 把 Chat 流事件转换为文本补全流事件, 结束标记原样保留。
+func chatEventToCompletion(event *httpclient.StreamEvent) (*httpclient.StreamEvent, error) {
+	if event == nil || len(event.Data) == 0 || bytes.Equal(event.Data, llm.DoneStreamEvent.Data) {
+		return event, nil
+	}
+	var chat chatCompletion
+	if err := json.Unmarshal(event.Data, &chat); err != nil {
+		return nil, fmt.Errorf("decode chat stream event: %w", err)
+	}
+	completion := completionResponse{ID: chat.ID, Object: "text_completion", Created: chat.Created, Model: chat.Model, Choices: []completionChoice{}, Usage: chat.Usage}
+	for _, choice := range chat.Choices {
+		text := ""
+		if choice.Delta != nil {
+			text = choice.Delta.Content
+		}
+		completion.Choices = append(completion.Choices, completionChoice{Text: text, Index: choice.Index, FinishReason: choice.FinishReason})
+	}
+	data, err := json.Marshal(completion)
+	if err != nil {
+		return nil, err
+	}
+	converted := *event
+	converted.Data = data
+	return &converted, nil
+}
+
+// aggregateCompletionChunks 把已转发的文本补全流事件聚合为完整响应, 用于请求日志和用量统计。
+func aggregateCompletionChunks(chunks []*httpclient.StreamEvent) ([]byte, *llm.Usage) {
+	var aggregated completionResponse
+	texts := make(map[int]*bytes.Buffer)
+	finishReasons := make(map[int]*string)
+	for _, chunk := range chunks {
+		if chunk == nil || len(chunk.Data) == 0 || bytes.Equal(chunk.Data, llm.DoneStreamEvent.Data) {
+			continue
+		}
+		var parsed completionResponse
+		if json.Unmarshal(chunk.Data, &parsed) != nil {
+			continue
+		}
+		aggregated.ID, aggregated.Created, aggregated.Model = parsed.ID, parsed.Created, parsed.Model
+		if parsed.Usage != nil {
+			aggregated.Usage = parsed.Usage
+		}
+		for _, choice := range parsed.Choices {
+			if texts[choice.Index] == nil {
+				texts[choice.Index] = &bytes.Buffer{}
+			}
+			texts[choice.Index].WriteString(choice.Text)
+			if choice.FinishReason != nil {
+				finishReasons[choice.Index] = choice.FinishReason
+			}
+		}
+	}
+	aggregated.Object = "text_completion"
+	for index, text := range texts {
+		aggregated.Choices = append(aggregated.Choices, completionChoice{Text: text.String(), Index: index, FinishReason: finishReasons[index]})
+	}
+	slices.SortFunc(aggregated.Choices, func(a, b completionChoice) int { return a.Index - b.Index })
+	body, err := json.Marshal(aggregated)
+	if err != nil {
+		return nil, aggregated.Usage.llmUsage()
+	}
+	return body, aggregated.Usage.llmUsage()
+}
@@ -0,0 +1,132 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/op"
+	"github.com/gin-gonic/gin"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+	"github.com/looplj/axonhub/llm/transformer"
+	"github.com/looplj/axonhub/llm/transformer/anthropic"
+	"github.com/looplj/axonhub/llm/transformer/openai/responses"
+)
+
+const (
+	// APIFormatAnthropicCountTokens 是 Anthropic 统计消息输入 Token 数的接口协议, 请求体与 Messages 接口相同。
+	APIFormatAnthropicCountTokens llm.APIFormat = "anthropic/count_tokens"
+	// APIFormatOpenAIInputTokens 是 OpenAI 统计 Responses 输入 Token 数的接口协议, 请求体与 Responses 接口相同。
+	APIFormatOpenAIInputTokens llm.APIFormat = "openai/input_tokens"
+)
+
+// CountTokens 按客户端协议统计请求的输入 Token 数: 分组当前成员是该协议的原生渠道时转发给上游, 否则在本地估算。
+// Token 计数不产生费用, 不参与故障转移, 也不改变成员的路由状态; 请求照常记入请求日志, 但不计入请求级统计。
+func CountTokens(format llm.APIFormat) gin.HandlerFunc {
+	var inbound transformer.Inbound
+	var native model.ChannelProvider
+	switch format {
+	case APIFormatAnthropicCountTokens:
+		inbound = anthropic.NewInboundTransformer()
+		native = model.ChannelProviderAnthropic
+	default:
+		inbound = responses.NewInboundTransformer()
+		native = model.ChannelProviderOpenAIResponses
+	}
+
+	return func(c *gin.Context) {
+		raw, err := httpclient.ReadHTTPRequest(c.Request)
+		if err != nil {
+			rejectRequest(c, inbound, err)
+			return
+		}
+		var metadata struct {
+			Model string `json:"model"` // 客户端请求的分组名称。
+		}
+		if err := json.Unmarshal(raw.Body, &metadata); err != nil {
+			rejectRequest(c, inbound, err)
+			return
+		}
+		if allowed := c.GetString("supported_models"); allowed != "" && !slices.Contains(strings.Split(allowed, ","), metadata.Model) {
+			rejectRequest(c, inbound, errors.New("model not supported by this api key"))
+			return
+		}
+		group, err := op.GroupGetByName(metadata.Model)
+		if err != nil {
+			rejectRequest(c, inbound, errors.New("model not found"))
+			return
+		}
+
+		request := newRequestState(metadata.Model, string(raw.Body), c.GetInt("api_key_id"), 0, false)
+
+		// 当前成员是原生渠道时由上游给出准确结果; 上游判定请求无效时直接返回, 其余失败回退到本地估算。
+		if item := currentGroupItem(group, format); item.ID != 0 {
+			if channel, err := op.ChannelGet(item.ChannelID); err == nil && channel.Type == native {
+				body, err := forwardCountTokens(c.Request.Context(), request, format, raw, group, item, channel)
+				if err == nil {
+					request.markCommitted(unitUsage{})
+					c.Data(http.StatusOK, "application/json", body)
+					request.markSucceeded(string(body), nil)
+					return
+				}
+				if class, failure := classifyError(err); class == errorClassClient {
+					abortRequest(c, inbound, request, failure.status, errors.New(failure.message()))
+					return
+				}
+			}
+		}
+
+		tokens, err := estimateInputTokens(raw.Body)
+		if err != nil {
+			abortRequest(c, inbound, request, http.StatusBadRequest, err)
+			return
+		}
+		response := map[string]any{"input_tokens": tokens}
+		if format == APIFormatOpenAIInputTokens {
+			response["object"] = "response.input_tokens"
+		}
+		body, err := json.Marshal(response)
+		if err != nil {
+			abortRequest(c, inbound, request, http.StatusInternalServerError, err)
+			return
+		}
+		request.markCommitted(unitUsage{})
+		c.Data(http.StatusOK, "application/json", body)
+		request.markSucceeded(string(body), nil)
+	}
+}
+
+// forwardCountTokens 以同协议透传方式请求成员渠道的 Token 计数接口, 登记为请求的一轮但不计入成员和渠道统计。
+func forwardCountTokens(ctx context.Context, request *RequestState, format llm.APIFormat, raw *httpclient.Request, group model.Group, item model.GroupItem, channel model.Channel) ([]byte, error) {
+	upstreamRaw, err := roundRequest(raw, format, item.ModelName, false)
+	if err != nil {
+		return nil, err
+	}
+	key, err := pickChannelKey(channel)
+	if err != nil {
+		return nil, err
+	}
+	channel.Key = key.value
+
+	timeout := newRoundTimeout(group.RelayConfig, false)
+	roundCtx, cancel := context.WithTimeout(ctx, timeout.timeout)
+	defer cancel()
+	round := request.startRound(cancel, channel, item.ModelName, false)
+
+	upstream, err := buildPassthroughRequest(format, upstreamRaw, channel)
+	if err == nil {
+		var response *httpclient.Response
+		response, err = doUnaryRequest(roundCtx, upstream, channel)
+		if err == nil {
+			request.finishRound(round, "")
+			return slices.Clone(response.Body), nil
+		}
+	}
+	request.finishRound(round, err.Error())
+	return nil, err
+}
@@ -0,0 +1,171 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+// embeddingRequest 是 OpenAI Embedding 请求中需要转换给其他协议的字段。
+type embeddingRequest struct {
+	Model      string          `json:"model"`                // 成员配置的真实模型名称。
+	Input      json.RawMessage `json:"input"`                // 单个字符串或字符串数组形式的输入。
+	Dimensions int             `json:"dimensions,omitempty"` // 期望的向量维度, 0 表示使用模型默认值。
+}
+
+// embeddingResponse 是 OpenAI 格式的 Embedding 响应。
+type embeddingResponse struct {
+	Object string          `json:"object"` // 固定为 list。
+	Data   []embeddingData `json:"data"`   // 与输入顺序一致的向量列表。
+	Model  string          `json:"model"`  // 上游实际使用的模型名称。
+	Usage  struct {
+		PromptTokens int64 `json:"prompt_tokens"` // 输入 Token 数, Embedding 只按输入计费。
+		TotalTokens  int64 `json:"total_tokens"`  // 总 Token 数, 与输入 Token 数相同。
+	} `json:"usage"`
+}
+
+// embeddingData 是 Embedding 响应中的单个向量。
+type embeddingData struct {
+	Object    string          `json:"object"`    // 固定为 embedding。
+	Index     int             `json:"index"`     // 对应输入的序号。
+	Embedding json.RawMessage `json:"embedding"` // 浮点数组或 base64 编码的向量。
+}
+
+// supportsEmbedding 判断渠道类型是否支持 Embedding; 不支持的渠道在选择成员时即被排除, 不作为一轮失败计入成员冷却和统计。
+func supportsEmbedding(provider model.ChannelProvider) bool {
+	switch provider {
+	case model.ChannelProviderOpenAI, model.ChannelProviderOpenAIResponses, model.ChannelProviderAzure, model.ChannelProviderCompatible, model.ChannelProviderOllama, model.ChannelProviderVolcengine, model.ChannelProviderGemini:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendEmbedding 请求渠道的 Embedding 接口, 响应统一为 OpenAI 格式; Embedding 只有输入 Token 计入用量。
+// OpenAI 兼容渠道与火山引擎原样透传, Gemini 渠道转换为 batchEmbedContents 请求, 其余渠道不支持 Embedding。
+func sendEmbedding(ctx context.Context, raw *httpclient.Request, channel model.Channel) (*upstreamResponse, error) {
+	if !supportsEmbedding(channel.Type) {
+		return nil, fmt.Errorf("channel provider %s does not support embeddings", channel.Type)
+	}
+	if channel.Type == model.ChannelProviderGemini {
+		return sendGeminiEmbedding(ctx, raw, channel)
+	}
+	return sendOpenAIEmbedding(ctx, raw, channel)
+}
+
+// sendOpenAIEmbedding 以同协议透传方式请求 OpenAI 兼容的 /embeddings 接口, 并从响应中取得输入用量。
+func sendOpenAIEmbedding(ctx context.Context, raw *httpclient.Request, channel model.Channel) (*upstreamResponse, error) {
+	request, err := buildPassthroughRequest(llm.APIFormatOpenAIEmbedding, raw, channel)
+	if err != nil {
+		return nil, err
+	}
+	response, err := doUnaryRequest(ctx, request, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed embeddingResponse
+	if err := json.Unmarshal(response.Body, &parsed); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, response.Body)
+	}
+	if len(parsed.Data) == 0 {
+		return nil, fmt.Errorf("upstream embedding response has no data: %s", response.Body)
+	}
+	return &upstreamResponse{body: slices.Clone(response.Body), header: response.Headers.Clone(), usage: &llm.Usage{PromptTokens: parsed.Usage.PromptTokens}}, nil
+}
+
+// sendGeminiEmbedding 把 OpenAI Embedding 请求转换为 Gemini batchEmbedContents 请求, 响应再转换回 OpenAI 格式。
+// Gemini 不返回 Embedding 的 Token 用量, 故该渠道的 Embedding 请求只计次数不计费用。
+func sendGeminiEmbedding(ctx context.Context, raw *httpclient.Request, channel model.Channel) (*upstreamResponse, error) {
+	var embedding embeddingRequest
+	if err := json.Unmarshal(raw.Body, &embedding); err != nil {
+		return nil, err
+	}
+	inputs, err := embeddingInputs(embedding.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	type geminiPart struct {
+		Text string `json:"text"`
+	}
+	type geminiContent struct {
+		Parts []geminiPart `json:"parts"`
+	}
+	type geminiEmbedRequest struct {
+		Model                string        `json:"model"`
+		Content              geminiContent `json:"content"`
+		OutputDimensionality int           `json:"outputDimensionality,omitempty"`
+	}
+	requests := make([]geminiEmbedRequest, len(inputs))
+	for i, input := range inputs {
+		requests[i] = geminiEmbedRequest{
+			Model:                "models/" + embedding.Model,
+			Content:              geminiContent{Parts: []geminiPart{{Text: input}}},
+			OutputDimensionality: embedding.Dimensions,
+		}
+	}
+	body, err := json.Marshal(map[string]any{"requests": requests})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := httpclient.FinalizeAuthHeaders(&httpclient.Request{
+		Method:  http.MethodPost,
+		URL:     geminiBaseURL(channel) + "/models/" + embedding.Model + ":batchEmbedContents",
+		Headers: http.Header{"Content-Type": []string{"application/json"}},
+		Body:    body,
+		Auth:    &httpclient.AuthConfig{Type: httpclient.AuthTypeAPIKey, APIKey: channel.Key, HeaderKey: "X-Goog-Api-Key"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := applyChannelConfig(channel, request); err != nil {
+		return nil, err
+	}
+	response, err := doUnaryRequest(ctx, request, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed struct {
+		Embeddings []struct {
+			Values json.RawMessage `json:"values"`
+		} `json:"embeddings"`
+	}
+	if err := json.Unmarshal(response.Body, &parsed); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, response.Body)
+	}
+	if len(parsed.Embeddings) != len(inputs) {
+		return nil, fmt.Errorf("upstream returned %d embeddings for %d inputs: %s", len(parsed.Embeddings), len(inputs), response.Body)
+	}
+	converted := embeddingResponse{Object: "list", Model: embedding.Model, Data: make([]embeddingData, len(parsed.Embeddings))}
+	for i, item := range parsed.Embeddings {
+		converted.Data[i] = embeddingData{Object: "embedding", Index: i, Embedding: item.Values}
+	}
+	out, err := json.Marshal(converted)
+	if err != nil {
+		return nil, err
+	}
+	return &upstreamResponse{body: out}, nil
+}
+
+// embeddingInputs 返回 OpenAI Embedding 请求中的文本输入, 只支持字符串和字符串数组, Token 数组形式无法转换给其他协议。
+func embeddingInputs(input json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(input, &single); err == nil {
+		return []string{single}, nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(input, &multiple); err == nil && len(multiple) > 0 {
+		return multiple, nil
+	}
+	return nil, errors.New("embedding input must be a string or an array of strings")
+}
@@ -0,0 +1,227 @@
+package relay
+
+import (
+	"encoding/json"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/op"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+const (
+	imageTokenEstimate   = 1_000 // 本地估算时单张图片或文件计入的 Token 数, 接近常见分辨率图片的实际消耗。
+	messageTokenEstimate = 4     // 本地估算时每条消息的角色与分隔符开销。
+)
+
+// estimateInputTokens 在本地粗略估算请求体的输入 Token 数, 适用于各客户端协议的 JSON 请求体。
+// 遍历除模型名外的全部字符串: ASCII 字符按 4 个折合 1 Token, 其余字符各计 1 Token; 图片与文件按固定值计入, 每条带角色的消息另计固定开销。
+func estimateInputTokens(body []byte) (int64, error) {
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0, err
+	}
+	if object, ok := payload.(map[string]any); ok {
+		delete(object, "model")
+	}
+	return estimateValueTokens(payload), nil
+}
+
+// estimateValueTokens 递归估算一个 JSON 值的 Token 数。
+func estimateValueTokens(value any) int64 {
+	switch value := value.(type) {
+	case string:
+		return estimateTextTokens(value)
+	case []any:
+		var tokens int64
+		for _, item := range value {
+			tokens += estimateValueTokens(item)
+		}
+		return tokens
+	case map[string]any:
+		if isMediaBlock(value) {
+			return imageTokenEstimate
+		}
+		var tokens int64
+		if _, ok := value["role"]; ok {
+			tokens += messageTokenEstimate
+		}
+		for key, item := range value {
+			// 类型标记不是模型可见的内容。
+			if key == "type" {
+				continue
+			}
+			tokens += estimateValueTokens(item)
+		}
+		return tokens
+	default:
+		return 0
+	}
+}
+
+// isMediaBlock 判断对象是否为图片或文件等以 base64 或地址承载的内容块, 这类内容不能按字符数估算。
+func isMediaBlock(value map[string]any) bool {
+	switch value["type"] {
+	case "image", "image_url", "input_image", "document", "input_file", "file":
+		return true
+	}
+	_, inline := value["inline_data"]
+	_, inlineCamel := value["inlineData"]
+	_, fileData := value["file_data"]
+	_, fileDataCamel := value["fileData"]
+	return inline || inlineCamel || fileData || fileDataCamel
+}
+
+// estimateTextTokens 估算一段文本的 Token 数。
+func estimateTextTokens(text string) int64 {
+	var ascii, other int64
+	for _, r := range text {
+		if r < 0x80 {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// usageEstimate 是转发前按请求体估算的最坏情况用量。
+type usageEstimate struct {
+	inputTokens  int64     // 本地估算的输入 Token 数。
+	outputTokens int64     // 声明的输出上限乘以候选数, 未声明上限时按默认输出预算。
+	units        unitUsage // 按计量单位计费的用量: 声明的图片张数与尺寸, 待合成的字符数。
+	audio        bool      // 请求含时长未知的输入音频, 收费模型上无法估算。
+}
+
+// estimateOutputTokens 读取请求体声明的输出 Token 上限, 兼容 OpenAI Chat 与 Anthropic 的 max_tokens, OpenAI 的 max_completion_tokens,
+// Responses 的 max_output_tokens 与 Gemini 的 generationConfig.maxOutputTokens; 同时声明多个时取最大值, 未声明上限时返回 false。
+func estimateOutputTokens(body []byte) (int64, bool) {
+	var payload struct {
+		MaxTokens           int64 `json:"max_tokens"`
+		MaxCompletionTokens int64 `json:"max_completion_tokens"`
+		MaxOutputTokens     int64 `json:"max_output_tokens"`
+		GenerationConfig    struct {
+			MaxOutputTokens int64 `json:"maxOutputTokens"`
+		} `json:"generationConfig"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0, false
+	}
+	tokens := max(payload.MaxTokens, payload.MaxCompletionTokens, payload.MaxOutputTokens, payload.GenerationConfig.MaxOutputTokens)
+	return tokens, tokens > 0
+}
+
+// estimateChoices 返回请求要求生成的候选数, 兼容 OpenAI 的 n 与文本补全的 best_of, 以及 Gemini 的 generationConfig.candidateCount; 每个候选都按输出上限计费。
+func estimateChoices(body []byte) int64 {
+	var payload struct {
+		N                int64 `json:"n"`
+		BestOf           int64 `json:"best_of"`
+		GenerationConfig struct {
+			CandidateCount int64 `json:"candidateCount"`
+		} `json:"generationConfig"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 1
+	}
+	return max(payload.N, payload.BestOf, payload.GenerationConfig.CandidateCount, 1)
+}
+
+// estimateRequestUsage 按客户端协议估算请求的最坏情况用量, defaultOutput 为请求未声明输出上限时计入的输出 Token 数。
+// 图片请求按声明的张数与尺寸计入, 语音合成按待合成的字符数计入, 语音转写的音频时长无法在本地得知; 请求体无法解析时返回错误。
+func estimateRequestUsage(format llm.APIFormat, raw *httpclient.Request, defaultOutput int64) (usageEstimate, error) {
+	var usage usageEstimate
+	switch format {
+	case APIFormatOpenAIAudioTranscription:
+		usage.audio = true
+		return usage, nil
+	case APIFormatOpenAIAudioSpeech:
+		var speech struct {
+			Input string `json:"input"` // 待合成的文本。
+		}
+		if err := json.Unmarshal(raw.Body, &speech); err != nil {
+			return usage, err
+		}
+		usage.units.characters = int64(utf8.RuneCountInString(speech.Input))
+		return usage, nil
+	case llm.APIFormatOpenAIImageGeneration, APIFormatOpenAIImageEdit:
+		size, err := imageSize(raw)
+		if err != nil {
+			return usage, err
+		}
+		var n string
+		if isMultipart(raw.Headers) {
+			n, err = multipartValue(raw.Headers, raw.Body, "n")
+		} else {
+			var request struct {
+				N json.Number `json:"n"`
+			}
+			err = json.Unmarshal(raw.Body, &request)
+			n = request.N.String()
+			if err == nil {
+				usage.inputTokens, err = estimateInputTokens(raw.Body)
+			}
+		}
+		if err != nil {
+			return usage, err
+		}
+		usage.units.images, usage.units.imageSize = 1, size
+		if count, err := strconv.ParseInt(n, 10, 64); err == nil && count > 1 {
+			usage.units.images = count
+		}
+		return usage, nil
+	}
+
+	inputTokens, err := estimateInputTokens(raw.Body)
+	if err != nil {
+		return usage, err
+	}
+	usage.inputTokens = inputTokens
+	if format == llm.APIFormatOpenAIEmbedding {
+		return usage, nil
+	}
+	outputTokens, declared := estimateOutputTokens(raw.Body)
+	if !declared {
+		outputTokens = defaultOutput
+	}
+	usage.outputTokens = outputTokens * estimateChoices(raw.Body)
+	return usage, nil
+}
+
+// cost 按模型单价计算估算用量的费用, 未乘渠道价格倍率; 用量无法按该模型的价格估算时返回 false:
+// 输入音频的时长与 Token 数都无法在本地得知, 转写请求在收费模型上一律无法估算; 没有单张图片价格而按输出 Token 计费的图片请求同样无法估算。
+func (u usageEstimate) cost(price model.LLMPrice) (float64, bool) {
+	if u.audio && (price.AudioSecond > 0 || price.Input > 0 || price.Output > 0) {
+		return 0, false
+	}
+	imagePrice := price.ImagePrice(u.units.imageSize)
+	if u.units.images > 0 && imagePrice == 0 && price.Output > 0 {
+		return 0, false
+	}
+	cost := (float64(u.inputTokens)*price.Input + float64(u.outputTokens)*price.Output + float64(u.units.characters)*price.Character) / 1_000_000
+	return cost + float64(u.units.images)*imagePrice, true
+}
+
+// estimateRequestCost 估算请求在分组任一成员上可能产生的最高费用, 即各成员按模型单价与渠道价格倍率计算的最大值; 没有价格的成员不计费用。
+// 未声明输出上限的请求按 relay_default_max_output 设置的输出 Token 数估算; 请求体无法解析或任一成员无法估算时返回 false, 由调用方按剩余预算下限处理。
+func estimateRequestCost(format llm.APIFormat, group model.Group, raw *httpclient.Request) (float64, bool) {
+	defaultOutput, _ := op.SettingGetInt(model.SettingKeyRelayDefaultMaxOutput)
+	usage, err := estimateRequestUsage(format, raw, int64(max(defaultOutput, 0)))
+	if err != nil {
+		return 0, false
+	}
+	var cost float64
+	for _, item := range group.Items {
+		price, err := op.LLMGet(item.ModelName)
+		if err != nil {
+			continue
+		}
+		itemCost, ok := usage.cost(price)
+		if !ok {
+			return 0, false
+		}
+		cost = max(cost, itemCost*priceMultiplier(item.ChannelID))
+	}
+	return cost, true
+}
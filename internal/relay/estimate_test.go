@@ -0,0 +1,162 @@
+package relay
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+func TestEstimateInputTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int64
+	}{
+		{"empty object", `{}`, 0},
+		{"model excluded", `{"model":"a-very-long-model-name"}`, 0},
+		{"ascii rounds up", `{"prompt":"hello"}`, 2},
+		{"non-ascii per rune", `{"prompt":"你好"}`, 2},
+		{"message overhead", `{"messages":[{"role":"user","content":"abcd"}]}`, messageTokenEstimate + 1 + 1},
+		{"type marker skipped", `{"content":[{"type":"text","text":"abcd"}]}`, 1},
+		{"image block", `{"content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]}`, imageTokenEstimate},
+		{"gemini inline data", `{"contents":[{"parts":[{"inlineData":{"mimeType":"image/png","data":"AAAA"}}]}]}`, imageTokenEstimate},
+		{"numbers ignored", `{"temperature":0.5,"max_tokens":100}`, 0},
+	}
+	for _, tt := range tests {
+		got, err := estimateInputTokens([]byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: estimateInputTokens() error = %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: estimateInputTokens() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if _, err := estimateInputTokens([]byte("not json")); err == nil {
+		t.Error("estimateInputTokens() on invalid JSON succeeded")
+	}
+}
+
+func TestEstimateOutputTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     int64
+		declared bool
+	}{
+		{"absent", `{"messages":[]}`, 0, false},
+		{"zero", `{"max_tokens":0}`, 0, false},
+		{"anthropic", `{"max_tokens":1024}`, 1024, true},
+		{"openai completion tokens", `{"max_completion_tokens":2048}`, 2048, true},
+		{"responses", `{"max_output_tokens":512}`, 512, true},
+		{"gemini", `{"generationConfig":{"maxOutputTokens":8192}}`, 8192, true},
+		{"largest of several", `{"max_tokens":100,"max_completion_tokens":4000}`, 4000, true},
+		{"largest listed first", `{"max_completion_tokens":4000,"max_tokens":100}`, 4000, true},
+		{"invalid", `[`, 0, false},
+	}
+	for _, tt := range tests {
+		got, declared := estimateOutputTokens([]byte(tt.body))
+		if got != tt.want || declared != tt.declared {
+			t.Errorf("%s: estimateOutputTokens() = %d, %v, want %d, %v", tt.name, got, declared, tt.want, tt.declared)
+		}
+	}
+}
+
+func TestEstimateRequestUsage(t *testing.T) {
+	const defaultOutput = 32000
+	jsonRequest := func(body string) *httpclient.Request {
+		return &httpclient.Request{Headers: http.Header{"Content-Type": {"application/json"}}, Body: []byte(body)}
+	}
+	tests := []struct {
+		name    string
+		format  llm.APIFormat
+		request *httpclient.Request
+		want    usageEstimate
+	}{
+		{"chat without cap uses default", llm.APIFormatOpenAIChatCompletion, jsonRequest(`{"model":"m","messages":[{"role":"user","content":"abcd"}]}`),
+			usageEstimate{inputTokens: 6, outputTokens: defaultOutput}},
+		{"chat with cap and choices", llm.APIFormatOpenAIChatCompletion, jsonRequest(`{"model":"m","n":3,"max_tokens":100,"messages":[{"role":"user","content":"abcd"}]}`),
+			usageEstimate{inputTokens: 6, outputTokens: 300}},
+		{"completion best_of", APIFormatOpenAICompletion, jsonRequest(`{"model":"m","prompt":"abcd","n":2,"best_of":5,"max_tokens":10}`),
+			usageEstimate{inputTokens: 1, outputTokens: 50}},
+		{"gemini candidates", llm.APIFormatGeminiContents, jsonRequest(`{"contents":[{"role":"user","parts":[{"text":"abcd"}]}],"generationConfig":{"candidateCount":2,"maxOutputTokens":64}}`),
+			usageEstimate{inputTokens: 6, outputTokens: 128}},
+		{"embedding has no output", llm.APIFormatOpenAIEmbedding, jsonRequest(`{"model":"m","input":"abcdefgh"}`),
+			usageEstimate{inputTokens: 2}},
+		{"image generation", llm.APIFormatOpenAIImageGeneration, jsonRequest(`{"model":"m","prompt":"abcd","n":4,"size":"1024x1536"}`),
+			usageEstimate{inputTokens: 4, units: unitUsage{images: 4, imageSize: "1024x1536"}}},
+		{"image generation defaults", llm.APIFormatOpenAIImageGeneration, jsonRequest(`{"model":"m","prompt":"abcd","size":"auto"}`),
+			usageEstimate{inputTokens: 2, units: unitUsage{images: 1, imageSize: defaultImageSize}}},
+		{"image edit form", APIFormatOpenAIImageEdit, multipartRequest(t, map[string]string{"model": "m", "prompt": "abcd", "n": "2", "size": "512x512"}),
+			usageEstimate{units: unitUsage{images: 2, imageSize: "512x512"}}},
+		{"speech characters", APIFormatOpenAIAudioSpeech, jsonRequest(`{"model":"m","input":"你好, world"}`),
+			usageEstimate{units: unitUsage{characters: 9}}},
+		{"transcription duration unknown", APIFormatOpenAIAudioTranscription, multipartRequest(t, map[string]string{"model": "m"}),
+			usageEstimate{audio: true}},
+	}
+	for _, tt := range tests {
+		got, err := estimateRequestUsage(tt.format, tt.request, defaultOutput)
+		if err != nil {
+			t.Errorf("%s: estimateRequestUsage() error = %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: estimateRequestUsage() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := estimateRequestUsage(llm.APIFormatOpenAIChatCompletion, jsonRequest(`not json`), defaultOutput); err == nil {
+		t.Error("estimateRequestUsage() on invalid body succeeded")
+	}
+}
+
+func TestUsageEstimateCost(t *testing.T) {
+	tokenPrice := model.LLMPrice{Input: 3, Output: 15}
+	tests := []struct {
+		name   string
+		usage  usageEstimate
+		price  model.LLMPrice
+		want   float64
+		priced bool
+	}{
+		{"tokens", usageEstimate{inputTokens: 1_000_000, outputTokens: 100_000}, tokenPrice, 4.5, true},
+		{"unpriced model", usageEstimate{inputTokens: 1_000_000, outputTokens: 100_000}, model.LLMPrice{}, 0, true},
+		{"images by size", usageEstimate{units: unitUsage{images: 3, imageSize: "1024x1024"}}, model.LLMPrice{Image: 0.04, ImageSizes: map[string]float64{"1024x1024": 0.08}}, 0.24, true},
+		{"token-priced images", usageEstimate{units: unitUsage{images: 1}}, tokenPrice, 0, false},
+		{"speech characters", usageEstimate{units: unitUsage{characters: 2_000_000}}, model.LLMPrice{Character: 15}, 30, true},
+		{"transcription by duration", usageEstimate{audio: true}, model.LLMPrice{AudioSecond: 0.0001}, 0, false},
+		{"transcription by tokens", usageEstimate{audio: true}, tokenPrice, 0, false},
+		{"transcription on unpriced model", usageEstimate{audio: true}, model.LLMPrice{}, 0, true},
+	}
+	for _, tt := range tests {
+		got, priced := tt.usage.cost(tt.price)
+		if priced != tt.priced || (priced && !closeTo(got, tt.want)) {
+			t.Errorf("%s: cost() = %v, %v, want %v, %v", tt.name, got, priced, tt.want, tt.priced)
+		}
+	}
+}
+
+// multipartRequest 构造字段均为文本的 multipart 表单请求。
+func multipartRequest(t *testing.T, fields map[string]string) *httpclient.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &httpclient.Request{Headers: http.Header{"Content-Type": {writer.FormDataContentType()}}, Body: body.Bytes()}
+}
+
+func closeTo(a, b float64) bool {
+	diff := a - b
+	return diff < 1e-9 && diff > -1e-9
+}
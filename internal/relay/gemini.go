@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/bestruirui/octopus/internal/helper"
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+	"github.com/looplj/axonhub/llm/transformer"
+)
+
+// geminiModelPattern 匹配 Gemini 请求路径中的 /models/{model}: 片段。
+var geminiModelPattern = regexp.MustCompile(`/models/[^/:?]+:`)
+
+// geminiAction 解析 Gemini 请求路径最后一段 {model}:{method}, 返回模型名称和是否为流式请求。
+func geminiAction(action string) (string, bool, error) {
+	action = strings.TrimPrefix(action, "/")
+	index := strings.LastIndex(action, ":")
+	if index <= 0 {
+		return "", false, fmt.Errorf("invalid gemini request path: %s", action)
+	}
+	switch action[index+1:] {
+	case "generateContent":
+		return action[:index], false, nil
+	case "streamGenerateContent":
+		return action[:index], true, nil
+	default:
+		return "", false, fmt.Errorf("unsupported gemini method: %s", action[index+1:])
+	}
+}
+
+// geminiRequestAction 从请求地址中取出 {model}:{method} 片段。
+func geminiRequestAction(url string) (string, error) {
+	location := geminiModelPattern.FindStringIndex(url)
+	if location == nil {
+		return "", fmt.Errorf("invalid gemini request path: %s", url)
+	}
+	action := url[location[0]+len("/models/"):]
+	if index := strings.IndexAny(action, "/?"); index >= 0 {
+		action = action[:index]
+	}
+	return action, nil
+}
+
+// setGeminiModel 把 Gemini 请求地址中的模型替换为成员配置的真实模型; Gemini 请求体不含模型字段。
+func setGeminiModel(url, modelName string) string {
+	return geminiModelPattern.ReplaceAllLiteralString(url, "/models/"+modelName+":")
+}
+
+// geminiBaseURL 返回 Gemini 渠道带版本号的基础地址: BaseURL 以 ## 结尾时不追加版本号,
+// 与模型同步一致保留用户显式填写的 /v1, 避免拼成 /v1/v1beta, 其余情况追加 v1beta。
+// Vertex 渠道只需指向接口节点, 实际路径由 vertexTransport 改写。
+func geminiBaseURL(channel model.Channel) string {
+	if channel.Type == model.ChannelProviderVertex {
+		return transformer.NormalizeBaseURL(helper.VertexEndpoint(channel), "v1beta")
+	}
+	if channel.Type == model.ChannelProviderMock {
+		return transformer.NormalizeBaseURL(mockBaseURL, "v1beta")
+	}
+	base := strings.TrimSuffix(channel.BaseURL, "##")
+	if base != channel.BaseURL || strings.HasSuffix(strings.TrimRight(base, "/"), "/v1") {
+		return transformer.NormalizeBaseURL(base, "")
+	}
+	return transformer.NormalizeBaseURL(base, "v1beta")
+}
+
+// buildGeminiPassthroughRequest 构造 Gemini 同协议透传的上游请求, 路径中的模型与方法取自本轮请求地址。
+func buildGeminiPassthroughRequest(raw *httpclient.Request, channel model.Channel) (*httpclient.Request, error) {
+	action, err := geminiRequestAction(raw.URL)
+	if err != nil {
+		return nil, err
+	}
+	// 查询参数经 MergeInboundRequest 透传, 流式请求的 alt=sse 已由转发入口补齐。
+	request := httpclient.MergeInboundRequest(&httpclient.Request{
+		Method:    raw.Method,
+		URL:       geminiBaseURL(channel) + "/models/" + action,
+		Headers:   http.Header{"Content-Type": []string{"application/json"}},
+		Body:      raw.Body,
+		Auth:      &httpclient.AuthConfig{Type: httpclient.AuthTypeAPIKey, APIKey: channel.Key, HeaderKey: "X-Goog-Api-Key"},
+		APIFormat: llm.APIFormatGeminiContents.String(),
+	}, raw)
+	request, err = httpclient.FinalizeAuthHeaders(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyChannelConfig(channel, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
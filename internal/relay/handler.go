@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"slices"
@@ -19,9 +20,9 @@ import (
 	"github.com/looplj/axonhub/llm/httpclient"
 	"github.com/looplj/axonhub/llm/transformer"
 	"github.com/looplj/axonhub/llm/transformer/anthropic"
+	"github.com/looplj/axonhub/llm/transformer/gemini"
 	"github.com/looplj/axonhub/llm/transformer/openai"
 	"github.com/looplj/axonhub/llm/transformer/openai/responses"
-	"github.com/tidwall/sjson"
 )
 
 // Forward 按客户端协议承载一个请求的完整转发过程: 解析请求, 定位分组, 循环选目标请求上游, 直至提交响应或请求结束。
@@ -32,11 +33,20 @@ func Forward(format llm.APIFormat) gin.HandlerFunc {
 		inbound = responses.NewInboundTransformer()
 	case llm.APIFormatAnthropicMessage:
 		inbound = anthropic.NewInboundTransformer()
+	case llm.APIFormatGeminiContents:
+		inbound = gemini.NewInboundTransformer()
 	default:
 		inbound = openai.NewInboundTransformer()
 	}
 
 	return func(c *gin.Context) {
+		// Gemini 流式响应统一以 SSE 返回, 客户端未指定时补齐 alt=sse, 透传和转换均按 SSE 处理。
+		if format == llm.APIFormatGeminiContents && strings.HasSuffix(c.Param("action"), ":streamGenerateContent") {
+			query := c.Request.URL.Query()
+			query.Set("alt", "sse")
+			c.Request.URL.RawQuery = query.Encode()
+		}
+
 		// 完整读取客户端请求, 正文先登记到请求状态, 后续每轮直接改写为当前目标请求。
 		raw, err := httpclient.ReadHTTPRequest(c.Request)
 		if err != nil {
@@ -49,10 +59,29 @@ func Forward(format llm.APIFormat) gin.HandlerFunc {
 			Model     string `json:"model"`  // 客户端请求的分组名称。
 			Streaming bool   `json:"stream"` // 客户端是否请求流式响应。
 		}
-		if err := json.Unmarshal(raw.Body, &metadata); err != nil {
+		switch {
+		case format == llm.APIFormatGeminiContents:
+			// Gemini 协议的模型和是否流式由请求路径 /models/{model}:{method} 给出, 请求体不含这两个字段。
+			metadata.Model, metadata.Streaming, err = geminiAction(c.Param("action"))
+		case isMultipart(raw.Headers):
+			// 上传文件的接口以 multipart 表单提交, 表单字段均为文本。
+			metadata.Model, err = multipartValue(raw.Headers, raw.Body, "model")
+			if err == nil {
+				var stream string
+				stream, err = multipartValue(raw.Headers, raw.Body, "stream")
+				metadata.Streaming = stream == "true"
+			}
+		default:
+			err = json.Unmarshal(raw.Body, &metadata)
+		}
+		if err != nil {
 			rejectRequest(c, inbound, err)
 			return
 		}
+		if metadata.Streaming && !supportsStreaming(format) {
+			rejectRequest(c, inbound, fmt.Errorf("%s does not support streaming", format))
+			return
+		}
 
 		// API Key 限定了模型范围时只放行范围内的模型, 为空表示不限制。
 		if allowed := c.GetString("supported_models"); allowed != "" && !slices.Contains(strings.Split(allowed, ","), metadata.Model) {
@@ -61,16 +90,40 @@ func Forward(format llm.APIFormat) gin.HandlerFunc {
 		}
 
 		// 客户端请求的模型名称即分组名称; 分组不存在说明模型名错误, 等待也不会出现该分组。
-		if _, err := op.GroupGetByName(metadata.Model); err != nil {
+		group, err := op.GroupGetByName(metadata.Model)
+		if err != nil {
 			rejectRequest(c, inbound, errors.New("model not found"))
 			return
 		}
 
+		// API Key 在该分组上的累计配额已用尽时拒绝, 配额不会随时间恢复, 故不附带重试间隔。
+		if err := checkGroupQuota(c.GetInt("api_key_id"), metadata.Model); err != nil {
+			exhaustRequest(c, inbound, err)
+			return
+		}
+
+		// 已记录的费用只反映过去的请求, 按最坏情况估算本次费用, 超出 API Key 剩余预算的请求直接拒绝, 避免单个大请求远超上限。
+		estimatedCost, estimated := estimateRequestCost(format, group, raw)
+		if err := checkEstimatedCost(c.GetInt("api_key_id"), metadata.Model, estimatedCost, estimated); err != nil {
+			exhaustRequest(c, inbound, err)
+			return
+		}
+
+		// 按 API Key 的限流配置放行, 被拒绝的请求不登记状态; 放行的请求占用一个并发名额直至转发结束。
+		release, limited := acquireKeyLimit(c.GetInt("api_key_id"))
+		if limited != nil {
+			throttleRequest(c, inbound, limited)
+			return
+		}
+		defer release()
+
 		// 登记进程内请求状态, 返回的记录是后续全部状态写入和前端可视化推送的入口。
-		request := newRequestState(metadata.Model, string(raw.Body), c.GetInt("api_key_id"))
+		request := newRequestState(metadata.Model, string(raw.Body), c.GetInt("api_key_id"), estimatedCost, true)
 		ctx := c.Request.Context()
 		failedItemID := 0 // 当前累计连续失败次数的成员 ID。
 		failures := 0     // 该成员包含首次请求的连续失败次数。
+		attemptCount := 0 // 本请求已经发起的上游轮次, 含对冲轮次。
+		var lastErr error // 最近一次未能取得响应的原因, 放弃请求时一并记录。
 
 		for {
 			if ctx.Err() != nil {
@@ -78,20 +131,44 @@ func Forward(format llm.APIFormat) gin.HandlerFunc {
 				return
 			}
 
-			// 分组配置和成员随时可改, 故每轮重新读取; 分组被删除时等待它重新出现。
-			group, err := op.GroupGetByName(metadata.Model)
-			if err != nil {
-				if !request.wait(ctx, model.DefaultGroupRelayConfig().MemberRetryIntervalSeconds) {
+			// 分组配置和成员随时可改, 故每轮重新读取; 分组被删除时按全局限制等待它重新出现。
+			group, groupErr := op.GroupGetByName(metadata.Model)
+			config := group.RelayConfig
+			if groupErr != nil {
+				config = model.DefaultGroupRelayConfig()
+				lastErr = errors.New("model not found")
+			}
+			// 总尝试轮数与总等待时间任一耗尽即放弃请求, 以客户端协议的错误格式返回并在请求日志中记录原因。
+			maxAttempts, deadline := relayLimits(config, request.StartedAt)
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				abortRequest(c, inbound, request, http.StatusGatewayTimeout, exhaustedError(fmt.Sprintf("no upstream response within %s", deadline.Sub(request.StartedAt)), lastErr))
+				return
+			}
+			if maxAttempts > 0 && attemptCount >= maxAttempts {
+				abortRequest(c, inbound, request, http.StatusServiceUnavailable, exhaustedError(fmt.Sprintf("no upstream response after %d attempts", attemptCount), lastErr))
+				return
+			}
+			if groupErr != nil {
+				if !request.wait(ctx, config.MemberRetryIntervalSeconds, deadline) {
 					return
 				}
 				continue
 			}
 
-			// 手动模式取人工指定的成员, 故障转移模式按优先级选择未禁用且不在冷却中的成员。
+			// 手动模式取人工指定的成员, 其余模式按各自策略在不处于冷却中的成员里选择。
 			// 没有目标时等待重新选择, 期间人工切换渠道, 补齐成员或成员冷却到期即可让请求继续。
-			item := pickGroupItem(group)
+			item := pickGroupItem(group, format)
 			if item.ID == 0 {
-				if !request.wait(ctx, group.RelayConfig.MemberRetryIntervalSeconds) {
+				// 成员渠道满载时等待名额归还, 名额恢复即可继续, 无需按重试间隔退避。
+				if groupSaturated(group, format) {
+					lastErr = errors.New("all member channels are at capacity")
+					if !request.waitCapacity(ctx, deadline) {
+						return
+					}
+					continue
+				}
+				lastErr = errors.New("no available member in group")
+				if !request.wait(ctx, group.RelayConfig.MemberRetryIntervalSeconds, deadline) {
 					return
 				}
 				continue
@@ -100,108 +177,213 @@ func Forward(format llm.APIFormat) gin.HandlerFunc {
 			// 成员指向的渠道已被删除时同样等待, 该成员可能很快被改回可用渠道。
 			channel, err := op.ChannelGet(item.ChannelID)
 			if err != nil {
-				if !request.wait(ctx, group.RelayConfig.MemberRetryIntervalSeconds) {
+				lastErr = errors.New("channel not found")
+				if !request.wait(ctx, group.RelayConfig.MemberRetryIntervalSeconds, deadline) {
 					return
 				}
 				continue
 			}
 
 			// 将分组成员配置的真实模型写入本轮上游请求。
-			raw.Body, err = sjson.SetBytes(raw.Body, "model", item.ModelName)
+			upstreamRaw, err := roundRequest(raw, format, item.ModelName, metadata.Streaming)
 			if err != nil {
 				request.markFailed(err, "", nil)
 				rejectRequest(c, inbound, err)
 				return
 			}
-			// OpenAI Chat 流式响应需显式要求上游在末尾附带用量。
-			if metadata.Streaming && format == llm.APIFormatOpenAIChatCompletion {
-				raw.Body, err = sjson.SetBytes(raw.Body, "stream_options.include_usage", true)
-				if err != nil {
-					request.markFailed(err, "", nil)
-					rejectRequest(c, inbound, err)
+
+			// 请求上游并等待首个有效响应: 非流式等待完整响应, 流式等待首个事件。
+			// 分组开启对冲时, 首轮在对冲延迟内仍无结果则向下一个可用成员并发第二轮, 先取得可提交响应的一轮胜出。
+			done := make(chan *attempt, 2)
+			first := startAttempt(ctx, request, format, upstreamRaw, group, item, channel, metadata.Streaming, false, done)
+			if first == nil {
+				// 渠道在选中后被并发请求占满, 归还可能占用的探测后与全部渠道满载时同样等待名额归还, 再重新选择时将跳过仍满载的渠道。
+				// 未请求上游故不计入尝试轮数, 总等待时间仍由 deadline 约束。
+				releaseRouteProbe(group, item.ID)
+				lastErr = errors.New("channel is at capacity")
+				if !request.waitCapacity(ctx, deadline) {
 					return
 				}
+				continue
 			}
+			attempts := []*attempt{first}
+			attemptCount++
+			pending := 1
+			var hedgeTimer <-chan time.Time
+			if group.Mode != model.GroupModeManual && group.RelayConfig.HedgeDelayMilliseconds > 0 {
+				hedgeTimer = time.After(time.Duration(group.RelayConfig.HedgeDelayMilliseconds) * time.Millisecond)
+			}
+			var winner *attempt
+			var rejected *upstreamError // 上游判定请求本身无效时的失败, 非空即不再重试。
+			retryNow := false           // 最后一轮失败后是否无需等待立即重新选择目标。
+			for pending > 0 && winner == nil && rejected == nil {
+				select {
+				case <-hedgeTimer:
+					hedgeTimer = nil
+					if maxAttempts > 0 && attemptCount >= maxAttempts {
+						continue
+					}
+					hedgeItem := pickHedgeItem(group, format, item.ID)
+					if hedgeItem.ID == 0 {
+						continue
+					}
+					hedgeChannel, err := op.ChannelGet(hedgeItem.ChannelID)
+					if err != nil {
+						continue
+					}
+					hedgeRaw, err := roundRequest(raw, format, hedgeItem.ModelName, metadata.Streaming)
+					if err != nil {
+						continue
+					}
+					hedgeAttempt := startAttempt(ctx, request, format, hedgeRaw, group, hedgeItem, hedgeChannel, metadata.Streaming, true, done)
+					if hedgeAttempt == nil {
+						continue
+					}
+					attempts = append(attempts, hedgeAttempt)
+					attemptCount++
+					pending++
+				case a := <-done:
+					pending--
+					if a.err == nil {
+						// 记录本轮已经取得可提交的上游响应。
+						request.finishRound(a.round, "")
+						winner = a
+						continue
+					}
+					// 记录本轮上游调用已经结束及其失败原因。
+					request.finishRound(a.round, a.err.Error())
+					// 父上下文结束说明客户端已经取消, 归还探测占用, 其余轮次随之结束后以取消终态结束请求。
+					if ctx.Err() != nil {
+						releaseRouteProbe(group, a.item.ID)
+						continue
+					}
+					// 人工中止的轮次不计失败也不等待, 立即重新选择目标。
+					if a.interrupted() {
+						releaseRouteProbe(group, a.item.ID)
+						retryNow = true
+						continue
+					}
+					a.cancel(nil)
+					lastErr = a.err
+					// 请求本身无效时换成员也不会成功, 不计为渠道故障, 以上游状态码直接返回客户端。
+					class, failure := classifyError(a.err)
+					if class == errorClassClient {
+						rejected = failure
+						continue
+					}
+					// 本轮真实失败和超时只计入该轮渠道和成员, 客户端取消与人工中止不计为渠道故障。
+					a.recordStats(model.StatsMetrics{WaitTime: time.Since(a.startedAt).Milliseconds(), RequestFailed: 1})
 
-			// 为本轮上游调用建立独立取消入口并登记当前目标。
-			roundCtx, cancelRound := context.WithCancel(ctx)
-			request.startRound(cancelRound, channel.Name, item.ModelName)
-
-			// 按渠道协议构造出站转换器并确定是否可以直接透传。
-			roundStartedAt := time.Now() // 本轮上游调用的开始时间, 用于统计首个有效响应耗时。
-			outbound, passthrough, err := buildOutbound(channel, format)
+					// 鉴权失败和限流只说明本轮凭据不可用: 凭据进入冷却, 渠道仍有其他可用凭据时不计成员失败并立即换凭据重试。
+					// 鉴权失败的凭据由 markKeyAuthFailure 决定冷却时间, 渠道最后一个可用凭据只按成员冷却时间冷却; 限流按上游 Retry-After 冷却, 未给出时按成员冷却时间。
+					if a.key != nil && (class == errorClassAuth || (class == errorClassThrottled && failure.status == http.StatusTooManyRequests)) {
+						memberCooldown := time.Duration(group.RelayConfig.MemberCooldownSeconds) * time.Second
+						if class == errorClassAuth {
+							markKeyAuthFailure(a.channel, *a.key, memberCooldown, failure.message())
+						} else {
+							duration := failure.retryAfter
+							if duration == 0 {
+								duration = memberCooldown
+							}
+							markKeyCooldown(a.channel, *a.key, duration, failure.message())
+						}
+						if hasAvailableKey(a.channel) {
+							retryNow = true
+							continue
+						}
+					}
 
-			// 请求上游并等待首个有效响应: 非流式等待完整响应, 流式等待首个事件。
-			// 同协议渠道原样直通, 跨协议渠道经转换后请求; 此时尚未写给客户端, 失败仍可换目标重试。
-			var result *upstreamResponse
-			if err == nil {
-				// 客户端与渠道协议一致时直接透传, 其余组合通过 pipeline 转换。
-				if passthrough {
-					result, err = sendPassthrough(roundCtx, format, raw, channel, outbound, metadata.Streaming)
-				} else {
-					result, err = sendConverted(roundCtx, format, raw, channel, outbound, metadata.Streaming)
+					// 成员改变时重新开始累计该成员在本请求内的连续失败次数。
+					if failedItemID == a.item.ID {
+						failures++
+					} else {
+						failedItemID = a.item.ID
+						failures = 1
+					}
+					// 渠道已无可用凭据时鉴权失败立即冷却成员; 限流与暂不可用按上游 Retry-After 冷却, 未给出时与普通失败相同。
+					var cooldown time.Duration
+					switch class {
+					case errorClassAuth:
+						cooldown = time.Duration(group.RelayConfig.MemberCooldownSeconds) * time.Second
+					case errorClassThrottled:
+						cooldown = failure.retryAfter
+					}
+					// 达到总尝试次数或需要立即冷却时成员进入冷却并立即重新选路, 否则等待后重试。
+					retryNow = recordRouteFailure(group, a.item.ID, failures, cooldown)
 				}
 			}
 
-			if err != nil {
-				// 记录本轮上游调用已经结束及其失败原因。
-				request.finishRound(err.Error())
-				// 父上下文结束说明客户端已经取消, 归还探测占用并以取消终态结束请求。
+			// 胜出或放弃后取消仍在等待的另一轮, 由后台等待其结束并计入统计; 对已经结束的轮次取消不产生影响。
+			if pending > 0 {
+				for _, a := range attempts {
+					if a != winner {
+						a.cancel(errHedgeLost)
+					}
+				}
+				go abandonAttempts(request, group, done, pending)
+			}
+			if rejected != nil {
+				abortRequest(c, inbound, request, rejected.status, errors.New(rejected.message()))
+				return
+			}
+			if winner == nil {
 				if ctx.Err() != nil {
-					releaseRouteProbe(group, item.ID)
 					request.markCanceled(ctx.Err(), "", nil)
 					return
 				}
-				// 仅本轮上下文结束说明该轮被人工中止, 不计失败也不等待, 立即重新选择目标。
-				if roundCtx.Err() != nil {
-					releaseRouteProbe(group, item.ID)
-					continue
-				}
-				cancelRound()
-				// 本轮真实失败只计入当前渠道和成员, 客户端取消与人工中止不计为渠道故障。
-				metrics := model.StatsMetrics{WaitTime: time.Since(roundStartedAt).Milliseconds(), RequestFailed: 1}
-				_ = op.StatsChannelUpdate(channel.ID, metrics)
-				_ = op.StatsModelUpdate(model.StatsModel{ID: item.ID, Name: item.ModelName, ChannelID: channel.ID, StatsMetrics: metrics})
-
-				// 成员改变时重新开始累计该成员在本请求内的连续失败次数。
-				if failedItemID == item.ID {
-					failures++
-				} else {
-					failedItemID = item.ID
-					failures = 1
-				}
-				// 达到总尝试次数时成员进入冷却并立即重新选路, 否则等待后重试。
-				if recordRouteFailure(group, item.ID, failures) {
+				// 尝试轮数已经耗尽时无需等待, 直接回到循环开头放弃请求。
+				if retryNow || (maxAttempts > 0 && attemptCount >= maxAttempts) {
 					continue
 				}
-				if !request.wait(ctx, group.RelayConfig.MemberRetryIntervalSeconds) {
+				if !request.wait(ctx, group.RelayConfig.MemberRetryIntervalSeconds, deadline) {
 					return
 				}
 				continue
 			}
-			// 记录本轮已经取得可提交的上游响应。
-			request.finishRound("")
-			roundWaitTime := time.Since(roundStartedAt).Milliseconds() // 流式响应只统计等待首帧的时间。
-			// 上游成功后解除该成员的冷却与探测占用, 并按路由配置开始亲和。
-			recordRouteSuccess(group, item.ID)
+			item, channel = winner.item, winner.channel
+			result, cancelRound := winner.result, winner.cancel
+			roundWaitTime := time.Since(winner.startedAt).Milliseconds() // 流式响应只统计等待首帧的时间。
+			// 上游成功后解除该成员的冷却与探测占用, 计入延迟估计, 并按路由配置开始亲和。
+			recordRouteSuccess(group, item.ID, roundWaitTime)
 			// 同协议透传时原样返回上游响应头; 跨协议响应没有需要透传的响应头。
 			for key, values := range result.header {
 				c.Writer.Header()[key] = values
 			}
 
+			// 二进制流式响应在取得响应头时即可提交, 正文边读边写给客户端; 计量单位用量在请求时已经确定, 正文不记入请求日志。
+			if result.stream != nil {
+				metrics := usageMetrics(channel.ID, item.ModelName, result.usage, result.units)
+				request.markCommitted(result.units)
+				err := copyFlush(c.Writer, result.stream)
+				result.stream.Close()
+				cancelRound(nil)
+				metrics.WaitTime = roundWaitTime
+				metrics.RequestSuccess = 1
+				winner.recordStats(metrics)
+				if err != nil {
+					if ctx.Err() != nil {
+						request.markCanceled(ctx.Err(), "", result.usage)
+					} else {
+						request.markFailed(err, "", result.usage)
+					}
+					return
+				}
+				request.markSucceeded("", result.usage)
+				return
+			}
+
 			// 非流式响应已经完整取得, 提交后一次写给客户端。
 			if !metadata.Streaming {
-				cancelRound()
+				cancelRound(nil)
 				if c.Writer.Header().Get("Content-Type") == "" {
 					c.Header("Content-Type", "application/json")
 				}
 				// 非流式响应已有完整用量, 本轮渠道和成员统计可在提交前一次完成。
-				metrics := usageMetrics(item.ModelName, result.usage)
+				metrics := usageMetrics(channel.ID, item.ModelName, result.usage, result.units)
 				metrics.WaitTime = roundWaitTime
 				metrics.RequestSuccess = 1
-				_ = op.StatsChannelUpdate(channel.ID, metrics)
-				_ = op.StatsModelUpdate(model.StatsModel{ID: item.ID, Name: item.ModelName, ChannelID: channel.ID, StatsMetrics: metrics})
-				request.markCommitted()
+				winner.recordStats(metrics)
+				request.markCommitted(result.units)
 				n, err := c.Writer.Write(result.body)
 				if err == nil && n != len(result.body) {
 					err = io.ErrShortWrite
@@ -235,7 +417,7 @@ func Forward(format llm.APIFormat) gin.HandlerFunc {
 						break
 					}
 					if !committed {
-						request.markCommitted()
+						request.markCommitted(unitUsage{})
 						committed = true
 					}
 					n, writeErr := c.Writer.Write(encoded.Bytes())
@@ -252,23 +434,29 @@ func Forward(format llm.APIFormat) gin.HandlerFunc {
 					break
 				}
 				event = result.events.Current()
+				if result.convert != nil {
+					if event, err = result.convert(event); err != nil {
+						break
+					}
+				}
 			}
 			if err == nil {
 				err = result.events.Err()
 			}
 			result.events.Close()
-			cancelRound()
-			// 使用客户端协议转换器聚合已转发事件, 统一取得最终响应正文和用量。
-			responseBody, meta, aggregateErr := inbound.AggregateStreamChunks(context.WithoutCancel(ctx), chunks)
-			if aggregateErr == nil {
-				result.usage = meta.Usage
+			cancelRound(nil)
+			// 使用客户端协议转换器聚合已转发事件, 统一取得最终响应正文和用量; 库不支持文本补全协议, 由本包自行聚合。
+			var responseBody []byte
+			if format == APIFormatOpenAICompletion {
+				responseBody, result.usage = aggregateCompletionChunks(chunks)
+			} else if body, meta, aggregateErr := inbound.AggregateStreamChunks(context.WithoutCancel(ctx), chunks); aggregateErr == nil {
+				responseBody, result.usage = body, meta.Usage
 			}
 			// 流式响应结束并聚合出用量后, 完成本轮渠道和成员统计。
-			metrics := usageMetrics(item.ModelName, result.usage)
+			metrics := usageMetrics(channel.ID, item.ModelName, result.usage, unitUsage{})
 			metrics.WaitTime = roundWaitTime
 			metrics.RequestSuccess = 1
-			_ = op.StatsChannelUpdate(channel.ID, metrics)
-			_ = op.StatsModelUpdate(model.StatsModel{ID: item.ID, Name: item.ModelName, ChannelID: channel.ID, StatsMetrics: metrics})
+			winner.recordStats(metrics)
 			if err != nil {
 				if ctx.Err() != nil {
 					request.markCanceled(ctx.Err(), string(responseBody), result.usage)
@@ -283,6 +471,73 @@ func Forward(format llm.APIFormat) gin.HandlerFunc {
 	}
 }
 
+// relayLimits 返回请求生效的总尝试轮数与提交响应的截止时间; 分组未配置时取全局设置, 轮数为 0 或截止时间为零值表示不限制。
+func relayLimits(config model.GroupRelayConfig, startedAt time.Time) (int, time.Time) {
+	maxAttempts := config.MaxTotalAttempts
+	if maxAttempts == 0 {
+		maxAttempts, _ = op.SettingGetInt(model.SettingKeyRelayMaxTotalAttempts)
+	}
+	maxWait := config.MaxTotalWaitSeconds
+	if maxWait == 0 {
+		maxWait, _ = op.SettingGetInt(model.SettingKeyRelayMaxTotalWait)
+	}
+	var deadline time.Time
+	if maxWait > 0 {
+		deadline = startedAt.Add(time.Duration(maxWait) * time.Second)
+	}
+	return max(maxAttempts, 0), deadline
+}
+
+// exhaustedError 组合放弃请求的原因与最近一次未能取得响应的原因。
+func exhaustedError(reason string, lastErr error) error {
+	if lastErr == nil {
+		return errors.New(reason)
+	}
+	return fmt.Errorf("%s: %w", reason, lastErr)
+}
+
+// copyFlush 把上游正文逐块写给客户端并立即刷新, 读取或写入失败时返回原因。
+func copyFlush(writer gin.ResponseWriter, reader io.Reader) error {
+	buffer := make([]byte, 32*1024)
+	for {
+		n, readErr := reader.Read(buffer)
+		if n > 0 {
+			written, err := writer.Write(buffer[:n])
+			if err == nil && written != n {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return err
+			}
+			writer.Flush()
+		}
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// abortRequest 以客户端协议的错误格式结束已登记的请求, 返回给客户端的错误正文同时作为响应体记入请求日志。
+func abortRequest(c *gin.Context, inbound transformer.Inbound, request *RequestState, status int, err error) {
+	errorType := "server_error"
+	switch {
+	case status == http.StatusGatewayTimeout:
+		errorType = "timeout_error"
+	case status < http.StatusInternalServerError:
+		errorType = "invalid_request_error"
+	}
+	response := inbound.TransformError(c.Request.Context(), &llm.ResponseError{
+		StatusCode: status,
+		Detail:     llm.ErrorDetail{Message: err.Error(), Type: errorType},
+	})
+	request.markFailed(err, string(response.Body), nil)
+	c.Data(response.StatusCode, "application/json", response.Body)
+	c.Abort()
+}
+
 // rejectRequest 以客户端协议的错误格式返回请求级失败, 用于尚未登记状态因而无需定稿的请求。
 func rejectRequest(c *gin.Context, inbound transformer.Inbound, err error) {
 	response := inbound.TransformError(c.Request.Context(), &llm.ResponseError{
@@ -292,3 +547,26 @@ func rejectRequest(c *gin.Context, inbound transformer.Inbound, err error) {
 	c.Data(response.StatusCode, "application/json", response.Body)
 	c.Abort()
 }
+
+// throttleRequest 以客户端协议的错误格式返回 API Key 限流拒绝, 并附带 Retry-After 与 x-ratelimit-* 响应头。
+func throttleRequest(c *gin.Context, inbound transformer.Inbound, limited *keyLimitError) {
+	for key, values := range limited.header {
+		c.Writer.Header()[key] = values
+	}
+	response := inbound.TransformError(c.Request.Context(), &llm.ResponseError{
+		StatusCode: http.StatusTooManyRequests,
+		Detail:     llm.ErrorDetail{Code: "rate_limit_exceeded", Message: limited.message, Type: "rate_limit_error"},
+	})
+	c.Data(response.StatusCode, "application/json", response.Body)
+	c.Abort()
+}
+
+// exhaustRequest 以客户端协议的错误格式返回 API Key 分组配额用尽的拒绝。
+func exhaustRequest(c *gin.Context, inbound transformer.Inbound, err error) {
+	response := inbound.TransformError(c.Request.Context(), &llm.ResponseError{
+		StatusCode: http.StatusTooManyRequests,
+		Detail:     llm.ErrorDetail{Code: "insufficient_quota", Message: err.Error(), Type: "insufficient_quota"},
+	})
+	c.Data(response.StatusCode, "application/json", response.Body)
+	c.Abort()
+}
@@ -0,0 +1,484 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/db"
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/op"
+	"github.com/gin-gonic/gin"
+	"github.com/looplj/axonhub/llm"
+)
+
+// testModel 是测试渠道与分组成员使用的上游模型名称。
+const testModel = "mock-model"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dir, err := os.MkdirTemp("", "octopus-relay-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := 1
+	if err := db.InitDB("sqlite", filepath.Join(dir, "octopus.db"), false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else if err := op.InitCache(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		code = m.Run()
+	}
+	_ = db.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testName 返回可用作分组名称的测试名称, 子测试的分隔符替换为 -, 以便出现在 Gemini 请求路径中。
+func testName(t *testing.T) string {
+	return strings.ReplaceAll(t.Name(), "/", "-")
+}
+
+// createMockChannel 创建按 config 应答的模拟渠道, 渠道名称取自测试名称与 name。
+func createMockChannel(t *testing.T, name string, config model.MockConfig) model.Channel {
+	t.Helper()
+	channel := model.Channel{Name: testName(t) + "-" + name, Type: model.ChannelProviderMock, Enabled: true, Model: testModel, Mock: config}
+	if err := op.ChannelCreate(&channel, context.Background()); err != nil {
+		t.Fatalf("ChannelCreate() error = %v", err)
+	}
+	return channel
+}
+
+// createRelayGroup 创建以测试名称命名的分组, 成员按 channels 的顺序依次排列优先级, 返回的分组成员已按优先级排序。
+func createRelayGroup(t *testing.T, mode model.GroupMode, config model.GroupRelayConfig, channels ...model.Channel) model.Group {
+	t.Helper()
+	group := model.Group{Name: testName(t), Mode: mode, RelayConfig: config}
+	for i, channel := range channels {
+		group.Items = append(group.Items, model.GroupItem{ChannelID: channel.ID, ModelName: testModel, Priority: i + 1, Weight: 1})
+	}
+	if err := op.GroupCreate(&group, context.Background()); err != nil {
+		t.Fatalf("GroupCreate() error = %v", err)
+	}
+	created, err := op.GroupGetByName(group.Name)
+	if err != nil {
+		t.Fatalf("GroupGetByName() error = %v", err)
+	}
+	if mode == model.GroupModeManual {
+		updated, err := op.GroupActiveItemUpdate(created.ID, &model.GroupActiveItemUpdateRequest{ItemID: &created.Items[0].ID}, context.Background())
+		if err != nil {
+			t.Fatalf("GroupActiveItemUpdate() error = %v", err)
+		}
+		created = *updated
+	}
+	return created
+}
+
+// serveRelay 以客户端协议 format 把请求交给 Forward 处理并返回完整响应; apiKeyID 为 0 表示请求不属于任何 API Key。
+func serveRelay(format llm.APIFormat, path, body string, apiKeyID int) *httptest.ResponseRecorder {
+	engine := gin.New()
+	route := path
+	if format == llm.APIFormatGeminiContents {
+		route = "/v1beta/models/:action"
+	}
+	engine.POST(route, func(c *gin.Context) { c.Set("api_key_id", apiKeyID) }, Forward(format))
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// chatBody 返回请求分组 group 的 OpenAI Chat 请求体。
+func chatBody(group string, stream bool) string {
+	return fmt.Sprintf(`{"model":%q,"stream":%t,"messages":[{"role":"user","content":"hello mock world"}]}`, group, stream)
+}
+
+// sseEvent 是从响应正文解析出的一个 SSE 事件。
+type sseEvent struct {
+	name string // 事件名, 未声明时为空。
+	data string // 事件数据。
+}
+
+// parseSSE 按空行拆分 SSE 响应正文中的事件。
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if current != (sseEvent{}) {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "event:"):
+			current.name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			current.data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if current != (sseEvent{}) {
+		events = append(events, current)
+	}
+	if len(events) == 0 {
+		t.Fatalf("no SSE events in body: %s", body)
+	}
+	return events
+}
+
+// limitConcurrency 把渠道的并发上限改为 limit。
+func limitConcurrency(t *testing.T, channel model.Channel, limit int) {
+	t.Helper()
+	if _, err := op.ChannelUpdate(&model.ChannelUpdateRequest{ID: channel.ID, MaxConcurrency: &limit}, context.Background()); err != nil {
+		t.Fatalf("ChannelUpdate() error = %v", err)
+	}
+}
+
+// waitFor 轮询 cond 直至其成立, 用于等待后台结束的对冲轮次与名额归还, 超过两秒仍不成立时以 what 报告失败。
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// channelInflight 返回渠道正在进行的上游轮次数。
+func channelInflight(channelID int) int {
+	routeMu.Lock()
+	defer routeMu.Unlock()
+	if load := channelLoads[channelID]; load != nil {
+		return load.inflight
+	}
+	return 0
+}
+
+func TestForwardHedge(t *testing.T) {
+	const hedgeDelay = 100 * time.Millisecond
+	tests := []struct {
+		name   string
+		stream bool
+		slow   model.MockConfig
+	}{
+		{"slow response", false, model.MockConfig{LatencyMilliseconds: 2000}},
+		{"slow first event", true, model.MockConfig{FirstTokenDelayMilliseconds: 2000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slow := createMockChannel(t, "slow", tt.slow)
+			limitConcurrency(t, slow, 1)
+			fast := createMockChannel(t, "fast", model.MockConfig{})
+			config := failoverConfig
+			config.HedgeDelayMilliseconds = int(hedgeDelay.Milliseconds())
+			group := createRelayGroup(t, model.GroupModeFailover, config, slow, fast)
+			apiKey := model.APIKey{Name: testName(t), APIKey: "sk-" + testName(t), Enabled: true}
+			if err := op.APIKeyCreate(&apiKey, context.Background()); err != nil {
+				t.Fatalf("APIKeyCreate() error = %v", err)
+			}
+
+			startedAt := time.Now()
+			recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, tt.stream), apiKey.ID)
+			elapsed := time.Since(startedAt)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+			}
+			// 对冲轮次在延迟到达后才发起, 由其返回的响应不必等待慢成员。
+			if elapsed < hedgeDelay || elapsed >= time.Second {
+				t.Errorf("request took %v, want between the hedge delay %v and the slow member latency", elapsed, hedgeDelay)
+			}
+
+			// 落后一方被取消后归还并发名额, 其失败计入所属渠道但不冷却成员。
+			waitFor(t, "slow channel slot release", func() bool { return channelInflight(slow.ID) == 0 })
+			waitFor(t, "slow channel stats", func() bool { return op.StatsChannelGet(slow.ID).RequestFailed == 1 })
+			if stats := op.StatsChannelGet(fast.ID).StatsMetrics; stats.RequestSuccess != 1 || stats.OutputToken == 0 {
+				t.Errorf("fast channel stats = %+v, want one success with usage", stats)
+			}
+			routeMu.Lock()
+			_, cooling := routes[group.ID].Cooldowns[group.Items[0].ID]
+			routeMu.Unlock()
+			if cooling {
+				t.Error("hedge loser is cooling")
+			}
+
+			// 两轮分别计入渠道, 请求本身只向 API Key 计费一次。
+			if stats := op.StatsAPIKeyGet(apiKey.ID).StatsMetrics; stats.RequestSuccess != 1 || stats.RequestFailed != 0 || stats.OutputToken != op.StatsChannelGet(fast.ID).OutputToken {
+				t.Errorf("api key stats = %+v, want one success billed with the winner usage", stats)
+			}
+		})
+	}
+}
+
+func TestForwardHedgeNotFiredForFastMember(t *testing.T) {
+	first := createMockChannel(t, "first", model.MockConfig{})
+	second := createMockChannel(t, "second", model.MockConfig{})
+	config := failoverConfig
+	config.HedgeDelayMilliseconds = 500
+	group := createRelayGroup(t, model.GroupModeFailover, config, first, second)
+
+	if recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, false), 0); recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	// 首轮在对冲延迟内完成, 等过延迟后第二个成员仍未被请求。
+	time.Sleep(600 * time.Millisecond)
+	if stats := op.StatsChannelGet(first.ID).StatsMetrics; stats.RequestSuccess != 1 {
+		t.Errorf("first channel stats = %+v, want one success", stats)
+	}
+	if stats := op.StatsChannelGet(second.ID).StatsMetrics; stats != (model.StatsMetrics{}) {
+		t.Errorf("second channel stats = %+v, want untouched", stats)
+	}
+}
+
+// decodeErrorDetail 解析 OpenAI 格式的错误响应。
+func decodeErrorDetail(t *testing.T, recorder *httptest.ResponseRecorder) llm.ErrorDetail {
+	t.Helper()
+	var body struct {
+		Error llm.ErrorDetail `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error body %s: %v", recorder.Body, err)
+	}
+	return body.Error
+}
+
+func TestForwardAttemptCap(t *testing.T) {
+	channels := []model.Channel{
+		createMockChannel(t, "first", model.MockConfig{FailureStatus: http.StatusInternalServerError}),
+		createMockChannel(t, "second", model.MockConfig{FailureStatus: http.StatusInternalServerError}),
+		createMockChannel(t, "third", model.MockConfig{}),
+	}
+	config := failoverConfig
+	config.MaxTotalAttempts = 2
+	group := createRelayGroup(t, model.GroupModeFailover, config, channels...)
+
+	recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, false), 0)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, body = %s, want 503", recorder.Code, recorder.Body)
+	}
+	if detail := decodeErrorDetail(t, recorder); !strings.Contains(detail.Message, "after 2 attempts") || detail.Type != "server_error" {
+		t.Errorf("error = %+v, want attempt cap reported as server_error", detail)
+	}
+	// 用完两轮后放弃, 第三个成员不再被请求。
+	if stats := op.StatsChannelGet(channels[2].ID).StatsMetrics; stats != (model.StatsMetrics{}) {
+		t.Errorf("third channel stats = %+v, want untouched", stats)
+	}
+}
+
+func TestForwardWaitDeadline(t *testing.T) {
+	failing := createMockChannel(t, "failing", model.MockConfig{FailureStatus: http.StatusInternalServerError})
+	config := failoverConfig
+	config.MaxTotalWaitSeconds = 1
+	group := createRelayGroup(t, model.GroupModeFailover, config, failing)
+
+	// 唯一成员失败后进入冷却, 请求等待可用成员直至总等待时间耗尽。
+	startedAt := time.Now()
+	recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, false), 0)
+	elapsed := time.Since(startedAt)
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, body = %s, want 504", recorder.Code, recorder.Body)
+	}
+	if elapsed < time.Second || elapsed >= 2*time.Second {
+		t.Errorf("request took %v, want about the 1s wait limit", elapsed)
+	}
+	if detail := decodeErrorDetail(t, recorder); !strings.Contains(detail.Message, "no available member in group") || detail.Type != "timeout_error" {
+		t.Errorf("error = %+v, want the deadline reported as timeout_error with the last failure", detail)
+	}
+}
+
+func TestForwardFirstEventTimeout(t *testing.T) {
+	stalled := createMockChannel(t, "stalled", model.MockConfig{FirstTokenDelayMilliseconds: 3000})
+	healthy := createMockChannel(t, "healthy", model.MockConfig{})
+	config := failoverConfig
+	config.MemberStreamFirstEventTimeoutSeconds = 1
+	group := createRelayGroup(t, model.GroupModeFailover, config, stalled, healthy)
+
+	// 首个成员已返回响应头但迟迟没有首个事件, 超时后本轮失败并转向下一个成员。
+	startedAt := time.Now()
+	recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, true), 0)
+	elapsed := time.Since(startedAt)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	if elapsed < time.Second || elapsed >= 3*time.Second {
+		t.Errorf("request took %v, want about the 1s first-event timeout", elapsed)
+	}
+	if events := parseSSE(t, recorder.Body.String()); events[len(events)-1].data != "[DONE]" {
+		t.Errorf("last event = %+v, want [DONE]", events[len(events)-1])
+	}
+	waitFor(t, "stalled channel slot release", func() bool { return channelInflight(stalled.ID) == 0 })
+	if stats := op.StatsChannelGet(stalled.ID).StatsMetrics; stats.RequestFailed != 1 || stats.RequestSuccess != 0 {
+		t.Errorf("stalled channel stats = %+v, want one failure", stats)
+	}
+	if stats := op.StatsChannelGet(healthy.ID).StatsMetrics; stats.RequestSuccess != 1 {
+		t.Errorf("healthy channel stats = %+v, want one success", stats)
+	}
+	routeMu.Lock()
+	_, cooling := routes[group.ID].Cooldowns[group.Items[0].ID]
+	routeMu.Unlock()
+	if !cooling {
+		t.Error("timed out member not cooling")
+	}
+}
+
+// holdChannelSlot 占满并发上限为 1 的渠道, 返回归还名额的函数。
+func holdChannelSlot(t *testing.T, channelID int) context.CancelFunc {
+	t.Helper()
+	channel, err := op.ChannelGet(channelID)
+	if err != nil {
+		t.Fatalf("ChannelGet() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if !acquireChannelSlot(ctx, channel) {
+		cancel()
+		t.Fatal("acquireChannelSlot() on an idle channel failed")
+	}
+	t.Cleanup(cancel)
+	return cancel
+}
+
+func TestForwardSkipsFullChannel(t *testing.T) {
+	full := createMockChannel(t, "full", model.MockConfig{})
+	limitConcurrency(t, full, 1)
+	spare := createMockChannel(t, "spare", model.MockConfig{})
+	group := createRelayGroup(t, model.GroupModeFailover, failoverConfig, full, spare)
+	release := holdChannelSlot(t, full.ID)
+
+	// 首选成员的渠道满载, 请求直接由下一个成员承担, 满载成员不计失败也不冷却。
+	if recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, false), 0); recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	if stats := op.StatsChannelGet(full.ID).StatsMetrics; stats != (model.StatsMetrics{}) {
+		t.Errorf("full channel stats = %+v, want untouched", stats)
+	}
+	if stats := op.StatsChannelGet(spare.ID).StatsMetrics; stats.RequestSuccess != 1 {
+		t.Errorf("spare channel stats = %+v, want one success", stats)
+	}
+	routeMu.Lock()
+	_, cooling := routes[group.ID].Cooldowns[group.Items[0].ID]
+	routeMu.Unlock()
+	if cooling {
+		t.Error("full member is cooling")
+	}
+
+	// 名额归还后首选成员恢复承担请求。
+	release()
+	waitFor(t, "full channel slot release", func() bool { return channelInflight(full.ID) == 0 })
+	if recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, false), 0); recorder.Code != http.StatusOK {
+		t.Fatalf("status after release = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	if stats := op.StatsChannelGet(full.ID).StatsMetrics; stats.RequestSuccess != 1 {
+		t.Errorf("full channel stats after release = %+v, want one success", stats)
+	}
+}
+
+func TestForwardWaitsForChannelSlot(t *testing.T) {
+	const holdFor = 200 * time.Millisecond
+	full := createMockChannel(t, "full", model.MockConfig{})
+	limitConcurrency(t, full, 1)
+	group := createRelayGroup(t, model.GroupModeFailover, failoverConfig, full)
+	release := holdChannelSlot(t, full.ID)
+
+	// 唯一成员的渠道满载时请求等待名额, 名额归还即被唤醒, 无需等到下一次定期检查。
+	time.AfterFunc(holdFor, release)
+	startedAt := time.Now()
+	recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, false), 0)
+	elapsed := time.Since(startedAt)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	if elapsed < holdFor || elapsed >= capacityRecheck {
+		t.Errorf("request took %v, want to resume right after the slot is released at %v", elapsed, holdFor)
+	}
+	if stats := op.StatsChannelGet(full.ID).StatsMetrics; stats.RequestSuccess != 1 || stats.RequestFailed != 0 {
+		t.Errorf("channel stats = %+v, want one success", stats)
+	}
+}
+
+func TestForwardEmbeddingSkipsUnsupportedMember(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/embeddings") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"model":"mock-model","usage":{"prompt_tokens":3,"total_tokens":3}}`)
+	}))
+	defer upstream.Close()
+	// 首选成员是不支持 Embedding 的模拟渠道, 此前它会作为一轮失败进入冷却。
+	unsupported := createMockChannel(t, "unsupported", model.MockConfig{})
+	supported := model.Channel{Name: testName(t) + "-supported", Type: model.ChannelProviderOpenAI, Enabled: true, BaseURL: upstream.URL, Key: "sk-test", Model: testModel}
+	if err := op.ChannelCreate(&supported, context.Background()); err != nil {
+		t.Fatalf("ChannelCreate() error = %v", err)
+	}
+	group := createRelayGroup(t, model.GroupModeFailover, failoverConfig, unsupported, supported)
+
+	body := fmt.Sprintf(`{"model":%q,"input":"hello"}`, group.Name)
+	recorder := serveRelay(llm.APIFormatOpenAIEmbedding, "/v1/embeddings", body, 0)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	// 不支持的成员在选择时即被跳过, 不计失败也不冷却, 聊天请求仍按原顺序选中它。
+	if stats := op.StatsChannelGet(unsupported.ID).StatsMetrics; stats != (model.StatsMetrics{}) {
+		t.Errorf("unsupported channel stats = %+v, want untouched", stats)
+	}
+	if stats := op.StatsChannelGet(supported.ID).StatsMetrics; stats.RequestSuccess != 1 || stats.InputToken != 3 {
+		t.Errorf("supported channel stats = %+v, want one success with 3 input tokens", stats)
+	}
+	routeMu.Lock()
+	_, cooling := routes[group.ID].Cooldowns[group.Items[0].ID]
+	routeMu.Unlock()
+	if cooling {
+		t.Error("unsupported member is cooling")
+	}
+	if item := pickGroupItem(group, llm.APIFormatOpenAIChatCompletion); item.ID != group.Items[0].ID {
+		t.Errorf("chat pick = %d, want the first member %d", item.ID, group.Items[0].ID)
+	}
+
+	// 被排除的成员仍保留聊天请求留下的路由状态。
+	until := time.Now().Add(time.Minute).UnixMilli()
+	routeMu.Lock()
+	routes[group.ID].Cooldowns[group.Items[0].ID] = until
+	routeMu.Unlock()
+	if recorder := serveRelay(llm.APIFormatOpenAIEmbedding, "/v1/embeddings", body, 0); recorder.Code != http.StatusOK {
+		t.Fatalf("second request status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	routeMu.Lock()
+	deadline := routes[group.ID].Cooldowns[group.Items[0].ID]
+	routeMu.Unlock()
+	if deadline != until {
+		t.Errorf("cooldown of the skipped member = %d, want %d kept", deadline, until)
+	}
+}
+
+func TestForwardEmbeddingWithoutSupportedMember(t *testing.T) {
+	unsupported := createMockChannel(t, "unsupported", model.MockConfig{})
+	config := failoverConfig
+	config.MaxTotalWaitSeconds = 1
+	group := createRelayGroup(t, model.GroupModeFailover, config, unsupported)
+
+	// 没有成员支持 Embedding 时按没有可用成员等待至总等待时间耗尽, 成员本身不被计为故障。
+	body := fmt.Sprintf(`{"model":%q,"input":"hello"}`, group.Name)
+	recorder := serveRelay(llm.APIFormatOpenAIEmbedding, "/v1/embeddings", body, 0)
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, body = %s, want 504", recorder.Code, recorder.Body)
+	}
+	if detail := decodeErrorDetail(t, recorder); !strings.Contains(detail.Message, "no available member in group") {
+		t.Errorf("error = %+v, want no available member", detail)
+	}
+	if stats := op.StatsChannelGet(unsupported.ID).StatsMetrics; stats != (model.StatsMetrics{}) {
+		t.Errorf("unsupported channel stats = %+v, want untouched", stats)
+	}
+}
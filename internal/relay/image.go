@@ -0,0 +1,99 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+	"github.com/looplj/axonhub/llm/httpclient"
+)
+
+// APIFormatOpenAIImageEdit 是 OpenAI 图片编辑接口的客户端协议, 请求体为上传原图和蒙版的 multipart 表单。
+// 图片生成沿用库中的 llm.APIFormatOpenAIImageGeneration, 库未定义编辑接口, 故在此补充。
+const APIFormatOpenAIImageEdit llm.APIFormat = "openai/image_edit"
+
+// defaultImageSize 是请求未指定尺寸或指定 auto 时计费使用的尺寸键, 对应价格表中的默认图片价格。
+const defaultImageSize = ""
+
+// imageResponse 是 OpenAI 图片接口响应中计费所需的字段。
+type imageResponse struct {
+	Data  []json.RawMessage `json:"data"` // 生成的图片, 每项为一张图片的地址或 base64 内容。
+	Usage *struct {
+		InputTokens  int64 `json:"input_tokens"`  // 提示词与输入图片的 Token 数。
+		OutputTokens int64 `json:"output_tokens"` // 生成图片的 Token 数。
+	} `json:"usage"`
+}
+
+// sendImage 以同协议透传方式请求渠道的图片生成或编辑接口, 按返回的图片张数和请求的尺寸计费。
+// OpenAI 兼容渠道同时支持生成和编辑, 火山引擎只支持生成, 其余渠道不支持图片接口。
+func sendImage(ctx context.Context, format llm.APIFormat, raw *httpclient.Request, channel model.Channel) (*upstreamResponse, error) {
+	switch {
+	case openAICompatible(channel.Type):
+	case channel.Type == model.ChannelProviderVolcengine && format == llm.APIFormatOpenAIImageGeneration:
+	default:
+		return nil, fmt.Errorf("channel provider %s does not support %s", channel.Type, format)
+	}
+
+	size, err := imageSize(raw)
+	if err != nil {
+		return nil, err
+	}
+	request, err := buildPassthroughRequest(format, raw, channel)
+	if err != nil {
+		return nil, err
+	}
+	response, err := doUnaryRequest(ctx, request, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed imageResponse
+	if err := json.Unmarshal(response.Body, &parsed); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, response.Body)
+	}
+	if len(parsed.Data) == 0 {
+		return nil, fmt.Errorf("upstream image response has no data: %s", response.Body)
+	}
+	// 按 Token 计费的图片模型同时返回 Token 用量, 一并记入统计; 价格表中的 Token 单价与图片价格按需配置其一即可。
+	var usage *llm.Usage
+	if parsed.Usage != nil {
+		usage = &llm.Usage{
+			PromptTokens:     parsed.Usage.InputTokens,
+			CompletionTokens: parsed.Usage.OutputTokens,
+			TotalTokens:      parsed.Usage.InputTokens + parsed.Usage.OutputTokens,
+		}
+	}
+	return &upstreamResponse{
+		body:   slices.Clone(response.Body),
+		header: response.Headers.Clone(),
+		usage:  usage,
+		units:  unitUsage{images: int64(len(parsed.Data)), imageSize: size},
+	}, nil
+}
+
+// imageSize 返回请求的图片尺寸, 未指定或为 auto 时返回默认尺寸键。
+func imageSize(raw *httpclient.Request) (string, error) {
+	var size string
+	if isMultipart(raw.Headers) {
+		value, err := multipartValue(raw.Headers, raw.Body, "size")
+		if err != nil {
+			return "", err
+		}
+		size = value
+	} else {
+		var request struct {
+			Size string `json:"size"`
+		}
+		if err := json.Unmarshal(raw.Body, &request); err != nil {
+			return "", err
+		}
+		size = request.Size
+	}
+	if size == "auto" {
+		return defaultImageSize, nil
+	}
+	return size, nil
+}
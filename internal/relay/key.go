@@ -0,0 +1,163 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/op"
+)
+
+// brokenKeyRecheck 是鉴权失败的凭据再次放行一轮请求验证的间隔; 修改凭据内容会立即解除失效标记。
+const brokenKeyRecheck = 10 * time.Minute
+
+// channelKey 是本轮选中的渠道凭据。
+type channelKey struct {
+	id    int    // 凭据 ID, 0 表示渠道主凭据。
+	value string // 凭据内容。
+}
+
+// keyRef 标识一个渠道凭据。
+type keyRef struct {
+	channelID int // 所属渠道 ID。
+	keyID     int // 凭据 ID, 0 表示渠道主凭据。
+}
+
+// keyState 是一个处于冷却中的渠道凭据。
+type keyState struct {
+	value  string    // 进入冷却时的凭据内容, 凭据被修改后冷却自动失效。
+	until  time.Time // 冷却截止时间。
+	broken bool      // 凭据是否因鉴权失败被判定失效。
+	reason string    // 上游给出的拒绝原因。
+}
+
+var (
+	keyMu      sync.Mutex                  // keyMu 保护凭据冷却状态和轮询位置。
+	keyStates  = make(map[keyRef]keyState) // keyStates 保存处于冷却中的凭据。
+	keyCursors = make(map[int]int)         // keyCursors 保存轮询策略下各渠道下一次选择的位置。
+)
+
+// channelKeys 返回渠道的全部凭据, 主凭据在前, 内容为空的凭据被忽略。
+func channelKeys(channel model.Channel) []channelKey {
+	keys := make([]channelKey, 0, len(channel.Keys)+1)
+	if channel.Key != "" {
+		keys = append(keys, channelKey{value: channel.Key})
+	}
+	for _, key := range channel.Keys {
+		if key.Key != "" {
+			keys = append(keys, channelKey{id: key.ID, value: key.Key})
+		}
+	}
+	return keys
+}
+
+// availableKeysLocked 返回渠道当前未冷却的凭据, 并清理已到期或凭据已被修改的冷却记录; 调用方必须持有锁。
+func availableKeysLocked(channel model.Channel, keys []channelKey) []channelKey {
+	now := time.Now()
+	available := make([]channelKey, 0, len(keys))
+	for _, key := range keys {
+		ref := keyRef{channelID: channel.ID, keyID: key.id}
+		state, cooling := keyStates[ref]
+		if cooling && (state.value != key.value || !state.until.After(now)) {
+			delete(keyStates, ref)
+			cooling = false
+		}
+		if !cooling {
+			available = append(available, key)
+		}
+	}
+	return available
+}
+
+// pickChannelKey 按渠道的凭据策略选择本轮凭据; 渠道未配置凭据时返回空凭据交由上游判定。
+// 全部凭据都在冷却时返回按冷却原因分类的错误, 本轮不再请求上游: 全部因鉴权失败冷却时按鉴权失败处理, 否则按限流处理并以最早恢复的时间作为 Retry-After。
+func pickChannelKey(channel model.Channel) (channelKey, error) {
+	keys := channelKeys(channel)
+	if len(keys) == 0 {
+		return channelKey{}, nil
+	}
+
+	keyMu.Lock()
+	defer keyMu.Unlock()
+
+	available := availableKeysLocked(channel, keys)
+	if len(available) == 0 {
+		status := http.StatusUnauthorized
+		var soonest keyState
+		for _, key := range keys {
+			state := keyStates[keyRef{channelID: channel.ID, keyID: key.id}]
+			if !state.broken {
+				status = http.StatusTooManyRequests
+			}
+			if soonest.until.IsZero() || state.until.Before(soonest.until) {
+				soonest = state
+			}
+		}
+		return channelKey{}, &upstreamError{
+			status:     status,
+			retryAfter: time.Until(soonest.until),
+			err:        fmt.Errorf("all channel keys are cooling down: %s", soonest.reason),
+		}
+	}
+
+	if channel.KeyStrategy == model.ChannelKeyStrategyLeastUsed {
+		used := make(map[int]int64, len(keys))
+		for _, stats := range op.StatsChannelKeyList(channel.ID) {
+			used[stats.KeyID] = stats.RequestSuccess + stats.RequestFailed
+		}
+		picked := available[0]
+		for _, key := range available[1:] {
+			if used[key.id] < used[picked.id] {
+				picked = key
+			}
+		}
+		return picked, nil
+	}
+
+	cursor := keyCursors[channel.ID]
+	keyCursors[channel.ID] = cursor + 1
+	return available[cursor%len(available)], nil
+}
+
+// markKeyCooldown 让限流的渠道凭据冷却 duration; 已在冷却中的凭据只会延长冷却。
+func markKeyCooldown(channel model.Channel, key channelKey, duration time.Duration, reason string) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+
+	markKeyCooldownLocked(channel, key, duration, false, reason)
+}
+
+// markKeyAuthFailure 让鉴权失败的渠道凭据进入冷却: 渠道仍有其他可用凭据时标记失效, 在 brokenKeyRecheck 后才再次验证;
+// 它已是渠道最后一个可用凭据时, 一次鉴权失败也可能是上游偶发的错误, 只按 cooldown 短暂冷却而不标记失效, 以免单凭据渠道整段停用。
+func markKeyAuthFailure(channel model.Channel, key channelKey, cooldown time.Duration, reason string) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+
+	for _, other := range availableKeysLocked(channel, channelKeys(channel)) {
+		if other.id != key.id {
+			markKeyCooldownLocked(channel, key, brokenKeyRecheck, true, reason)
+			return
+		}
+	}
+	markKeyCooldownLocked(channel, key, cooldown, false, reason)
+}
+
+// markKeyCooldownLocked 让渠道凭据冷却 duration, broken 表示凭据已被判定失效; 已在冷却中的凭据只会延长冷却; 调用方必须持有锁。
+func markKeyCooldownLocked(channel model.Channel, key channelKey, duration time.Duration, broken bool, reason string) {
+	ref := keyRef{channelID: channel.ID, keyID: key.id}
+	until := time.Now().Add(duration)
+	if state, cooling := keyStates[ref]; cooling && state.value == key.value && state.until.After(until) {
+		return
+	}
+	keyStates[ref] = keyState{value: key.value, until: until, broken: broken, reason: reason}
+}
+
+// hasAvailableKey 判断渠道是否仍有未冷却的凭据可供下一轮使用。
+func hasAvailableKey(channel model.Channel) bool {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+
+	return len(availableKeysLocked(channel, channelKeys(channel))) > 0
+}
@@ -0,0 +1,97 @@
+package relay
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+)
+
+// cleanupKeys 在测试结束时清除渠道的凭据冷却状态与轮询位置。
+func cleanupKeys(t *testing.T, channelID int) {
+	t.Cleanup(func() {
+		keyMu.Lock()
+		defer keyMu.Unlock()
+		for ref := range keyStates {
+			if ref.channelID == channelID {
+				delete(keyStates, ref)
+			}
+		}
+		delete(keyCursors, channelID)
+	})
+}
+
+// keyCooldown 返回凭据的冷却状态。
+func keyCooldown(channelID, keyID int) (keyState, bool) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	state, cooling := keyStates[keyRef{channelID: channelID, keyID: keyID}]
+	return state, cooling
+}
+
+func TestMarkKeyAuthFailureSingleKey(t *testing.T) {
+	const cooldown = time.Minute
+	channel := model.Channel{ID: 9101, Key: "only"}
+	cleanupKeys(t, channel.ID)
+
+	// 唯一凭据鉴权失败只按成员冷却时间冷却, 不被判定失效。
+	key, err := pickChannelKey(channel)
+	if err != nil {
+		t.Fatalf("pickChannelKey() error = %v", err)
+	}
+	markKeyAuthFailure(channel, key, cooldown, "invalid api key")
+	state, cooling := keyCooldown(channel.ID, 0)
+	if !cooling || state.broken {
+		t.Fatalf("state = %+v, cooling %v, want a cooldown that is not broken", state, cooling)
+	}
+	if remaining := time.Until(state.until); remaining > cooldown || remaining < cooldown-time.Second {
+		t.Errorf("cooldown remaining = %v, want about %v", remaining, cooldown)
+	}
+
+	// 冷却期间渠道没有可用凭据, 按限流处理并在冷却结束后恢复。
+	_, err = pickChannelKey(channel)
+	var failure *upstreamError
+	if !errors.As(err, &failure) || failure.status != http.StatusTooManyRequests || failure.retryAfter > cooldown {
+		t.Errorf("pickChannelKey() while cooling error = %v, want 429 within the cooldown", err)
+	}
+	keyMu.Lock()
+	state = keyStates[keyRef{channelID: channel.ID}]
+	state.until = time.Now().Add(-time.Millisecond)
+	keyStates[keyRef{channelID: channel.ID}] = state
+	keyMu.Unlock()
+	if key, err := pickChannelKey(channel); err != nil || key.value != "only" {
+		t.Errorf("pickChannelKey() after cooldown = %+v, %v, want the key back", key, err)
+	}
+}
+
+func TestMarkKeyAuthFailureMultipleKeys(t *testing.T) {
+	const cooldown = time.Minute
+	channel := model.Channel{ID: 9102, Key: "primary", Keys: []model.ChannelKey{{ID: 7, Key: "extra"}}}
+	cleanupKeys(t, channel.ID)
+	primary, extra := channelKey{value: "primary"}, channelKey{id: 7, value: "extra"}
+
+	// 还有其他可用凭据时, 鉴权失败的凭据被判定失效, 到 brokenKeyRecheck 后才再次验证。
+	markKeyAuthFailure(channel, primary, cooldown, "invalid api key")
+	state, cooling := keyCooldown(channel.ID, primary.id)
+	if !cooling || !state.broken || time.Until(state.until) <= cooldown {
+		t.Fatalf("primary state = %+v, cooling %v, want broken until the recheck", state, cooling)
+	}
+	if !hasAvailableKey(channel) {
+		t.Fatal("no key available after one of two keys failed")
+	}
+
+	// 剩下的最后一个凭据再失败时只短暂冷却。
+	markKeyAuthFailure(channel, extra, cooldown, "invalid api key")
+	state, cooling = keyCooldown(channel.ID, extra.id)
+	if !cooling || state.broken || time.Until(state.until) > cooldown {
+		t.Errorf("extra state = %+v, cooling %v, want a short cooldown that is not broken", state, cooling)
+	}
+
+	// 已失效的凭据不会被后来的短暂冷却缩短。
+	markKeyAuthFailure(channel, primary, cooldown, "invalid api key")
+	if state, _ := keyCooldown(channel.ID, primary.id); !state.broken || time.Until(state.until) <= cooldown {
+		t.Errorf("primary state after another failure = %+v, want still broken until the recheck", state)
+	}
+}
@@ -0,0 +1,245 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/op"
+)
+
+// rateLimitWindow 是 API Key 请求数与 Token 数限流的滑动窗口长度。
+const rateLimitWindow = time.Minute
+
+// concurrencyRetryAfter 是并发数超限时建议客户端的重试间隔; 在途请求何时结束无法预知。
+const concurrencyRetryAfter = time.Second
+
+// tokenCharge 是一个已结束请求计入 Token 限流的实际用量。
+type tokenCharge struct {
+	at     time.Time // 请求结束时间。
+	tokens int64     // 输入与输出 Token 之和。
+}
+
+// keyLimiter 是一个 API Key 的限流状态。
+type keyLimiter struct {
+	inflight int           // 已放行且尚未结束的请求数。
+	requests []time.Time   // 窗口内放行请求的时间, 按时间先后排列。
+	charges  []tokenCharge // 窗口内计入的 Token 用量, 按时间先后排列。
+}
+
+// keyLimitError 是 API Key 超出限流配置的拒绝, header 为返回客户端的 Retry-After 与 x-ratelimit-* 响应头。
+type keyLimitError struct {
+	message string      // 拒绝原因。
+	header  http.Header // 限流响应头。
+}
+
+var (
+	limitMu     sync.Mutex                  // limitMu 保护 API Key 限流状态。
+	keyLimiters = make(map[int]*keyLimiter) // keyLimiters 按 API Key ID 保存限流状态。
+)
+
+// acquireKeyLimit 按 API Key 的每分钟请求数, 每分钟 Token 数与并发数配置判断是否放行请求, 放行后返回请求结束时必须调用的释放函数。
+// Token 数只能在请求结束后计入, 故只判断窗口内已计入的用量是否达到上限; 未配置任何限流项的 API Key 不记录状态。
+func acquireKeyLimit(apiKeyID int) (func(), *keyLimitError) {
+	apiKey, err := op.APIKeyGet(apiKeyID, context.Background())
+	if err != nil || !apiKey.RateLimited() {
+		return func() {}, nil
+	}
+
+	limitMu.Lock()
+	defer limitMu.Unlock()
+
+	limiter := keyLimiters[apiKeyID]
+	if limiter == nil {
+		limiter = &keyLimiter{}
+		keyLimiters[apiKeyID] = limiter
+	}
+	if limited := limiter.admit(apiKey, time.Now()); limited != nil {
+		return nil, limited
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			limitMu.Lock()
+			defer limitMu.Unlock()
+			limiter.inflight--
+		})
+	}, nil
+}
+
+// admit 在 now 时刻按 API Key 的限流配置判断是否放行一个请求, 放行时登记该请求并占用一个并发名额, 拒绝时不改变状态; 调用方必须持有锁。
+func (l *keyLimiter) admit(apiKey model.APIKey, now time.Time) *keyLimitError {
+	l.prune(now)
+
+	header := http.Header{}
+	var reasons []string
+	var retryAfter time.Duration
+	if apiKey.MaxRPM > 0 {
+		used := len(l.requests)
+		var reset time.Duration
+		if used >= apiKey.MaxRPM {
+			// 窗口内超出上限的部分依次过期后才能再放行一个请求。
+			reset = l.requests[used-apiKey.MaxRPM].Add(rateLimitWindow).Sub(now)
+			reasons = append(reasons, fmt.Sprintf("%d requests per minute", apiKey.MaxRPM))
+			retryAfter = max(retryAfter, reset)
+		}
+		setRateLimitHeader(header, "requests", int64(apiKey.MaxRPM), int64(apiKey.MaxRPM-used), reset)
+	}
+	if apiKey.MaxTPM > 0 {
+		var used int64
+		for _, charge := range l.charges {
+			used += charge.tokens
+		}
+		var reset time.Duration
+		if used >= apiKey.MaxTPM {
+			// 最早的用量依次过期, 直到窗口内用量低于上限。
+			remaining := used
+			for _, charge := range l.charges {
+				remaining -= charge.tokens
+				if remaining < apiKey.MaxTPM {
+					reset = charge.at.Add(rateLimitWindow).Sub(now)
+					break
+				}
+			}
+			reasons = append(reasons, fmt.Sprintf("%d tokens per minute", apiKey.MaxTPM))
+			retryAfter = max(retryAfter, reset)
+		}
+		setRateLimitHeader(header, "tokens", apiKey.MaxTPM, apiKey.MaxTPM-used, reset)
+	}
+	if apiKey.MaxConcurrency > 0 {
+		var reset time.Duration
+		if l.inflight >= apiKey.MaxConcurrency {
+			reset = concurrencyRetryAfter
+			reasons = append(reasons, fmt.Sprintf("%d concurrent requests", apiKey.MaxConcurrency))
+			retryAfter = max(retryAfter, reset)
+		}
+		setRateLimitHeader(header, "concurrency", int64(apiKey.MaxConcurrency), int64(apiKey.MaxConcurrency-l.inflight), reset)
+	}
+	if len(reasons) > 0 {
+		header.Set("Retry-After", strconv.FormatInt(max(ceilSeconds(retryAfter), 1), 10))
+		return &keyLimitError{message: "api key rate limit exceeded: " + strings.Join(reasons, ", "), header: header}
+	}
+
+	if apiKey.MaxRPM > 0 {
+		l.requests = append(l.requests, now)
+	}
+	l.inflight++
+	return nil
+}
+
+// chargeKeyTokens 把已结束请求的实际 Token 用量计入 API Key 的每分钟 Token 数; 未配置 Token 限流的 API Key 不记录。
+func chargeKeyTokens(apiKeyID int, tokens int64) {
+	if tokens <= 0 {
+		return
+	}
+	apiKey, err := op.APIKeyGet(apiKeyID, context.Background())
+	if err != nil || apiKey.MaxTPM <= 0 {
+		return
+	}
+
+	limitMu.Lock()
+	defer limitMu.Unlock()
+
+	limiter := keyLimiters[apiKeyID]
+	if limiter == nil {
+		limiter = &keyLimiter{}
+		keyLimiters[apiKeyID] = limiter
+	}
+	limiter.charges = append(limiter.charges, tokenCharge{at: time.Now(), tokens: tokens})
+}
+
+// checkGroupQuota 按 API Key 在分组上的累计配额判断是否放行请求, 用量以该 API Key 请求此分组的累计统计为准; 未配置配额的分组不限制。
+// 用量只在请求结束后计入, 故并发请求可能使累计用量略超配额。
+func checkGroupQuota(apiKeyID int, group string) error {
+	apiKey, err := op.APIKeyGet(apiKeyID, context.Background())
+	if err != nil {
+		return nil
+	}
+	quota, ok := apiKey.GroupQuotas[group]
+	if !ok {
+		return nil
+	}
+	stats := op.StatsAPIKeyModelGet(apiKeyID, group)
+	if quota.MaxCost > 0 && stats.InputCost+stats.OutputCost >= quota.MaxCost {
+		return fmt.Errorf("api key has exhausted its cost quota for model %s", group)
+	}
+	if quota.MaxTokens > 0 && stats.InputToken+stats.OutputToken >= quota.MaxTokens {
+		return fmt.Errorf("api key has exhausted its token quota for model %s", group)
+	}
+	return nil
+}
+
+// remainingBudget 返回 API Key 在分组上剩余可用的费用, 取累计费用上限, 当前周期预算与该分组费用配额三者剩余的最小值; 均未配置时返回 false。
+func remainingBudget(apiKeyID int, group string) (float64, bool) {
+	apiKey, err := op.APIKeyGet(apiKeyID, context.Background())
+	if err != nil {
+		return 0, false
+	}
+	remaining, limited := math.Inf(1), false
+	if apiKey.MaxCost > 0 {
+		stats := op.StatsAPIKeyGet(apiKeyID)
+		remaining, limited = min(remaining, apiKey.MaxCost-stats.InputCost-stats.OutputCost), true
+	}
+	if apiKey.BudgetPeriod != "" && apiKey.BudgetCost > 0 {
+		if period, err := op.StatsAPIKeyPeriodGet(apiKey); err == nil {
+			remaining, limited = min(remaining, apiKey.BudgetCost-period.InputCost-period.OutputCost), true
+		}
+	}
+	if quota, ok := apiKey.GroupQuotas[group]; ok && quota.MaxCost > 0 {
+		stats := op.StatsAPIKeyModelGet(apiKeyID, group)
+		remaining, limited = min(remaining, quota.MaxCost-stats.InputCost-stats.OutputCost), true
+	}
+	return max(remaining, 0), limited
+}
+
+// checkEstimatedCost 按转发前估算的最坏情况费用判断 API Key 的剩余预算是否足够; 无法估算的请求要求剩余预算不低于 relay_unestimated_budget 设置的下限。
+func checkEstimatedCost(apiKeyID int, group string, cost float64, estimated bool) error {
+	remaining, limited := remainingBudget(apiKeyID, group)
+	if !limited {
+		return nil
+	}
+	if estimated {
+		if cost > remaining {
+			return fmt.Errorf("estimated cost %.6f exceeds the remaining budget %.6f of this api key", cost, remaining)
+		}
+		return nil
+	}
+	minimum, _ := op.SettingGetFloat(model.SettingKeyRelayUnestimatedBudget)
+	if remaining < minimum {
+		return fmt.Errorf("cost of this request cannot be estimated and the remaining budget %.6f of this api key is below %.6f", remaining, minimum)
+	}
+	return nil
+}
+
+// prune 移除已经滑出窗口的请求与 Token 用量。
+func (l *keyLimiter) prune(now time.Time) {
+	start := now.Add(-rateLimitWindow)
+	index := 0
+	for index < len(l.requests) && !l.requests[index].After(start) {
+		index++
+	}
+	l.requests = l.requests[index:]
+	index = 0
+	for index < len(l.charges) && !l.charges[index].at.After(start) {
+		index++
+	}
+	l.charges = l.charges[index:]
+}
+
+// setRateLimitHeader 写入一个限流项的 x-ratelimit-limit, remaining 与 reset 响应头, reset 为恢复放行所需的秒数。
+func setRateLimitHeader(header http.Header, name string, limit, remaining int64, reset time.Duration) {
+	header.Set("X-Ratelimit-Limit-"+name, strconv.FormatInt(limit, 10))
+	header.Set("X-Ratelimit-Remaining-"+name, strconv.FormatInt(max(remaining, 0), 10))
+	header.Set("X-Ratelimit-Reset-"+name, strconv.FormatInt(ceilSeconds(reset), 10)+"s")
+}
+
+// ceilSeconds 把时长向上取整为秒数。
+func ceilSeconds(duration time.Duration) int64 {
+	return int64(math.Ceil(duration.Seconds()))
+}
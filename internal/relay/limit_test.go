@@ -0,0 +1,127 @@
+package relay
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+)
+
+func TestKeyLimiterRequestsPerMinute(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	apiKey := model.APIKey{MaxRPM: 3}
+	limiter := &keyLimiter{}
+	for i := range 3 {
+		if limited := limiter.admit(apiKey, start.Add(time.Duration(i)*10*time.Second)); limited != nil {
+			t.Fatalf("request %d rejected: %s", i, limited.message)
+		}
+	}
+
+	// 第四个请求在首个请求发出后 25 秒到达, 需等首个请求滑出窗口, 即再过 35 秒。
+	limited := limiter.admit(apiKey, start.Add(25*time.Second))
+	if limited == nil {
+		t.Fatal("fourth request within the window admitted")
+	}
+	if got := limited.header.Get("Retry-After"); got != "35" {
+		t.Errorf("Retry-After = %s, want 35", got)
+	}
+	if got := limited.header.Get("X-Ratelimit-Remaining-Requests"); got != "0" {
+		t.Errorf("X-Ratelimit-Remaining-Requests = %s, want 0", got)
+	}
+	if got := limited.header.Get("X-Ratelimit-Reset-Requests"); got != "35s" {
+		t.Errorf("X-Ratelimit-Reset-Requests = %s, want 35s", got)
+	}
+	if len(limiter.requests) != 3 || limiter.inflight != 3 {
+		t.Errorf("rejected request changed state: %d requests, %d in flight", len(limiter.requests), limiter.inflight)
+	}
+
+	// 恰好一分钟后首个请求滑出窗口。
+	if limited := limiter.admit(apiKey, start.Add(time.Minute)); limited != nil {
+		t.Fatalf("request after the first expired rejected: %s", limited.message)
+	}
+	if len(limiter.requests) != 3 {
+		t.Errorf("window holds %d requests, want 3", len(limiter.requests))
+	}
+}
+
+func TestKeyLimiterTokensPerMinute(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	apiKey := model.APIKey{MaxTPM: 1000}
+	limiter := &keyLimiter{charges: []tokenCharge{
+		{at: start, tokens: 600},
+		{at: start.Add(20 * time.Second), tokens: 300},
+		{at: start.Add(30 * time.Second), tokens: 200},
+	}}
+
+	// 窗口内已计入 1100, 最早的 600 过期后降到 500, 低于上限。
+	limited := limiter.admit(apiKey, start.Add(40*time.Second))
+	if limited == nil {
+		t.Fatal("request over the token limit admitted")
+	}
+	if !strings.Contains(limited.message, "1000 tokens per minute") {
+		t.Errorf("message = %s", limited.message)
+	}
+	if got := limited.header.Get("Retry-After"); got != "20" {
+		t.Errorf("Retry-After = %s, want 20", got)
+	}
+	if got := limited.header.Get("X-Ratelimit-Remaining-Tokens"); got != "0" {
+		t.Errorf("X-Ratelimit-Remaining-Tokens = %s, want 0", got)
+	}
+
+	if limited := limiter.admit(apiKey, start.Add(time.Minute)); limited != nil {
+		t.Fatalf("request after the largest charge expired rejected: %s", limited.message)
+	}
+	if len(limiter.charges) != 2 {
+		t.Errorf("window holds %d charges, want 2", len(limiter.charges))
+	}
+}
+
+func TestKeyLimiterConcurrency(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	apiKey := model.APIKey{MaxConcurrency: 2}
+	limiter := &keyLimiter{}
+	for range 2 {
+		if limited := limiter.admit(apiKey, now); limited != nil {
+			t.Fatalf("request within concurrency rejected: %s", limited.message)
+		}
+	}
+	limited := limiter.admit(apiKey, now)
+	if limited == nil {
+		t.Fatal("request over concurrency admitted")
+	}
+	if got := limited.header.Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %s, want 1", got)
+	}
+	// 并发限流不记录请求时间。
+	if len(limiter.requests) != 0 {
+		t.Errorf("concurrency-only limiter recorded %d requests", len(limiter.requests))
+	}
+
+	limiter.inflight--
+	if limited := limiter.admit(apiKey, now); limited != nil {
+		t.Fatalf("request after release rejected: %s", limited.message)
+	}
+}
+
+func TestKeyLimiterReportsAllExceededLimits(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	apiKey := model.APIKey{MaxRPM: 1, MaxTPM: 10, MaxConcurrency: 1}
+	limiter := &keyLimiter{
+		inflight: 1,
+		requests: []time.Time{now.Add(-50 * time.Second)},
+		charges:  []tokenCharge{{at: now.Add(-15 * time.Second), tokens: 10}},
+	}
+	limited := limiter.admit(apiKey, now)
+	if limited == nil {
+		t.Fatal("request over every limit admitted")
+	}
+	want := "api key rate limit exceeded: 1 requests per minute, 10 tokens per minute, 1 concurrent requests"
+	if limited.message != want {
+		t.Errorf("message = %s, want %s", limited.message, want)
+	}
+	// 取各项中最长的等待时间。
+	if got := limited.header.Get("Retry-After"); got != "45" {
+		t.Errorf("Retry-After = %s, want 45", got)
+	}
+}
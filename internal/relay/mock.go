@@ -0,0 +1,365 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+)
+
+// mockBaseURL 是模拟渠道请求使用的占位地址, 请求由 mockTransport 在进程内应答, 不会真正访问。
+const mockBaseURL = "http://mock.octopus.invalid"
+
+// mockProtocol 是模拟渠道原生应答的上游协议。
+type mockProtocol int
+
+const (
+	mockProtocolOpenAI    mockProtocol = iota // OpenAI Chat Completions。
+	mockProtocolAnthropic                     // Anthropic Messages。
+	mockProtocolGemini                        // Gemini generateContent。
+)
+
+// mockTransport 按渠道的模拟配置在进程内应答 OpenAI Chat, Anthropic Messages 和 Gemini 请求, 响应和流事件与真实上游形状一致。
+// 用量按请求体的本地估算和回复文本计算; 延迟和失败注入让故障转移, 冷却与亲和行为可以不依赖真实上游地端到端验证。
+type mockTransport struct {
+	config model.MockConfig // 模拟渠道的应答配置。
+}
+
+func (t *mockTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+	protocol, modelName, streaming, err := mockRequestShape(request.URL.Path, body)
+	if err != nil {
+		return nil, err
+	}
+	ctx := request.Context()
+	if err := mockSleep(ctx, t.config.LatencyMilliseconds); err != nil {
+		return nil, err
+	}
+	if status := t.failureStatus(); status != 0 {
+		return mockResponse(request, status, "application/json", io.NopCloser(bytes.NewReader(mockErrorBody(protocol, status)))), nil
+	}
+
+	text := t.reply(body)
+	prompt, _ := estimateInputTokens(body)
+	completion := estimateTextTokens(text)
+	usage := completionUsage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+	if !streaming {
+		return mockResponse(request, http.StatusOK, "application/json", io.NopCloser(bytes.NewReader(mockBody(protocol, modelName, text, usage)))), nil
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(t.stream(ctx, writer, protocol, modelName, text, usage))
+	}()
+	return mockResponse(request, http.StatusOK, "text/event-stream", reader), nil
+}
+
+// failureStatus 按失败注入配置决定本次请求是否失败, 返回失败的状态码, 0 表示成功。
+func (t *mockTransport) failureStatus() int {
+	status := t.config.FailureStatus
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	switch {
+	case t.config.FailureRate > 0:
+		if rand.Float64() < t.config.FailureRate {
+			return status
+		}
+		return 0
+	case t.config.FailureStatus != 0:
+		return status
+	default:
+		return 0
+	}
+}
+
+// reply 返回本次应答的文本: fixed 方式为配置的文本, echo 方式为最后一条用户消息的文本。
+func (t *mockTransport) reply(body []byte) string {
+	if t.config.Mode == model.MockModeFixed {
+		return t.config.Text
+	}
+	var request struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"` // OpenAI 与 Anthropic 的消息。
+		Contents []struct {
+			Role  string `json:"role"`
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"contents"` // Gemini 的消息。
+	}
+	if json.Unmarshal(body, &request) != nil {
+		return ""
+	}
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role != "user" {
+			continue
+		}
+		content := request.Messages[i].Content
+		var text string
+		if json.Unmarshal(content, &text) == nil {
+			return text
+		}
+		var blocks []struct {
+			Text string `json:"text"`
+		}
+		_ = json.Unmarshal(content, &blocks)
+		var builder strings.Builder
+		for _, block := range blocks {
+			builder.WriteString(block.Text)
+		}
+		return builder.String()
+	}
+	for i := len(request.Contents) - 1; i >= 0; i-- {
+		if request.Contents[i].Role != "user" && request.Contents[i].Role != "" {
+			continue
+		}
+		var builder strings.Builder
+		for _, part := range request.Contents[i].Parts {
+			builder.WriteString(part.Text)
+		}
+		return builder.String()
+	}
+	return ""
+}
+
+// stream 按协议逐个写出流事件: 首个事件前等待配置的首字延迟, 回复文本按词拆分为多个增量事件。
+func (t *mockTransport) stream(ctx context.Context, writer io.Writer, protocol mockProtocol, modelName, text string, usage completionUsage) error {
+	if err := mockSleep(ctx, t.config.FirstTokenDelayMilliseconds); err != nil {
+		return err
+	}
+	pieces := strings.SplitAfter(text, " ")
+	id := mockResponseID(protocol)
+	created := time.Now().Unix()
+	write := func(eventType string, data any) error {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if eventType != "" {
+			_, err = fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", eventType, encoded)
+		} else {
+			_, err = fmt.Fprintf(writer, "data: %s\n\n", encoded)
+		}
+		return err
+	}
+
+	switch protocol {
+	case mockProtocolAnthropic:
+		start := mockAnthropicMessage(id, modelName, nil, nil, completionUsage{PromptTokens: usage.PromptTokens})
+		if err := write("message_start", map[string]any{"type": "message_start", "message": start}); err != nil {
+			return err
+		}
+		if err := write("content_block_start", map[string]any{"type": "content_block_start", "index": 0, "content_block": map[string]string{"type": "text", "text": ""}}); err != nil {
+			return err
+		}
+		for _, piece := range pieces {
+			if err := write("content_block_delta", map[string]any{"type": "content_block_delta", "index": 0, "delta": map[string]string{"type": "text_delta", "text": piece}}); err != nil {
+				return err
+			}
+		}
+		if err := write("content_block_stop", map[string]any{"type": "content_block_stop", "index": 0}); err != nil {
+			return err
+		}
+		delta := map[string]any{"stop_reason": "end_turn", "stop_sequence": nil}
+		if err := write("message_delta", map[string]any{"type": "message_delta", "delta": delta, "usage": map[string]int64{"output_tokens": usage.CompletionTokens}}); err != nil {
+			return err
+		}
+		if err := write("message_stop", map[string]string{"type": "message_stop"}); err != nil {
+			return err
+		}
+	case mockProtocolGemini:
+		for i, piece := range pieces {
+			candidate := map[string]any{"content": map[string]any{"role": "model", "parts": []map[string]string{{"text": piece}}}, "index": 0}
+			chunk := map[string]any{"candidates": []any{candidate}, "modelVersion": modelName}
+			if i == len(pieces)-1 {
+				candidate["finishReason"] = "STOP"
+				chunk["usageMetadata"] = mockGeminiUsage(usage)
+			}
+			if err := write("", chunk); err != nil {
+				return err
+			}
+		}
+	default:
+		for i, piece := range pieces {
+			delta := &openAIChatMessage{Content: piece}
+			if i == 0 {
+				delta.Role = "assistant"
+			}
+			if err := write("", openAIChatResponse{ID: id, Object: "chat.completion.chunk", Created: created, Model: modelName, Choices: []openAIChatChoice{{Delta: delta}}}); err != nil {
+				return err
+			}
+		}
+		finishReason := "stop"
+		if err := write("", openAIChatResponse{ID: id, Object: "chat.completion.chunk", Created: created, Model: modelName, Choices: []openAIChatChoice{{Delta: &openAIChatMessage{}, FinishReason: &finishReason}}}); err != nil {
+			return err
+		}
+		if err := write("", openAIChatResponse{ID: id, Object: "chat.completion.chunk", Created: created, Model: modelName, Choices: []openAIChatChoice{}, Usage: &usage}); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(writer, "data: [DONE]\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mockRequestShape 由请求路径和请求体识别请求的协议, 模型和是否流式。
+func mockRequestShape(path string, body []byte) (mockProtocol, string, bool, error) {
+	if geminiModelPattern.MatchString(path) {
+		action, err := geminiRequestAction(path)
+		if err != nil {
+			return 0, "", false, err
+		}
+		modelName, streaming, err := geminiAction(action)
+		return mockProtocolGemini, modelName, streaming, err
+	}
+	var protocol mockProtocol
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		protocol = mockProtocolOpenAI
+	case strings.HasSuffix(path, "/messages"):
+		protocol = mockProtocolAnthropic
+	default:
+		return 0, "", false, fmt.Errorf("mock channel does not support %s", path)
+	}
+	var metadata struct {
+		Model  string `json:"model"`  // 请求的模型。
+		Stream bool   `json:"stream"` // 是否流式。
+	}
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return 0, "", false, err
+	}
+	return protocol, metadata.Model, metadata.Stream, nil
+}
+
+// mockBody 返回协议对应的非流式响应体。
+func mockBody(protocol mockProtocol, modelName, text string, usage completionUsage) []byte {
+	var response any
+	switch protocol {
+	case mockProtocolAnthropic:
+		stopReason := "end_turn"
+		response = mockAnthropicMessage(mockResponseID(protocol), modelName, []map[string]string{{"type": "text", "text": text}}, &stopReason, usage)
+	case mockProtocolGemini:
+		response = map[string]any{
+			"candidates":    []any{map[string]any{"content": map[string]any{"role": "model", "parts": []map[string]string{{"text": text}}}, "finishReason": "STOP", "index": 0}},
+			"usageMetadata": mockGeminiUsage(usage),
+			"modelVersion":  modelName,
+		}
+	default:
+		finishReason := "stop"
+		response = openAIChatResponse{
+			ID:      mockResponseID(protocol),
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   modelName,
+			Choices: []openAIChatChoice{{Message: &openAIChatMessage{Role: "assistant", Content: text}, FinishReason: &finishReason}},
+			Usage:   &usage,
+		}
+	}
+	body, _ := json.Marshal(response)
+	return body
+}
+
+// mockAnthropicMessage 返回 Anthropic 消息对象, 流式的 message_start 事件中内容为空, 结束原因为 null。
+func mockAnthropicMessage(id, modelName string, content []map[string]string, stopReason *string, usage completionUsage) map[string]any {
+	if content == nil {
+		content = []map[string]string{}
+	}
+	return map[string]any{
+		"id":            id,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         modelName,
+		"content":       content,
+		"stop_reason":   stopReason,
+		"stop_sequence": nil,
+		"usage":         map[string]int64{"input_tokens": usage.PromptTokens, "output_tokens": usage.CompletionTokens},
+	}
+}
+
+// mockGeminiUsage 返回 Gemini 格式的用量。
+func mockGeminiUsage(usage completionUsage) map[string]int64 {
+	return map[string]int64{
+		"promptTokenCount":     usage.PromptTokens,
+		"candidatesTokenCount": usage.CompletionTokens,
+		"totalTokenCount":      usage.TotalTokens,
+	}
+}
+
+// mockErrorBody 返回协议对应格式的注入失败响应体。
+func mockErrorBody(protocol mockProtocol, status int) []byte {
+	message := "mock channel injected failure with status " + strconv.Itoa(status)
+	switch protocol {
+	case mockProtocolAnthropic:
+		errorType := "api_error"
+		switch status {
+		case http.StatusTooManyRequests:
+			errorType = "rate_limit_error"
+		case 529:
+			errorType = "overloaded_error"
+		}
+		return anthropicErrorBody(errorType, message)
+	case mockProtocolGemini:
+		body, _ := json.Marshal(map[string]any{"error": map[string]any{"code": status, "message": message, "status": strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))}})
+		return body
+	default:
+		return openAIErrorBody(message)
+	}
+}
+
+// mockResponseID 生成协议风格的响应 ID。
+func mockResponseID(protocol mockProtocol) string {
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	switch protocol {
+	case mockProtocolAnthropic:
+		return "msg_mock_" + suffix
+	case mockProtocolGemini:
+		return "mock-" + suffix
+	default:
+		return "chatcmpl-mock-" + suffix
+	}
+}
+
+// mockResponse 构造进程内应答的 HTTP 响应。
+func mockResponse(request *http.Request, status int, contentType string, body io.ReadCloser) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Body:          body,
+		ContentLength: -1,
+		Request:       request,
+	}
+}
+
+// mockSleep 等待指定毫秒数, 请求被取消时提前返回。
+func mockSleep(ctx context.Context, milliseconds int) error {
+	if milliseconds <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(milliseconds) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
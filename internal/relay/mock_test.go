@@ -0,0 +1,227 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/op"
+	"github.com/looplj/axonhub/llm"
+)
+
+// failoverConfig 让成员首次失败即进入冷却, 使请求在同一轮循环内转向下一个成员。
+var failoverConfig = model.GroupRelayConfig{MemberMaxAttempts: 1, MemberRetryIntervalSeconds: 1, MemberCooldownSeconds: 60}
+
+func TestMockFailover(t *testing.T) {
+	failing := createMockChannel(t, "failing", model.MockConfig{FailureStatus: http.StatusInternalServerError})
+	healthy := createMockChannel(t, "healthy", model.MockConfig{})
+	group := createRelayGroup(t, model.GroupModeFailover, failoverConfig, failing, healthy)
+
+	recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, false), 0)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage *completionUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(response.Choices) != 1 || response.Choices[0].Message.Content != "hello mock world" {
+		t.Errorf("choices = %+v, want echo of the user message", response.Choices)
+	}
+	if response.Usage == nil || response.Usage.PromptTokens == 0 || response.Usage.CompletionTokens == 0 {
+		t.Errorf("usage = %+v, want prompt and completion tokens", response.Usage)
+	}
+
+	// 失败的成员与成功的成员各自记录一轮。
+	if stats := op.StatsChannelGet(failing.ID).StatsMetrics; stats.RequestFailed != 1 || stats.RequestSuccess != 0 {
+		t.Errorf("failing channel stats = %+v, want one failure", stats)
+	}
+	if stats := op.StatsChannelGet(healthy.ID).StatsMetrics; stats.RequestSuccess != 1 || stats.OutputToken == 0 {
+		t.Errorf("healthy channel stats = %+v, want one success with usage", stats)
+	}
+}
+
+func TestMockCooldownSkipsFailedMember(t *testing.T) {
+	failing := createMockChannel(t, "failing", model.MockConfig{FailureStatus: http.StatusBadGateway})
+	healthy := createMockChannel(t, "healthy", model.MockConfig{})
+	group := createRelayGroup(t, model.GroupModeFailover, failoverConfig, failing, healthy)
+
+	for i := range 2 {
+		if recorder := serveRelay(llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", chatBody(group.Name, false), 0); recorder.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, body = %s", i, recorder.Code, recorder.Body)
+		}
+	}
+
+	// 第二个请求直接由健康成员承担, 冷却中的成员没有再被请求。
+	if stats := op.StatsChannelGet(failing.ID).StatsMetrics; stats.RequestFailed != 1 {
+		t.Errorf("failing channel failures = %d, want 1", stats.RequestFailed)
+	}
+	if stats := op.StatsChannelGet(healthy.ID).StatsMetrics; stats.RequestSuccess != 2 {
+		t.Errorf("healthy channel successes = %d, want 2", stats.RequestSuccess)
+	}
+	routeMu.Lock()
+	_, cooling := routes[group.ID].Cooldowns[group.Items[0].ID]
+	routeMu.Unlock()
+	if !cooling {
+		t.Error("failed member not cooling")
+	}
+}
+
+func TestMockStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		format llm.APIFormat
+		path   string
+		body   string
+		check  func(t *testing.T, events []sseEvent)
+	}{
+		{"openai chat", llm.APIFormatOpenAIChatCompletion, "/v1/chat/completions", `{"model":"%s","stream":true,"messages":[{"role":"user","content":"hello mock world"}]}`,
+			func(t *testing.T, events []sseEvent) {
+				if last := events[len(events)-1]; last.data != "[DONE]" {
+					t.Errorf("last event = %+v, want [DONE]", last)
+				}
+				var text strings.Builder
+				var usage *completionUsage
+				for _, event := range events[:len(events)-1] {
+					var chunk openAIChatResponse
+					if err := json.Unmarshal([]byte(event.data), &chunk); err != nil {
+						t.Fatalf("decode chunk %s: %v", event.data, err)
+					}
+					if chunk.Object != "chat.completion.chunk" {
+						t.Errorf("chunk object = %q, want chat.completion.chunk", chunk.Object)
+					}
+					for _, choice := range chunk.Choices {
+						if choice.Delta != nil {
+							text.WriteString(choice.Delta.Content)
+						}
+					}
+					if chunk.Usage != nil {
+						usage = chunk.Usage
+					}
+				}
+				if text.String() != "hello mock world" {
+					t.Errorf("streamed text = %q", text.String())
+				}
+				if usage == nil || usage.PromptTokens == 0 || usage.CompletionTokens == 0 {
+					t.Errorf("usage chunk = %+v, want prompt and completion tokens", usage)
+				}
+			}},
+		{"anthropic messages", llm.APIFormatAnthropicMessage, "/v1/messages", `{"model":"%s","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"hello mock world"}]}`,
+			func(t *testing.T, events []sseEvent) {
+				if events[0].name != "message_start" || events[len(events)-1].name != "message_stop" {
+					t.Errorf("events run from %q to %q, want message_start to message_stop", events[0].name, events[len(events)-1].name)
+				}
+				var inputTokens, outputTokens int64
+				for _, event := range events {
+					var parsed struct {
+						Type    string `json:"type"`
+						Message struct {
+							Usage struct {
+								InputTokens int64 `json:"input_tokens"`
+							} `json:"usage"`
+						} `json:"message"`
+						Usage struct {
+							OutputTokens int64 `json:"output_tokens"`
+						} `json:"usage"`
+					}
+					if err := json.Unmarshal([]byte(event.data), &parsed); err != nil {
+						t.Fatalf("decode event %s: %v", event.data, err)
+					}
+					if parsed.Type != event.name {
+						t.Errorf("event %q carries type %q", event.name, parsed.Type)
+					}
+					switch parsed.Type {
+					case "message_start":
+						inputTokens = parsed.Message.Usage.InputTokens
+					case "message_delta":
+						outputTokens = parsed.Usage.OutputTokens
+					}
+				}
+				if inputTokens == 0 || outputTokens == 0 {
+					t.Errorf("usage = %d input, %d output, want both", inputTokens, outputTokens)
+				}
+			}},
+		{"gemini contents", llm.APIFormatGeminiContents, "/v1beta/models/%s:streamGenerateContent", `{"contents":[{"role":"user","parts":[{"text":"hello mock world"}]}]}`,
+			func(t *testing.T, events []sseEvent) {
+				var last struct {
+					Candidates []struct {
+						FinishReason string `json:"finishReason"`
+					} `json:"candidates"`
+					UsageMetadata *struct {
+						PromptTokenCount     int64 `json:"promptTokenCount"`
+						CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+					} `json:"usageMetadata"`
+				}
+				for _, event := range events {
+					if event.name != "" {
+						t.Errorf("gemini event named %q, want data-only events", event.name)
+					}
+					if err := json.Unmarshal([]byte(event.data), &last); err != nil {
+						t.Fatalf("decode event %s: %v", event.data, err)
+					}
+				}
+				if len(last.Candidates) != 1 || last.Candidates[0].FinishReason != "STOP" {
+					t.Errorf("last candidates = %+v, want finishReason STOP", last.Candidates)
+				}
+				if last.UsageMetadata == nil || last.UsageMetadata.PromptTokenCount == 0 || last.UsageMetadata.CandidatesTokenCount == 0 {
+					t.Errorf("last usageMetadata = %+v, want prompt and candidate tokens", last.UsageMetadata)
+				}
+			}},
+		{"openai responses", llm.APIFormatOpenAIResponse, "/v1/responses", `{"model":"%s","stream":true,"input":"hello mock world"}`,
+			func(t *testing.T, events []sseEvent) {
+				if events[0].name != "response.created" || events[len(events)-1].name != "response.completed" {
+					t.Errorf("events run from %q to %q, want response.created to response.completed", events[0].name, events[len(events)-1].name)
+				}
+				var completed struct {
+					Response struct {
+						Status string `json:"status"`
+						Usage  *struct {
+							InputTokens  int64 `json:"input_tokens"`
+							OutputTokens int64 `json:"output_tokens"`
+						} `json:"usage"`
+					} `json:"response"`
+				}
+				if err := json.Unmarshal([]byte(events[len(events)-1].data), &completed); err != nil {
+					t.Fatalf("decode completed event: %v", err)
+				}
+				if completed.Response.Status != "completed" || completed.Response.Usage == nil || completed.Response.Usage.InputTokens == 0 || completed.Response.Usage.OutputTokens == 0 {
+					t.Errorf("completed response = %+v, want status completed with usage", completed.Response)
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := createMockChannel(t, "mock", model.MockConfig{})
+			group := createRelayGroup(t, model.GroupModeFailover, failoverConfig, channel)
+			path, body := tt.path, tt.body
+			if tt.format == llm.APIFormatGeminiContents {
+				path = strings.Replace(path, "%s", group.Name, 1)
+			} else {
+				body = strings.Replace(body, "%s", group.Name, 1)
+			}
+
+			recorder := serveRelay(tt.format, path, body, 0)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+				t.Errorf("Content-Type = %q, want text/event-stream", contentType)
+			}
+			tt.check(t, parseSSE(t, recorder.Body.String()))
+
+			// 转发结束后由客户端协议聚合出的用量计入渠道统计。
+			if stats := op.StatsChannelGet(channel.ID).StatsMetrics; stats.RequestSuccess != 1 || stats.InputToken == 0 || stats.OutputToken == 0 {
+				t.Errorf("channel stats = %+v, want one success with usage", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// isMultipart 判断请求体是否为 multipart 表单, 图片编辑等上传文件的接口以这种形式提交。
+func isMultipart(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mediaType, "multipart/")
+}
+
+// multipartBoundary 返回 multipart 请求体的分隔符。
+func multipartBoundary(header http.Header) (string, error) {
+	_, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return "", err
+	}
+	if params["boundary"] == "" {
+		return "", errors.New("multipart request has no boundary")
+	}
+	return params["boundary"], nil
+}
+
+// multipartValue 返回 multipart 表单中指定普通字段的值, 字段不存在时返回空字符串。
+func multipartValue(header http.Header, body []byte, name string) (string, error) {
+	boundary, err := multipartBoundary(header)
+	if err != nil {
+		return "", err
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if part.FormName() != name || part.FileName() != "" {
+			continue
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return "", err
+		}
+		return string(value), nil
+	}
+}
+
+// setMultipartValue 返回把指定普通字段改写为 value 后的 multipart 请求体, 字段不存在时追加在末尾。
+// 改写后沿用原分隔符, 请求的 Content-Type 因此无需改动; 其余字段和文件按原顺序原样保留。
+func setMultipartValue(header http.Header, body []byte, name, value string) ([]byte, error) {
+	boundary, err := multipartBoundary(header)
+	if err != nil {
+		return nil, err
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	var out bytes.Buffer
+	writer := multipart.NewWriter(&out)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+
+	replaced := false
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		target, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name && part.FileName() == "" && !replaced {
+			replaced = true
+			if _, err := io.WriteString(target, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := io.Copy(target, part); err != nil {
+			return nil, err
+		}
+	}
+	if !replaced {
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,460 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ollamaOptionFields 是 Chat 请求中可以放入 Ollama options 的采样参数, 值为对应的 option 名称。
+var ollamaOptionFields = map[string]string{
+	"temperature":           "temperature",
+	"top_p":                 "top_p",
+	"seed":                  "seed",
+	"presence_penalty":      "presence_penalty",
+	"frequency_penalty":     "frequency_penalty",
+	"max_tokens":            "num_predict",
+	"max_completion_tokens": "num_predict",
+}
+
+// ollamaMessage 是 Ollama 原生 /api/chat 请求和响应中的消息。
+type ollamaMessage struct {
+	Role      string           `json:"role"`                 // 消息角色。
+	Content   string           `json:"content"`              // 文本内容。
+	Thinking  string           `json:"thinking,omitempty"`   // 推理模型输出的思考内容。
+	Images    []string         `json:"images,omitempty"`     // base64 编码的图片。
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"` // 助手发起的工具调用。
+	ToolName  string           `json:"tool_name,omitempty"`  // 工具结果消息对应的工具名称。
+}
+
+// ollamaToolCall 是 Ollama 消息中的一次工具调用, 参数为 JSON 对象而不是字符串。
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`      // 工具名称。
+		Arguments json.RawMessage `json:"arguments"` // 调用参数。
+	} `json:"function"`
+}
+
+// ollamaChatRequest 是 Ollama 原生 /api/chat 的请求体。
+type ollamaChatRequest struct {
+	Model    string                     `json:"model"`             // 模型名称。
+	Messages []ollamaMessage            `json:"messages"`          // 对话消息。
+	Stream   bool                       `json:"stream"`            // 是否以 NDJSON 流式返回, Ollama 默认流式, 需显式声明。
+	Tools    json.RawMessage            `json:"tools,omitempty"`   // 工具定义, 与 OpenAI 格式相同。
+	Format   json.RawMessage            `json:"format,omitempty"`  // 结构化输出: "json" 或 JSON Schema。
+	Options  map[string]json.RawMessage `json:"options,omitempty"` // 采样参数。
+}
+
+// ollamaChatResponse 是 Ollama 原生 /api/chat 的非流式响应, 也是 NDJSON 流中单行的形状。
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`             // 模型名称。
+	CreatedAt       time.Time     `json:"created_at"`        // 生成时间。
+	Message         ollamaMessage `json:"message"`           // 完整消息或本行的增量消息。
+	Done            bool          `json:"done"`              // 是否为最后一行。
+	DoneReason      string        `json:"done_reason"`       // 结束原因, 如 stop, length。
+	PromptEvalCount int64         `json:"prompt_eval_count"` // 输入 Token 数。
+	EvalCount       int64         `json:"eval_count"`        // 输出 Token 数。
+	Error           string        `json:"error"`             // 请求失败时的错误说明。
+}
+
+// openAIToolCall 是转换得到的 Chat 响应或流事件中的一次工具调用。
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"` // 流事件中工具调用的序号。
+	ID       string `json:"id"`              // 工具调用 ID。
+	Type     string `json:"type"`            // 固定为 function。
+	Function struct {
+		Name      string `json:"name"`      // 工具名称。
+		Arguments string `json:"arguments"` // JSON 字符串形式的调用参数。
+	} `json:"function"`
+}
+
+// openAIChatMessage 是转换得到的 Chat 响应中的消息或流事件中的增量。
+type openAIChatMessage struct {
+	Role             string           `json:"role,omitempty"`              // 消息角色, 流事件中只在首个事件出现。
+	Content          string           `json:"content"`                     // 文本内容。
+	ReasoningContent string           `json:"reasoning_content,omitempty"` // 思考内容。
+	ToolCalls        []openAIToolCall `json:"tool_calls,omitempty"`        // 工具调用。
+}
+
+// openAIChatChoice 是转换得到的 Chat 响应或流事件中的单个候选。
+type openAIChatChoice struct {
+	Index        int                `json:"index"`             // 候选序号。
+	Message      *openAIChatMessage `json:"message,omitempty"` // 非流式响应的完整消息。
+	Delta        *openAIChatMessage `json:"delta,omitempty"`   // 流事件的增量。
+	FinishReason *string            `json:"finish_reason"`     // 结束原因, 流事件中未结束时为 null。
+}
+
+// openAIChatResponse 是转换得到的 Chat 响应或流事件。
+type openAIChatResponse struct {
+	ID      string             `json:"id"`              // 响应 ID。
+	Object  string             `json:"object"`          // chat.completion 或 chat.completion.chunk。
+	Created int64              `json:"created"`         // 创建时间戳。
+	Model   string             `json:"model"`           // 模型名称。
+	Choices []openAIChatChoice `json:"choices"`         // 候选。
+	Usage   *completionUsage   `json:"usage,omitempty"` // 用量。
+}
+
+// ollamaTransport 把发往 OpenAI 兼容 Chat 接口的请求改写为 Ollama 原生 /api/chat 请求, 响应再转换回 Chat 格式:
+// 非流式响应转换为 chat.completion, NDJSON 流转换为 chat.completion.chunk 的 SSE 事件流, 用量取自 prompt_eval_count 与 eval_count。
+// 透传与跨协议转换都按 OpenAI Chat 协议构造请求, 其余接口原样发往 Ollama 的 OpenAI 兼容接口。
+type ollamaTransport struct {
+	base http.RoundTripper // 实际发送请求的传输层。
+}
+
+func (t *ollamaTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(request.URL.Path, "/chat/completions") {
+		return t.base.RoundTrip(request)
+	}
+	body, err := readRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+	native, err := chatToOllamaRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = json.Marshal(native); err != nil {
+		return nil, err
+	}
+
+	target := *request.URL
+	target.Path = strings.TrimSuffix(strings.TrimSuffix(target.Path, "/chat/completions"), "/v1") + "/api/chat"
+	target.RawPath = ""
+	outbound := request.Clone(request.Context())
+	outbound.URL = &target
+	outbound.Body = io.NopCloser(bytes.NewReader(body))
+	outbound.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	outbound.ContentLength = int64(len(body))
+	outbound.Header.Set("Content-Type", "application/json")
+	outbound.Header.Del("Accept")
+
+	response, err := t.base.RoundTrip(outbound)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return ollamaErrorResponse(response)
+	}
+	if native.Stream {
+		response.Body = newOllamaStreamReader(response.Body)
+		response.Header.Set("Content-Type", "text/event-stream")
+		response.Header.Del("Content-Length")
+		response.ContentLength = -1
+		return response, nil
+	}
+
+	raw, err := readResponseBody(response)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := ollamaToChatResponse(raw)
+	if err != nil {
+		return nil, err
+	}
+	setResponseBody(response, converted)
+	return response, nil
+}
+
+// chatToOllamaRequest 把 OpenAI Chat 请求体转换为 Ollama 原生 /api/chat 请求体。
+// 图片只支持 data URL 形式的内联图片; 工具结果消息按此前工具调用的 ID 找回工具名称。
+func chatToOllamaRequest(body []byte) (*ollamaChatRequest, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	var chat struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Role       string          `json:"role"`
+			Content    json.RawMessage `json:"content"`
+			ToolCallID string          `json:"tool_call_id"`
+			ToolCalls  []struct {
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"messages"`
+		Stream         bool            `json:"stream"`
+		Tools          json.RawMessage `json:"tools"`
+		ResponseFormat *struct {
+			Type       string `json:"type"`
+			JSONSchema *struct {
+				Schema json.RawMessage `json:"schema"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return nil, err
+	}
+
+	native := &ollamaChatRequest{Model: chat.Model, Stream: chat.Stream, Tools: chat.Tools, Options: make(map[string]json.RawMessage)}
+	toolNames := make(map[string]string)
+	for _, message := range chat.Messages {
+		converted := ollamaMessage{Role: message.Role, ToolName: toolNames[message.ToolCallID]}
+		if err := ollamaMessageContent(message.Content, &converted); err != nil {
+			return nil, err
+		}
+		for _, call := range message.ToolCalls {
+			toolNames[call.ID] = call.Function.Name
+			var toolCall ollamaToolCall
+			toolCall.Function.Name = call.Function.Name
+			toolCall.Function.Arguments = json.RawMessage(call.Function.Arguments)
+			if !json.Valid(toolCall.Function.Arguments) {
+				toolCall.Function.Arguments = json.RawMessage("{}")
+			}
+			converted.ToolCalls = append(converted.ToolCalls, toolCall)
+		}
+		native.Messages = append(native.Messages, converted)
+	}
+
+	for field, option := range ollamaOptionFields {
+		if value, ok := fields[field]; ok && string(value) != "null" {
+			native.Options[option] = value
+		}
+	}
+	if stop, ok := fields["stop"]; ok && string(stop) != "null" {
+		// Ollama 的 stop 只接受数组。
+		if bytes.HasPrefix(bytes.TrimSpace(stop), []byte(`"`)) {
+			stop = append(append([]byte("["), stop...), ']')
+		}
+		native.Options["stop"] = stop
+	}
+	if format := chat.ResponseFormat; format != nil {
+		switch {
+		case format.Type == "json_object":
+			native.Format = json.RawMessage(`"json"`)
+		case format.Type == "json_schema" && format.JSONSchema != nil && len(format.JSONSchema.Schema) > 0:
+			native.Format = format.JSONSchema.Schema
+		}
+	}
+	return native, nil
+}
+
+// ollamaMessageContent 把 Chat 消息内容写入 Ollama 消息: 文本片段依次拼接, 内联图片放入 images。
+func ollamaMessageContent(content json.RawMessage, message *ollamaMessage) error {
+	if len(content) == 0 || string(content) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(content, &message.Content); err == nil {
+		return nil
+	}
+	var parts []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		ImageURL struct {
+			URL string `json:"url"`
+		} `json:"image_url"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return fmt.Errorf("unsupported chat message content: %w", err)
+	}
+	var text strings.Builder
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			text.WriteString(part.Text)
+		case "image_url":
+			_, data, ok := strings.Cut(part.ImageURL.URL, ";base64,")
+			if !ok || !strings.HasPrefix(part.ImageURL.URL, "data:") {
+				return errors.New("ollama native api only supports inline base64 images")
+			}
+			message.Images = append(message.Images, data)
+		default:
+			return fmt.Errorf("ollama native api does not support %s content", part.Type)
+		}
+	}
+	message.Content = text.String()
+	return nil
+}
+
+// ollamaToChatResponse 把 Ollama 原生非流式响应转换为 Chat 响应。
+func ollamaToChatResponse(body []byte) ([]byte, error) {
+	var native ollamaChatResponse
+	if err := json.Unmarshal(body, &native); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, body)
+	}
+	message := &openAIChatMessage{
+		Role:             "assistant",
+		Content:          native.Message.Content,
+		ReasoningContent: native.Message.Thinking,
+		ToolCalls:        ollamaToolCalls(native.Message.ToolCalls, nil),
+	}
+	finishReason := ollamaFinishReason(native.DoneReason, len(message.ToolCalls) > 0)
+	return json.Marshal(openAIChatResponse{
+		ID:      ollamaResponseID(),
+		Object:  "chat.completion",
+		Created: native.CreatedAt.Unix(),
+		Model:   native.Model,
+		Choices: []openAIChatChoice{{Message: message, FinishReason: &finishReason}},
+		Usage:   ollamaUsage(native),
+	})
+}
+
+// ollamaToolCalls 把 Ollama 工具调用转换为 Chat 工具调用, next 非空时为流事件编号并推进计数。
+func ollamaToolCalls(calls []ollamaToolCall, next *int) []openAIToolCall {
+	var converted []openAIToolCall
+	for i, call := range calls {
+		index := i
+		if next != nil {
+			index = *next
+			*next++
+		}
+		toolCall := openAIToolCall{ID: "call_" + strconv.Itoa(index), Type: "function"}
+		if next != nil {
+			toolCall.Index = &index
+		}
+		toolCall.Function.Name = call.Function.Name
+		toolCall.Function.Arguments = string(call.Function.Arguments)
+		converted = append(converted, toolCall)
+	}
+	return converted
+}
+
+// ollamaFinishReason 把 Ollama 的结束原因转换为 Chat 的 finish_reason。
+func ollamaFinishReason(doneReason string, toolCalls bool) string {
+	switch {
+	case toolCalls:
+		return "tool_calls"
+	case doneReason == "length":
+		return "length"
+	default:
+		return "stop"
+	}
+}
+
+// ollamaUsage 返回 Ollama 响应中的用量。
+func ollamaUsage(response ollamaChatResponse) *completionUsage {
+	return &completionUsage{
+		PromptTokens:     response.PromptEvalCount,
+		CompletionTokens: response.EvalCount,
+		TotalTokens:      response.PromptEvalCount + response.EvalCount,
+	}
+}
+
+// ollamaResponseID 为转换得到的 Chat 响应生成 ID, Ollama 响应本身没有 ID。
+func ollamaResponseID() string {
+	return "chatcmpl-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// ollamaErrorResponse 把 Ollama 的错误响应体改写为 OpenAI 错误格式, 状态码和其余响应头保持不变。
+func ollamaErrorResponse(response *http.Response) (*http.Response, error) {
+	body, err := readResponseBody(response)
+	if err != nil {
+		return nil, err
+	}
+	var failure ollamaChatResponse
+	if json.Unmarshal(body, &failure) != nil || failure.Error == "" {
+		failure.Error = string(body)
+	}
+	setResponseBody(response, openAIErrorBody(failure.Error))
+	return response, nil
+}
+
+// openAIErrorBody 返回 OpenAI 格式的错误正文。
+func openAIErrorBody(message string) []byte {
+	body, _ := json.Marshal(map[string]any{"error": map[string]string{"message": message, "type": "upstream_error"}})
+	return body
+}
+
+// ollamaStreamReader 把 Ollama 的 NDJSON 流逐行转换为 Chat 流事件的 SSE 文本, 最后一行之后补发用量事件和 [DONE]。
+type ollamaStreamReader struct {
+	source    io.ReadCloser // 上游响应正文。
+	reader    *bufio.Reader // 带缓冲的上游正文读取器。
+	pending   bytes.Buffer  // 已转换尚未读出的 SSE 文本。
+	err       error         // 读取或转换的终止错误, 读完 pending 后返回。
+	id        string        // 整个流共用的响应 ID。
+	started   bool          // 是否已发出带角色的首个事件。
+	toolIndex int           // 下一个工具调用的序号。
+}
+
+func newOllamaStreamReader(source io.ReadCloser) *ollamaStreamReader {
+	return &ollamaStreamReader{source: source, reader: bufio.NewReader(source), id: ollamaResponseID()}
+}
+
+func (r *ollamaStreamReader) Read(p []byte) (int, error) {
+	for r.pending.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.convertLine()
+	}
+	return r.pending.Read(p)
+}
+
+func (r *ollamaStreamReader) Close() error {
+	return r.source.Close()
+}
+
+// convertLine 转换一行 NDJSON; 最后一行转换完毕后返回 io.EOF 结束整个流。
+func (r *ollamaStreamReader) convertLine() error {
+	line, err := r.reader.ReadBytes('\n')
+	if len(bytes.TrimSpace(line)) == 0 {
+		if errors.Is(err, io.EOF) {
+			return errors.New("ollama stream ended before done")
+		}
+		return err
+	}
+
+	var native ollamaChatResponse
+	if err := json.Unmarshal(line, &native); err != nil {
+		return fmt.Errorf("decode ollama stream line: %w", err)
+	}
+	if native.Error != "" {
+		r.writeData(openAIErrorBody(native.Error))
+		return io.EOF
+	}
+
+	chunk := openAIChatResponse{ID: r.id, Object: "chat.completion.chunk", Created: native.CreatedAt.Unix(), Model: native.Model}
+	delta := &openAIChatMessage{
+		Content:          native.Message.Content,
+		ReasoningContent: native.Message.Thinking,
+		ToolCalls:        ollamaToolCalls(native.Message.ToolCalls, &r.toolIndex),
+	}
+	if !r.started {
+		delta.Role = "assistant"
+		r.started = true
+	}
+	choice := openAIChatChoice{Delta: delta}
+	if native.Done {
+		finishReason := ollamaFinishReason(native.DoneReason, r.toolIndex > 0)
+		choice.FinishReason = &finishReason
+	}
+	chunk.Choices = []openAIChatChoice{choice}
+	if err := r.writeChunk(chunk); err != nil {
+		return err
+	}
+	if !native.Done {
+		return nil
+	}
+
+	// 与 OpenAI 的 include_usage 一致, 用量单独放在 choices 为空的最后一个事件中。
+	chunk.Choices = []openAIChatChoice{}
+	chunk.Usage = ollamaUsage(native)
+	if err := r.writeChunk(chunk); err != nil {
+		return err
+	}
+	r.writeData([]byte("[DONE]"))
+	return io.EOF
+}
+
+func (r *ollamaStreamReader) writeChunk(chunk openAIChatResponse) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	r.writeData(data)
+	return nil
+}
+
+func (r *ollamaStreamReader) writeData(data []byte) {
+	fmt.Fprintf(&r.pending, "data: %s\n\n", data)
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/bestruirui/octopus/internal/helper"
 	"github.com/bestruirui/octopus/internal/model"
 	"github.com/looplj/axonhub/llm"
 	"github.com/looplj/axonhub/llm/httpclient"
@@ -24,20 +25,89 @@ func upstreamPath(format llm.APIFormat) string {
 		return "/responses"
 	case llm.APIFormatAnthropicMessage:
 		return "/messages"
+	case APIFormatAnthropicCountTokens:
+		return "/messages/count_tokens"
+	case APIFormatOpenAIInputTokens:
+		return "/responses/input_tokens"
+	case llm.APIFormatOpenAIEmbedding:
+		return "/embeddings"
+	case APIFormatOpenAICompletion:
+		return "/completions"
+	case llm.APIFormatOpenAIImageGeneration:
+		return "/images/generations"
+	case APIFormatOpenAIImageEdit:
+		return "/images/edits"
+	case APIFormatOpenAIAudioTranscription:
+		return "/audio/transcriptions"
+	case APIFormatOpenAIAudioSpeech:
+		return "/audio/speech"
 	default:
 		return "/chat/completions"
 	}
 }
 
+// supportsStreaming 判断客户端协议是否支持事件流响应; Embedding 和图片等接口只以完整响应返回, 语音合成的音频流另行按二进制转发。
+func supportsStreaming(format llm.APIFormat) bool {
+	switch format {
+	case llm.APIFormatOpenAIChatCompletion, APIFormatOpenAICompletion, llm.APIFormatOpenAIResponse, llm.APIFormatAnthropicMessage, llm.APIFormatGeminiContents:
+		return true
+	default:
+		return false
+	}
+}
+
 // buildPassthroughRequest 构造同协议透传的上游请求: 目标地址, 认证和请求体由渠道决定, 客户端的其余请求头和查询参数
 // 经 MergeInboundRequest 透传给上游, 其中认证类, 库自管类和逐跳类请求头会被丢弃以免覆盖渠道凭据。
 func buildPassthroughRequest(format llm.APIFormat, raw *httpclient.Request, channel model.Channel) (*httpclient.Request, error) {
+	if format == llm.APIFormatGeminiContents {
+		return buildGeminiPassthroughRequest(raw, channel)
+	}
 	// BaseURL 以 ## 结尾表示地址已完整, 不再追加版本号和协议路径。
+	// 火山引擎的 OpenAI 兼容接口位于 v3 版本下。
 	base := strings.TrimSuffix(channel.BaseURL, "##")
-	url := transformer.BuildRequestURL(base, "v1", upstreamPath(format), "", base != channel.BaseURL)
+	version := "v1"
+	switch channel.Type {
+	case model.ChannelProviderVolcengine:
+		version = "v3"
+	case model.ChannelProviderBedrock:
+		// 地址只需指向推理节点, 实际路径由 bedrockTransport 按模型改写。
+		base = helper.BedrockRuntimeURL(channel)
+	case model.ChannelProviderVertex:
+		base = helper.VertexEndpoint(channel)
+	}
+	url := transformer.BuildRequestURL(base, version, upstreamPath(format), "", base != channel.BaseURL)
 
 	auth := &httpclient.AuthConfig{Type: httpclient.AuthTypeBearer, APIKey: channel.Key}
-	if format == llm.APIFormatAnthropicMessage {
+	switch {
+	case channel.Type == model.ChannelProviderAzure:
+		// Azure 按部署寻址, 请求体中的模型已由本轮改写为成员配置的真实模型。
+		modelName, err := requestModel(raw)
+		if err != nil {
+			return nil, err
+		}
+		url = azureRequestURL(channel, format, modelName)
+		auth = azureAuth(channel)
+	case channel.Type == model.ChannelProviderCompatible:
+		// 只有路径模板引用了模型时才需要解析请求体。
+		var modelName string
+		if strings.Contains(channel.Compatible.Paths[strings.TrimPrefix(upstreamPath(format), "/")], "{model}") {
+			var err error
+			if modelName, err = requestModel(raw); err != nil {
+				return nil, err
+			}
+		}
+		url = compatibleRequestURL(channel, format, modelName)
+		auth = compatibleAuth(channel)
+	case channel.Type == model.ChannelProviderOllama:
+		// Ollama 的 OpenAI 兼容接口固定位于 /v1 下, 本地实例不需要凭据。
+		url = helper.OllamaBaseURL(channel) + "/v1" + upstreamPath(format)
+		if channel.Key == "" {
+			auth = nil
+		}
+	case channel.Type == model.ChannelProviderMock:
+		// 模拟渠道按路径识别协议, 地址不受 BaseURL 影响, 由 mockTransport 在进程内应答。
+		url = mockBaseURL + "/v1" + upstreamPath(format)
+	case format == llm.APIFormatAnthropicMessage || format == APIFormatAnthropicCountTokens:
 		auth = &httpclient.AuthConfig{Type: httpclient.AuthTypeAPIKey, APIKey: channel.Key, HeaderKey: "X-API-Key"}
 	}
 	// Content-Type 属于库自管头, 不会随客户端请求透传, 需按客户端原值显式重建。
@@ -72,7 +142,7 @@ func inspectStreamEvent(format llm.APIFormat, event *httpclient.StreamEvent) (bo
 	}
 
 	switch format {
-	case llm.APIFormatOpenAIChatCompletion:
+	case llm.APIFormatOpenAIChatCompletion, APIFormatOpenAICompletion:
 		if bytes.Equal(event.Data, llm.DoneStreamEvent.Data) {
 			return true, nil
 		}
@@ -152,6 +222,26 @@ func inspectStreamEvent(format llm.APIFormat, event *httpclient.StreamEvent) (bo
 		}
 		return false, nil
 
+	case llm.APIFormatGeminiContents:
+		// Gemini 流没有终止事件, 以连接结束为准; 错误以带 error 字段的事件下发。
+		var failure struct {
+			Error *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+				Status  string `json:"status"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(event.Data, &failure); err != nil {
+			return true, fmt.Errorf("decode gemini stream event: %w", err)
+		}
+		if failure.Error != nil {
+			if failure.Error.Message == "" {
+				failure.Error.Message = "gemini stream error"
+			}
+			return true, &llm.ResponseError{StatusCode: failure.Error.Code, Detail: llm.ErrorDetail{Message: failure.Error.Message, Type: failure.Error.Status}}
+		}
+		return false, nil
+
 	default:
 		return false, nil
 	}
@@ -1,67 +1,107 @@
 package relay
 
 import (
+	"cmp"
 	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/bestruirui/octopus/internal/model"
+	"github.com/bestruirui/octopus/internal/op"
+	"github.com/looplj/axonhub/llm"
 )
 
 // RouteState 是一个分组的进程内路由状态, 同时作为路由流的消息形状; 跨该分组的全部请求共享。
 type RouteState struct {
-	GroupID       int           `json:"group_id"`        // 状态所属的分组 ID。
-	CurrentItemID int           `json:"current_item_id"` // 当前承载请求的成员 ID, 0 表示尚未建立路由。
-	ProbeItemID   int           `json:"probe_item_id"`   // 当前占用恢复探测的成员 ID, 同一分组同时只允许一个成员被探测。
-	AffinityUntil int64         `json:"affinity_until"`  // 当前路由的亲和截止 Unix 毫秒时间, 0 表示无亲和。
-	Cooldowns     map[int]int64 `json:"cooldowns"`       // 失败成员 ID 对应的冷却截止 Unix 毫秒时间, 已到期的条目由前端按当前时间忽略。
+	GroupID       int                    `json:"group_id"`        // 状态所属的分组 ID。
+	CurrentItemID int                    `json:"current_item_id"` // 当前承载请求的成员 ID, 0 表示尚未建立路由。
+	ProbeItemID   int                    `json:"probe_item_id"`   // 当前占用恢复探测的成员 ID, 同一分组同时只允许一个成员被探测。
+	AffinityUntil int64                  `json:"affinity_until"`  // 当前路由的亲和截止 Unix 毫秒时间, 0 表示无亲和。
+	Cooldowns     map[int]int64          `json:"cooldowns"`       // 失败成员 ID 对应的冷却截止 Unix 毫秒时间, 已到期的条目由前端按当前时间忽略。
+	Shares        map[int]int64          `json:"shares"`          // 负载均衡模式下成员 ID 对应的进程内累计分摊次数, 含探测请求。
+	Estimates     map[int]MemberEstimate `json:"estimates"`       // 成员 ID 对应的近期延迟与错误率估计, 手动模式以外均持续更新。
+	Channels      map[int]ChannelLoad    `json:"channels"`        // 成员渠道 ID 对应的实时占用, 渠道名额变化时随之发布。
 
-	affinityArmed bool // 当前路由下一次成功后是否开始亲和, 仅故障切换后为真。
+	affinityArmed  bool         // 当前路由下一次成功后是否开始亲和, 仅故障切换后为真。
+	currentWeights map[int]int  // 平滑加权轮询中各成员的当前权重, 只在负载均衡模式使用。
+	channelIDs     map[int]bool // 分组成员使用的渠道 ID, 渠道名额变化时据此找到需要发布的分组。
+}
+
+// MemberEstimate 是一个成员近期表现的指数加权滑动估计, 越新的轮次权重越大。
+type MemberEstimate struct {
+	LatencyMs float64 `json:"latency_ms"` // 成功轮次取得首个有效响应耗时的滑动平均毫秒数。
+	ErrorRate float64 `json:"error_rate"` // 近期轮次失败比例的滑动平均, 取值 0 到 1。
+	Samples   int64   `json:"samples"`    // 已计入估计的轮次数, 0 表示尚无观测。
 }
 
 const routeStreamBuffer = 16 // 单个路由流连接的非阻塞消息缓冲容量。
 
+const (
+	estimateAlpha   = 0.2  // 每个新样本在滑动估计中的权重。
+	explorationRate = 0.05 // 延迟模式随机选择非最快成员的概率。
+)
+
 var (
-	routeMu      sync.Mutex                      // routeMu 保护全部分组路由状态。
+	routeMu      sync.Mutex                           // routeMu 保护全部分组路由状态。
 	routes       = make(map[int]*RouteState)          // routes 按分组 ID 保存路由状态。
 	routeStreams = make(map[chan RouteState]struct{}) // 全部路由 SSE 连接。
 )
 
-// pickGroupItem 按分组模式选择本轮目标成员, 没有可用成员时返回零值; group.Items 已按 Priority 升序排列。
+// pickGroupItem 按分组模式在能处理客户端协议 format 的成员中选择本轮目标成员, 没有可用成员时返回零值; group.Items 已按 Priority 升序排列。
 // 渠道是否可用不在此判断: 渠道禁用或缺少密钥由调用方发现并作为一轮失败上报, 该成员随即进入冷却而在后续轮次被跳过。
-func pickGroupItem(group model.Group) model.GroupItem {
-	if group.Mode == model.GroupModeManual {
-		for _, item := range group.Items {
-			if item.ID == group.ActiveItemID {
-				return item
-			}
-		}
-		return model.GroupItem{}
-	}
-
+// 渠道已达并发或每分钟请求数上限的成员暂不可选, 不计失败也不冷却, 名额恢复后立即重新参与选择。
+func pickGroupItem(group model.Group, format llm.APIFormat) model.GroupItem {
 	routeMu.Lock()
 	defer routeMu.Unlock()
 
 	route := groupRouteLocked(group)
+	group.Items = formatItems(group.Items, format)
+	if group.Mode == model.GroupModeManual {
+		item := itemOf(group, group.ActiveItemID)
+		if item.ID != 0 && channelSaturatedLocked(item.ChannelID, time.Now()) {
+			return model.GroupItem{}
+		}
+		return item
+	}
+	switch group.Mode {
+	case model.GroupModeLoadBalance:
+		return pickWeightedItemLocked(group, route)
+	case model.GroupModeLatency:
+		return pickFastestItemLocked(group, route)
+	}
 	now := time.Now().UnixMilli()
 	if route.AffinityUntil <= now {
 		route.AffinityUntil = 0
 	}
 
-	// 亲和期内沿用当前成员, 不提前探测已恢复的高优先级成员。
-	if route.CurrentItemID != 0 && route.AffinityUntil > now {
-		return itemOf(group, route.CurrentItemID)
+	// 当前成员不能处理本请求的协议时, 本轮视为尚未建立路由, 按顺序重新选择。
+	currentItemID := itemOf(group, route.CurrentItemID).ID
+
+	// 亲和期内沿用当前成员, 不提前探测已恢复的高优先级成员; 当前成员渠道满载时本轮溢出到其他成员。
+	if currentItemID != 0 && route.AffinityUntil > now {
+		return currentOrOverflowItemLocked(group, route)
 	}
 
-	for _, item := range group.Items {
+	// 费用模式与故障转移模式使用同一套切换规则, 只是成员顺序改为按预期费用从低到高。
+	items := group.Items
+	if group.Mode == model.GroupModeCost {
+		items = itemsByCost(group.Items)
+	}
+	for _, item := range items {
 		// 遍历到当前成员说明比它优先级更高的成员都不可选, 沿用当前成员。
-		if item.ID == route.CurrentItemID {
+		if item.ID == currentItemID {
 			break
 		}
 		deadline, cooling := route.Cooldowns[item.ID]
 		if cooling && deadline > now {
 			continue
 		}
+		if channelSaturatedLocked(item.ChannelID, time.Now()) {
+			continue
+		}
 		// 冷却已到期的成员只放行一个探测请求, 避免全部请求同时涌向尚未恢复的成员。
 		if cooling {
 			if route.ProbeItemID != 0 {
@@ -75,14 +115,223 @@ func pickGroupItem(group model.Group) model.GroupItem {
 		publishRouteLocked(route)
 		return item
 	}
-	if route.CurrentItemID != 0 {
-		return itemOf(group, route.CurrentItemID)
+	if currentItemID != 0 {
+		return currentOrOverflowItemLocked(group, route)
 	}
 	return model.GroupItem{}
 }
 
-// recordRouteSuccess 上报一轮成功: 结束该成员的冷却与探测占用, 并在故障切换后按配置开始亲和。
-func recordRouteSuccess(group model.Group, itemID int) {
+// currentOrOverflowItemLocked 返回当前成员; 当前成员渠道满载时按原顺序返回首个未冷却且渠道未满载的其他成员, 不改变当前路由, 也不占用探测; 调用方必须持有锁。
+func currentOrOverflowItemLocked(group model.Group, route *RouteState) model.GroupItem {
+	now := time.Now()
+	current := itemOf(group, route.CurrentItemID)
+	if !channelSaturatedLocked(current.ChannelID, now) {
+		return current
+	}
+	items := group.Items
+	if group.Mode == model.GroupModeCost {
+		items = itemsByCost(group.Items)
+	}
+	for _, item := range items {
+		if item.ID == current.ID {
+			continue
+		}
+		if _, cooling := route.Cooldowns[item.ID]; cooling {
+			continue
+		}
+		if !channelSaturatedLocked(item.ChannelID, now) {
+			return item
+		}
+	}
+	return model.GroupItem{}
+}
+
+// pickWeightedItemLocked 按平滑加权轮询在未冷却的成员间分摊请求; 调用方必须持有锁。
+// 冷却到期的成员与故障转移模式一样只放行一个探测请求, 探测成功解除冷却后才重新参与分摊。
+func pickWeightedItemLocked(group model.Group, route *RouteState) model.GroupItem {
+	if item, ok := probeItemLocked(group, route); ok {
+		route.Shares[item.ID]++
+		publishRouteLocked(route)
+		return item
+	}
+
+	// 每轮为全部可用成员累加权重, 选中当前权重最大者后扣除总权重, 使各成员的选中次数严格按权重比例交错分布。
+	picked := -1
+	total := 0
+	now := time.Now()
+	for i, item := range group.Items {
+		if _, cooling := route.Cooldowns[item.ID]; cooling {
+			continue
+		}
+		if channelSaturatedLocked(item.ChannelID, now) {
+			continue
+		}
+		weight := max(item.Weight, 1)
+		route.currentWeights[item.ID] += weight
+		total += weight
+		if picked < 0 || route.currentWeights[item.ID] > route.currentWeights[group.Items[picked].ID] {
+			picked = i
+		}
+	}
+	if picked < 0 {
+		return model.GroupItem{}
+	}
+	item := group.Items[picked]
+	route.currentWeights[item.ID] -= total
+	route.CurrentItemID = item.ID
+	route.Shares[item.ID]++
+	publishRouteLocked(route)
+	return item
+}
+
+// pickFastestItemLocked 选择按错误率修正后预期耗时最短的未冷却成员, 尚无观测的成员优先以取得样本; 调用方必须持有锁。
+// 以 explorationRate 的概率改为随机选择其他成员, 使曾经变慢的成员有机会以新样本证明已经恢复。
+func pickFastestItemLocked(group model.Group, route *RouteState) model.GroupItem {
+	if item, ok := probeItemLocked(group, route); ok {
+		publishRouteLocked(route)
+		return item
+	}
+
+	candidates := make([]model.GroupItem, 0, len(group.Items))
+	best := -1
+	bestScore := 0.0
+	now := time.Now()
+	for _, item := range group.Items {
+		if _, cooling := route.Cooldowns[item.ID]; cooling {
+			continue
+		}
+		if channelSaturatedLocked(item.ChannelID, now) {
+			continue
+		}
+		score := route.Estimates[item.ID].score()
+		candidates = append(candidates, item)
+		if best < 0 || score < bestScore {
+			best = len(candidates) - 1
+			bestScore = score
+		}
+	}
+	if best < 0 {
+		return model.GroupItem{}
+	}
+	item := candidates[best]
+	if len(candidates) > 1 && rand.Float64() < explorationRate {
+		item = candidates[(best+1+rand.IntN(len(candidates)-1))%len(candidates)]
+	}
+	if route.CurrentItemID != item.ID {
+		route.CurrentItemID = item.ID
+		publishRouteLocked(route)
+	}
+	return item
+}
+
+// pickHedgeItem 在能处理客户端协议 format 的成员中为迟迟没有响应的首轮选择对冲成员, 没有可用成员时返回零值。
+// 候选按分组模式的偏好排序: 费用模式按单价, 延迟模式按预期耗时, 其余模式按优先级; 对冲只使用未冷却且渠道未满载的成员, 不占用探测, 也不改变路由状态。
+func pickHedgeItem(group model.Group, format llm.APIFormat, excludeItemID int) model.GroupItem {
+	if group.Mode == model.GroupModeManual {
+		return model.GroupItem{}
+	}
+
+	routeMu.Lock()
+	defer routeMu.Unlock()
+
+	route := groupRouteLocked(group)
+	items := formatItems(group.Items, format)
+	switch group.Mode {
+	case model.GroupModeCost:
+		items = itemsByCost(items)
+	case model.GroupModeLatency:
+		items = slices.Clone(items)
+		slices.SortStableFunc(items, func(a, b model.GroupItem) int {
+			return cmp.Compare(route.Estimates[a.ID].score(), route.Estimates[b.ID].score())
+		})
+	}
+	now := time.Now()
+	for _, item := range items {
+		if item.ID == excludeItemID {
+			continue
+		}
+		if _, cooling := route.Cooldowns[item.ID]; cooling {
+			continue
+		}
+		if channelSaturatedLocked(item.ChannelID, now) {
+			continue
+		}
+		return item
+	}
+	return model.GroupItem{}
+}
+
+// currentGroupItem 返回分组当前会被选中的成员而不改变路由状态: 手动模式取人工指定的成员, 亲和期内取亲和成员,
+// 其余按模式顺序取首个未冷却的成员; 用于 Token 计数等不参与故障转移的请求。
+func currentGroupItem(group model.Group, format llm.APIFormat) model.GroupItem {
+	if group.Mode == model.GroupModeManual {
+		return pickGroupItem(group, format)
+	}
+	routeMu.Lock()
+	route := groupRouteLocked(group)
+	currentItemID, affinityUntil := route.CurrentItemID, route.AffinityUntil
+	routeMu.Unlock()
+	if currentItemID != 0 && affinityUntil > time.Now().UnixMilli() {
+		items := formatItems(group.Items, format)
+		if i := slices.IndexFunc(items, func(item model.GroupItem) bool { return item.ID == currentItemID }); i >= 0 {
+			return items[i]
+		}
+	}
+	return pickHedgeItem(group, format, 0)
+}
+
+// score 返回按错误率修正后的预期耗时, 尚无观测时为零以优先取得样本; 已有观测但从未成功的成员为无穷大, 排在全部成功过的成员之后, 只由探测与随机探索取得恢复机会。
+// 预期耗时为单次延迟除以成功概率, 成功率下限避免近期全部失败的成员得到无穷大而失去与其他成员的排序。
+func (e MemberEstimate) score() float64 {
+	if e.Samples == 0 {
+		return 0
+	}
+	if e.LatencyMs == 0 {
+		return math.Inf(1)
+	}
+	return e.LatencyMs / max(1-e.ErrorRate, 0.05)
+}
+
+// itemsByCost 返回按预期单价升序排列的成员副本, 单价相同的成员保持原有优先级顺序。
+func itemsByCost(items []model.GroupItem) []model.GroupItem {
+	costs := make(map[int]float64, len(items))
+	for _, item := range items {
+		costs[item.ID] = memberUnitCost(item)
+	}
+	sorted := slices.Clone(items)
+	slices.SortStableFunc(sorted, func(a, b model.GroupItem) int {
+		return cmp.Compare(costs[a.ID], costs[b.ID])
+	})
+	return sorted
+}
+
+// memberUnitCost 返回成员每百万输入与输出 Token 的合计单价乘以渠道价格倍率, 作为费用排序依据; 缺少价格的成员排在最后。
+func memberUnitCost(item model.GroupItem) float64 {
+	price, err := op.LLMGet(item.ModelName)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return (price.Input + price.Output) * priceMultiplier(item.ChannelID)
+}
+
+// probeItemLocked 在没有探测进行时占用一个冷却已到期的成员作为本轮探测目标, 由调用方发布状态; 调用方必须持有锁。
+func probeItemLocked(group model.Group, route *RouteState) (model.GroupItem, bool) {
+	if route.ProbeItemID != 0 {
+		return model.GroupItem{}, false
+	}
+	now := time.Now()
+	for _, item := range group.Items {
+		if deadline, cooling := route.Cooldowns[item.ID]; cooling && deadline <= now.UnixMilli() && !channelSaturatedLocked(item.ChannelID, now) {
+			route.ProbeItemID = item.ID
+			return item, true
+		}
+	}
+	return model.GroupItem{}, false
+}
+
+// recordRouteSuccess 上报一轮成功: 计入该成员的延迟估计, 结束其冷却与探测占用, 并在故障切换后按配置开始亲和。
+// latencyMs 为本轮取得首个有效响应的毫秒数。
+func recordRouteSuccess(group model.Group, itemID int, latencyMs int64) {
 	if group.Mode == model.GroupModeManual {
 		return
 	}
@@ -95,7 +344,7 @@ func recordRouteSuccess(group model.Group, itemID int) {
 		return
 	}
 	now := time.Now().UnixMilli()
-	changed := false
+	recordEstimateLocked(route, itemID, float64(latencyMs), false)
 
 	// 探测成功说明该成员已恢复, 解除冷却; 若当前路由不在亲和期内则立即切回该成员。
 	if route.ProbeItemID == itemID {
@@ -105,24 +354,21 @@ func recordRouteSuccess(group model.Group, itemID int) {
 			route.CurrentItemID = itemID
 			route.AffinityUntil = 0
 		}
-		changed = true
 	}
-	// 亲和只在故障切换后的首次成功时开始, 使请求在一段时间内稳定留在备用成员上。
-	if route.CurrentItemID == itemID && route.affinityArmed {
+	// 亲和只在故障切换后的首次成功时开始, 使请求在一段时间内稳定留在备用成员上; 其余模式按各自策略逐轮选择, 不保持单一成员。
+	if (group.Mode == model.GroupModeFailover || group.Mode == model.GroupModeCost) && route.CurrentItemID == itemID && route.affinityArmed {
 		route.affinityArmed = false
 		if group.RelayConfig.MemberAffinitySeconds > 0 {
 			route.AffinityUntil = now + int64(group.RelayConfig.MemberAffinitySeconds)*1000
-			changed = true
 		}
 	}
-	if changed {
-		publishRouteLocked(route)
-	}
+	// 延迟估计每轮都会变化, 故成功后总是发布。
+	publishRouteLocked(route)
 }
 
 // recordRouteFailure 上报一轮失败: 达到配置的总尝试次数后将该成员打入冷却并让出当前路由, 返回是否已冷却。
-// failures 为该成员在本请求内包含首次请求的连续失败次数, 由调用方累计。
-func recordRouteFailure(group model.Group, itemID, failures int) bool {
+// failures 为该成员在本请求内包含首次请求的连续失败次数, 由调用方累计; cooldown 非零时不论尝试次数立即按该时长冷却。
+func recordRouteFailure(group model.Group, itemID, failures int, cooldown time.Duration) bool {
 	if group.Mode == model.GroupModeManual {
 		return false
 	}
@@ -134,13 +380,18 @@ func recordRouteFailure(group model.Group, itemID, failures int) bool {
 	if route == nil {
 		return false
 	}
-	// 探测请求只有一次机会, 常规成员达到配置的总尝试次数后进入冷却。
-	if route.ProbeItemID != itemID && failures < group.RelayConfig.MemberMaxAttempts {
+	// 每次失败都计入错误率估计, 冷却与否由尝试次数或调用方指定的冷却决定。
+	recordEstimateLocked(route, itemID, 0, true)
+	// 探测请求只有一次机会, 常规成员达到配置的总尝试次数后进入冷却, 调用方指定冷却时立即进入冷却。
+	if cooldown == 0 && route.ProbeItemID != itemID && failures < group.RelayConfig.MemberMaxAttempts {
+		publishRouteLocked(route)
 		return false
 	}
 
-	now := time.Now().UnixMilli()
-	route.Cooldowns[itemID] = now + int64(group.RelayConfig.MemberCooldownSeconds)*1000
+	if cooldown == 0 {
+		cooldown = time.Duration(group.RelayConfig.MemberCooldownSeconds) * time.Second
+	}
+	route.Cooldowns[itemID] = time.Now().Add(cooldown).UnixMilli()
 	if route.ProbeItemID == itemID {
 		route.ProbeItemID = 0
 	}
@@ -154,6 +405,35 @@ func recordRouteFailure(group model.Group, itemID, failures int) bool {
 	return true
 }
 
+// recordEstimateLocked 将一轮结果计入成员的滑动估计, 失败只更新错误率, 成功同时更新延迟; 调用方必须持有锁。
+func recordEstimateLocked(route *RouteState, itemID int, latencyMs float64, failed bool) {
+	estimate := route.Estimates[itemID]
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	// 延迟为零表示从未成功, 不足 1 毫秒的成功轮次按 1 毫秒计入以免混淆。
+	latencyMs = max(latencyMs, 1)
+	if estimate.Samples == 0 {
+		estimate.ErrorRate = sample
+		if !failed {
+			estimate.LatencyMs = latencyMs
+		}
+	} else {
+		estimate.ErrorRate += estimateAlpha * (sample - estimate.ErrorRate)
+		if !failed {
+			// 首个样本是失败时延迟尚无观测, 首个成功样本直接作为初值。
+			if estimate.LatencyMs == 0 {
+				estimate.LatencyMs = latencyMs
+			} else {
+				estimate.LatencyMs += estimateAlpha * (latencyMs - estimate.LatencyMs)
+			}
+		}
+	}
+	estimate.Samples++
+	route.Estimates[itemID] = estimate
+}
+
 // releaseRouteProbe 归还未产生成败结论的探测占用, 用于请求被人工中止或客户端断开。
 func releaseRouteProbe(group model.Group, itemID int) {
 	routeMu.Lock()
@@ -169,18 +449,35 @@ func releaseRouteProbe(group model.Group, itemID int) {
 func groupRouteLocked(group model.Group) *RouteState {
 	route := routes[group.ID]
 	if route == nil {
-		route = &RouteState{GroupID: group.ID, Cooldowns: make(map[int]int64)}
+		route = &RouteState{GroupID: group.ID, Cooldowns: make(map[int]int64), Shares: make(map[int]int64), Estimates: make(map[int]MemberEstimate), currentWeights: make(map[int]int)}
 		routes[group.ID] = route
 	}
 	items := make(map[int]bool, len(group.Items))
+	route.channelIDs = make(map[int]bool, len(group.Items))
 	for _, item := range group.Items {
 		items[item.ID] = true
+		route.channelIDs[item.ChannelID] = true
 	}
 	for itemID := range route.Cooldowns {
 		if !items[itemID] {
 			delete(route.Cooldowns, itemID)
 		}
 	}
+	for itemID := range route.Shares {
+		if !items[itemID] {
+			delete(route.Shares, itemID)
+		}
+	}
+	for itemID := range route.Estimates {
+		if !items[itemID] {
+			delete(route.Estimates, itemID)
+		}
+	}
+	for itemID := range route.currentWeights {
+		if !items[itemID] {
+			delete(route.currentWeights, itemID)
+		}
+	}
 	if route.ProbeItemID != 0 && !items[route.ProbeItemID] {
 		route.ProbeItemID = 0
 	}
@@ -192,6 +489,18 @@ func groupRouteLocked(group model.Group) *RouteState {
 	return route
 }
 
+// formatItems 返回能处理客户端协议 format 的成员: Embedding 请求排除渠道类型不支持 Embedding 的成员, 其余协议不做筛选。
+// 只在选择成员时筛选, 路由状态仍按全部成员维护, 被排除成员的冷却, 分摊与延迟估计不受影响。
+func formatItems(items []model.GroupItem, format llm.APIFormat) []model.GroupItem {
+	if format != llm.APIFormatOpenAIEmbedding {
+		return items
+	}
+	return slices.DeleteFunc(slices.Clone(items), func(item model.GroupItem) bool {
+		channel, err := op.ChannelGet(item.ChannelID)
+		return err == nil && !supportsEmbedding(channel.Type)
+	})
+}
+
 // itemOf 返回分组内指定 ID 的成员, 不存在时返回零值。
 func itemOf(group model.Group, itemID int) model.GroupItem {
 	for _, item := range group.Items {
@@ -202,10 +511,9 @@ func itemOf(group model.Group, itemID int) model.GroupItem {
 	return model.GroupItem{}
 }
 
-// publishRouteLocked 非阻塞发布路由状态, 连接拥塞时关闭它并交给客户端重连获取全量快照; 冷却表按值复制以免前端读到后续变更; 调用方必须持有锁。
+// publishRouteLocked 非阻塞发布路由状态, 连接拥塞时关闭它并交给客户端重连获取全量快照; 调用方必须持有锁。
 func publishRouteLocked(route *RouteState) {
-	message := *route
-	message.Cooldowns = maps.Clone(route.Cooldowns)
+	message := route.snapshotLocked()
 	for stream := range routeStreams {
 		select {
 		case stream <- message:
@@ -216,6 +524,22 @@ func publishRouteLocked(route *RouteState) {
 	}
 }
 
+// snapshotLocked 返回可发送给前端的路由状态副本, 各映射按值复制以免前端读到后续变更; 调用方必须持有锁。
+func (r *RouteState) snapshotLocked() RouteState {
+	message := *r
+	message.Cooldowns = maps.Clone(r.Cooldowns)
+	message.Shares = maps.Clone(r.Shares)
+	message.Estimates = maps.Clone(r.Estimates)
+	message.Channels = make(map[int]ChannelLoad, len(r.channelIDs))
+	now := time.Now()
+	for channelID := range r.channelIDs {
+		message.Channels[channelID] = channelLoadLocked(channelID, now)
+	}
+	message.currentWeights = nil
+	message.channelIDs = nil
+	return message
+}
+
 // OpenRouteStream 注册路由流连接, 返回全部分组的当前状态快照和后续增量通道。
 func OpenRouteStream() ([]RouteState, chan RouteState) {
 	routeMu.Lock()
@@ -226,9 +550,7 @@ func OpenRouteStream() ([]RouteState, chan RouteState) {
 
 	snapshot := make([]RouteState, 0, len(routes))
 	for _, route := range routes {
-		message := *route
-		message.Cooldowns = maps.Clone(route.Cooldowns)
-		snapshot = append(snapshot, message)
+		snapshot = append(snapshot, route.snapshotLocked())
 	}
 	return snapshot, stream
 }
@@ -0,0 +1,159 @@
+package relay
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bestruirui/octopus/internal/model"
+	"github.com/looplj/axonhub/llm"
+)
+
+func TestMemberEstimateScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		estimate MemberEstimate
+		want     float64
+	}{
+		{"no samples", MemberEstimate{}, 0},
+		{"healthy", MemberEstimate{LatencyMs: 800, Samples: 3}, 800},
+		{"half failing", MemberEstimate{LatencyMs: 800, ErrorRate: 0.5, Samples: 4}, 1600},
+		{"recently all failing", MemberEstimate{LatencyMs: 800, ErrorRate: 1, Samples: 4}, 16000},
+		{"never succeeded", MemberEstimate{ErrorRate: 1, Samples: 4}, math.Inf(1)},
+	}
+	for _, tt := range tests {
+		if got := tt.estimate.score(); got != tt.want {
+			t.Errorf("%s: score() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPickFastestItemSkipsAlwaysFailingMember(t *testing.T) {
+	failing := model.GroupItem{ID: 1, GroupID: 9001, ChannelID: 1, ModelName: "failing", Priority: 1}
+	healthy := model.GroupItem{ID: 2, GroupID: 9001, ChannelID: 2, ModelName: "healthy", Priority: 2}
+	group := model.Group{ID: 9001, Mode: model.GroupModeLatency, Items: []model.GroupItem{failing, healthy}}
+
+	routeMu.Lock()
+	route := groupRouteLocked(group)
+	for range 5 {
+		recordEstimateLocked(route, failing.ID, 0, true)
+		recordEstimateLocked(route, healthy.ID, 1200, false)
+	}
+	routeMu.Unlock()
+	t.Cleanup(func() {
+		routeMu.Lock()
+		delete(routes, group.ID)
+		routeMu.Unlock()
+	})
+
+	// 随机探索只会把少量请求分给失败成员。
+	picked := make(map[int]int)
+	for range 1000 {
+		picked[pickGroupItem(group, llm.APIFormatOpenAIChatCompletion).ID]++
+	}
+	if picked[healthy.ID] < 900 {
+		t.Fatalf("healthy member picked %d of 1000 times, want at least 900 (failing member picked %d)", picked[healthy.ID], picked[failing.ID])
+	}
+	if picked[failing.ID] == 0 {
+		t.Fatalf("failing member never picked, want exploration traffic")
+	}
+}
+
+func TestPickWeightedItemFollowsWeights(t *testing.T) {
+	heavy := model.GroupItem{ID: 11, GroupID: 9002, ChannelID: 1, ModelName: "heavy", Priority: 1, Weight: 3}
+	light := model.GroupItem{ID: 12, GroupID: 9002, ChannelID: 2, ModelName: "light", Priority: 2, Weight: 1}
+	group := model.Group{ID: 9002, Mode: model.GroupModeLoadBalance, Items: []model.GroupItem{heavy, light}}
+	cleanupRoute(t, group.ID)
+
+	// 平滑加权轮询每 4 次选择中按 3:1 分摊, 且轻成员不会连续落空超过一个周期。
+	var picked []int
+	for range 8 {
+		picked = append(picked, pickGroupItem(group, llm.APIFormatOpenAIChatCompletion).ID)
+	}
+	want := []int{heavy.ID, heavy.ID, light.ID, heavy.ID, heavy.ID, heavy.ID, light.ID, heavy.ID}
+	if !slices.Equal(picked, want) {
+		t.Fatalf("picked = %v, want %v", picked, want)
+	}
+
+	routeMu.Lock()
+	shares := maps.Clone(routes[group.ID].Shares)
+	routeMu.Unlock()
+	if shares[heavy.ID] != 6 || shares[light.ID] != 2 {
+		t.Errorf("shares = %v, want %d:6 %d:2", shares, heavy.ID, light.ID)
+	}
+}
+
+func TestPickWeightedItemEqualWeightsRoundRobin(t *testing.T) {
+	// 未设置权重的旧数据按 1 参与分摊, 与全部为 1 时一样依次轮询。
+	group := model.Group{ID: 9003, Mode: model.GroupModeLoadBalance, Items: []model.GroupItem{
+		{ID: 21, GroupID: 9003, ChannelID: 1, ModelName: "a", Priority: 1, Weight: 1},
+		{ID: 22, GroupID: 9003, ChannelID: 2, ModelName: "b", Priority: 2, Weight: 1},
+		{ID: 23, GroupID: 9003, ChannelID: 3, ModelName: "c", Priority: 3},
+	}}
+	cleanupRoute(t, group.ID)
+
+	var picked []int
+	for range 6 {
+		picked = append(picked, pickGroupItem(group, llm.APIFormatOpenAIChatCompletion).ID)
+	}
+	if want := []int{21, 22, 23, 21, 22, 23}; !slices.Equal(picked, want) {
+		t.Fatalf("picked = %v, want %v", picked, want)
+	}
+}
+
+func TestPickWeightedItemSkipsCoolingMember(t *testing.T) {
+	cooling := model.GroupItem{ID: 31, GroupID: 9004, ChannelID: 1, ModelName: "cooling", Priority: 1, Weight: 5}
+	healthy := model.GroupItem{ID: 32, GroupID: 9004, ChannelID: 2, ModelName: "healthy", Priority: 2, Weight: 1}
+	group := model.Group{ID: 9004, Mode: model.GroupModeLoadBalance, Items: []model.GroupItem{cooling, healthy}}
+	cleanupRoute(t, group.ID)
+
+	routeMu.Lock()
+	groupRouteLocked(group).Cooldowns[cooling.ID] = time.Now().Add(time.Minute).UnixMilli()
+	routeMu.Unlock()
+
+	// 冷却中的成员不论权重多高都不参与分摊, 也不计入分摊次数。
+	for range 3 {
+		if item := pickGroupItem(group, llm.APIFormatOpenAIChatCompletion); item.ID != healthy.ID {
+			t.Fatalf("pickGroupItem() = %d, want %d while %d is cooling", item.ID, healthy.ID, cooling.ID)
+		}
+	}
+
+	// 冷却到期后只放行一个探测请求, 探测成功前其余请求仍由健康成员承担。
+	routeMu.Lock()
+	routes[group.ID].Cooldowns[cooling.ID] = time.Now().Add(-time.Second).UnixMilli()
+	routeMu.Unlock()
+	if item := pickGroupItem(group, llm.APIFormatOpenAIChatCompletion); item.ID != cooling.ID {
+		t.Fatalf("first pick after cooldown = %d, want probe of %d", item.ID, cooling.ID)
+	}
+	if item := pickGroupItem(group, llm.APIFormatOpenAIChatCompletion); item.ID != healthy.ID {
+		t.Fatalf("pick during probe = %d, want %d", item.ID, healthy.ID)
+	}
+
+	routeMu.Lock()
+	shares := maps.Clone(routes[group.ID].Shares)
+	routeMu.Unlock()
+	if shares[cooling.ID] != 1 || shares[healthy.ID] != 4 {
+		t.Errorf("shares = %v, want %d:1 %d:4", shares, cooling.ID, healthy.ID)
+	}
+
+	// 探测成功解除冷却, 成员重新按权重参与分摊。
+	recordRouteSuccess(group, cooling.ID, 100)
+	picked := make(map[int]int)
+	for range 6 {
+		picked[pickGroupItem(group, llm.APIFormatOpenAIChatCompletion).ID]++
+	}
+	if picked[cooling.ID] != 5 || picked[healthy.ID] != 1 {
+		t.Errorf("picks after recovery = %v, want %d:5 %d:1", picked, cooling.ID, healthy.ID)
+	}
+}
+
+// cleanupRoute 在测试结束时删除分组的路由状态, 避免影响使用同一分组 ID 的其他测试。
+func cleanupRoute(t *testing.T, groupID int) {
+	t.Cleanup(func() {
+		routeMu.Lock()
+		delete(routes, groupID)
+		routeMu.Unlock()
+	})
+}
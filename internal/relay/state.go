@@ -2,6 +2,7 @@ package relay
 
 import (
 	"context"
+	"slices"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/bestruirui/octopus/internal/model"
 	"github.com/bestruirui/octopus/internal/op"
+	"github.com/charmbracelet/log"
 	"github.com/looplj/axonhub/llm"
 )
 
@@ -25,77 +27,117 @@ const (
 
 // 客户端请求的完整进程内状态, 同时作为状态流的消息形状; 上半部分在请求到达时写入并在结束时定稿, 下半部分每轮循环覆盖。
 type RequestState struct {
-	ID        uint64        `json:"id"`         // 请求在当前进程内的唯一标识。
-	Status    Status        `json:"status"`     // 请求当前状态。
-	StartedAt time.Time     `json:"started_at"` // 请求到达时间。
-	Duration  time.Duration `json:"duration"`   // 请求总耗时, 未结束时为零。
-	Model     string        `json:"model"`      // 客户端请求的模型名称, 即分组名称。
-	Usage     llm.Usage     `json:"usage"`      // 请求结束时写入的展示用量。
-	Cost      float64       `json:"cost"`       // 请求结束时写入的累计费用。
-
-	Round         int    `json:"round"`           // 最新一轮循环的递增序号, 人工中止按此匹配以免误杀下一轮。
-	TargetChannel string `json:"target_channel"`  // 最新一轮选中的渠道名称。
-	TargetModel   string `json:"target_model"`    // 最新一轮实际请求上游的模型名称。
-	Sending       bool   `json:"sending"`         // 最新一轮是否仍在等待上游响应。
-	Error         string `json:"error,omitempty"` // 最新一轮的失败原因, 请求结束后即为最终错误。
-
-	body         string             // 客户端原始请求体, 体积大故不进状态流, 由独立接口按需拉取。
-	responseBody string             // 聚合后的完整最终响应体, 同样按需拉取。
-	apiKeyID     int                // 发起请求的 API Key ID, 用于请求完成后的归属统计。
-	cancel       context.CancelFunc // 中止最新一轮上游请求, 仅在该轮等待响应期间非空。
+	ID            uint64        `json:"id"`             // 请求在当前进程内的唯一标识。
+	Status        Status        `json:"status"`         // 请求当前状态。
+	StartedAt     time.Time     `json:"started_at"`     // 请求到达时间。
+	Duration      time.Duration `json:"duration"`       // 请求总耗时, 未结束时为零。
+	Model         string        `json:"model"`          // 客户端请求的模型名称, 即分组名称。
+	Usage         llm.Usage     `json:"usage"`          // 请求结束时写入的展示用量。
+	Cost          float64       `json:"cost"`           // 请求结束时写入的累计费用。
+	EstimatedCost float64       `json:"estimated_cost"` // 转发前按最坏情况估算的费用, 用于与实际费用对比, 无法估算时为零。
+
+	Round         int          `json:"round"`           // 最新一轮循环的递增序号, 人工中止按此匹配以免误杀下一轮。
+	TargetChannel string       `json:"target_channel"`  // 最新一轮选中的渠道名称, 取得可提交响应后改为胜出轮次的渠道。
+	TargetModel   string       `json:"target_model"`    // 最新一轮实际请求上游的模型名称, 取得可提交响应后改为胜出轮次的模型。
+	Sending       bool         `json:"sending"`         // 是否仍有轮次在等待上游响应。
+	Rounds        []RoundState `json:"rounds"`          // 正在等待上游响应的全部轮次, 对冲时可能同时存在两轮。
+	Error         string       `json:"error,omitempty"` // 最近一轮的失败原因, 请求结束后即为最终错误。
+
+	body         string    // 客户端原始请求体, 体积大故不进状态流, 由独立接口按需拉取。
+	responseBody string    // 聚合后的完整最终响应体, 同样按需拉取。
+	apiKeyID     int       // 发起请求的 API Key ID, 用于请求完成后的归属统计。
+	channelID    int       // 最终提交响应的渠道 ID, 用于按渠道价格倍率计算最终费用。
+	units        unitUsage // 最终提交响应按计量单位计费的用量。
+	billed       bool      // 是否计入请求级统计, Token 计数等辅助请求只记请求日志。
+}
+
+// RoundState 是一轮仍在等待上游响应的请求; Rounds 每次变更都整体替换而不原地修改, 已发布的快照因此无需深拷贝。
+type RoundState struct {
+	Round   int    `json:"round"`   // 该轮的递增序号。
+	Channel string `json:"channel"` // 该轮选中的渠道名称。
+	Model   string `json:"model"`   // 该轮实际请求上游的模型名称。
+	Hedge   bool   `json:"hedge"`   // 该轮是否为首轮迟迟没有响应时发起的对冲轮次。
+
+	channelID int                // 该轮选中的渠道 ID。
+	cancel    context.CancelFunc // 人工中止该轮上游请求。
 }
 
 const streamBuffer = 16 // 单个状态流连接的非阻塞消息缓冲容量。
 const maxFinished = 50  // 进程内最多保留的已结束请求数量。
 
 var (
-	idSeq    atomic.Uint64                     // 进程内严格递增的请求 ID。
-	mu       sync.Mutex                        // 全部共享状态的互斥锁。
+	idSeq    atomic.Uint64                          // 进程内严格递增的请求 ID。
+	mu       sync.Mutex                             // 全部共享状态的互斥锁。
 	requests = make(map[uint64]*RequestState)       // 按请求 ID 保存的全部请求状态。
 	watchers = make(map[chan RequestState]struct{}) // 全部状态流 SSE 连接。
 )
 
-// newRequestState 分配请求 ID 并登记初始运行状态; 返回的记录是本请求后续全部状态写入的入口。
-func newRequestState(model, body string, apiKeyID int) *RequestState {
+// newRequestState 分配请求 ID 并登记初始运行状态, estimatedCost 为转发前估算的费用, billed 为 false 的请求结束时不计入请求级统计; 返回的记录是本请求后续全部状态写入的入口。
+func newRequestState(model, body string, apiKeyID int, estimatedCost float64, billed bool) *RequestState {
 	mu.Lock()
 	defer mu.Unlock()
 
 	request := &RequestState{
-		ID:        idSeq.Add(1),
-		Status:    StatusRunning,
-		StartedAt: time.Now(),
-		Model:     model,
-		body:      body,
-		apiKeyID:  apiKeyID,
+		ID:            idSeq.Add(1),
+		Status:        StatusRunning,
+		StartedAt:     time.Now(),
+		Model:         model,
+		EstimatedCost: estimatedCost,
+		body:          body,
+		apiKeyID:      apiKeyID,
+		billed:        billed,
 	}
 	requests[request.ID] = request
 	publishRequestLocked(request)
 	return request
 }
 
-// startRound 记录本轮选中的目标并进入上游请求, cancel 供人工中止本轮, 返回递增的轮次序号。
-func (r *RequestState) startRound(cancel context.CancelFunc, channel, model string) int {
+// startRound 记录本轮选中的目标并进入上游请求, cancel 供人工中止本轮, hedge 表示本轮与已有轮次并发, 返回递增的轮次序号。
+func (r *RequestState) startRound(cancel context.CancelFunc, channel model.Channel, model string, hedge bool) int {
 	mu.Lock()
 	defer mu.Unlock()
 
 	r.Round++
-	r.TargetChannel = channel
+	r.TargetChannel = channel.Name
 	r.TargetModel = model
 	r.Sending = true
 	r.Error = ""
-	r.cancel = cancel
+	r.Rounds = append(slices.Clone(r.Rounds), RoundState{Round: r.Round, Channel: channel.Name, Model: model, Hedge: hedge, channelID: channel.ID, cancel: cancel})
 	publishRequestLocked(r)
 	return r.Round
 }
 
-// finishRound 记录本轮上游结果, errText 为空表示已取得可提交响应。
-func (r *RequestState) finishRound(errText string) {
+// finishRound 记录指定轮次的上游结果, errText 为空表示该轮已取得可提交响应, 请求的目标随之改为该轮。
+func (r *RequestState) finishRound(round int, errText string) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	r.Sending = false
+	index := slices.IndexFunc(r.Rounds, func(state RoundState) bool { return state.Round == round })
+	if index < 0 {
+		return
+	}
+	if errText == "" {
+		r.channelID = r.Rounds[index].channelID
+		r.TargetChannel = r.Rounds[index].Channel
+		r.TargetModel = r.Rounds[index].Model
+	}
+	r.Rounds = slices.Delete(slices.Clone(r.Rounds), index, index+1)
+	r.Sending = len(r.Rounds) > 0
 	r.Error = errText
-	r.cancel = nil
+	publishRequestLocked(r)
+}
+
+// abandonRound 移除已被放弃的对冲轮次, 不改写请求的目标与失败原因; 请求已经结束时不再发布。
+func (r *RequestState) abandonRound(round int) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	index := slices.IndexFunc(r.Rounds, func(state RoundState) bool { return state.Round == round })
+	if index < 0 {
+		return
+	}
+	r.Rounds = slices.Delete(slices.Clone(r.Rounds), index, index+1)
+	r.Sending = len(r.Rounds) > 0
 	publishRequestLocked(r)
 }
 
@@ -103,39 +145,49 @@ func (r *RequestState) finishRound(errText string) {
 func Interrupt(id uint64, round int) {
 	mu.Lock()
 	request := requests[id]
-	if request == nil || request.Round != round || request.cancel == nil {
+	if request == nil {
+		mu.Unlock()
+		return
+	}
+	index := slices.IndexFunc(request.Rounds, func(state RoundState) bool { return state.Round == round })
+	if index < 0 {
 		mu.Unlock()
 		return
 	}
-	cancel := request.cancel
-	request.cancel = nil
+	cancel := request.Rounds[index].cancel
 	mu.Unlock()
 
 	cancel()
 }
 
-// wait 在重新选择目标之前退避 seconds 秒; 客户端在退避期间断开时以取消终态定稿并返回 false。
-func (r *RequestState) wait(ctx context.Context, seconds int) bool {
+// wait 在重新选择目标之前退避 seconds 秒, 且不越过非零的 deadline; 客户端在退避期间断开时以取消终态定稿并返回 false。
+func (r *RequestState) wait(ctx context.Context, seconds int, deadline time.Time) bool {
+	delay := time.Duration(seconds) * time.Second
+	if !deadline.IsZero() {
+		delay = min(delay, time.Until(deadline))
+	}
 	select {
 	case <-ctx.Done():
 		r.markCanceled(ctx.Err(), "", nil)
 		return false
-	case <-time.After(time.Duration(seconds) * time.Second):
+	case <-time.After(delay):
 		return true
 	}
 }
 
-// markCommitted 标记响应已提交; 流式响应在此之后仍会持续转发, 故必须先于提交动作调用。
-func (r *RequestState) markCommitted() {
+// markCommitted 标记响应已提交并记录其计量单位用量; 流式响应在此之后仍会持续转发, 故必须先于提交动作调用。
+func (r *RequestState) markCommitted(units unitUsage) {
 	mu.Lock()
 	defer mu.Unlock()
 
 	r.Status = StatusCommitted
+	r.units = units
 	publishRequestLocked(r)
 }
 
 // markSucceeded 以成功终态定稿请求。
 func (r *RequestState) markSucceeded(responseBody string, usage *llm.Usage) {
+	r.loadPeriodStats()
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -147,6 +199,7 @@ func (r *RequestState) markSucceeded(responseBody string, usage *llm.Usage) {
 
 // markFailed 以失败终态定稿请求, 最终错误取自本次失败原因。
 func (r *RequestState) markFailed(err error, responseBody string, usage *llm.Usage) {
+	r.loadPeriodStats()
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -160,6 +213,7 @@ func (r *RequestState) markFailed(err error, responseBody string, usage *llm.Usa
 
 // markCanceled 以取消终态定稿请求, 用于客户端提前断开或主动取消。
 func (r *RequestState) markCanceled(err error, responseBody string, usage *llm.Usage) {
+	r.loadPeriodStats()
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -171,14 +225,24 @@ func (r *RequestState) markCanceled(err error, responseBody string, usage *llm.U
 	r.finishLocked(usage)
 }
 
+// loadPeriodStats 在获取锁之前载入 API Key 当前预算周期的统计, 使 finishLocked 在锁内只需累加缓存而不访问数据库。
+func (r *RequestState) loadPeriodStats() {
+	if !r.billed || r.apiKeyID <= 0 {
+		return
+	}
+	if err := op.StatsAPIKeyPeriodLoad(r.apiKeyID); err != nil {
+		log.Warnf("failed to load api key period stats: %v", err)
+	}
+}
+
 // finishLocked 写入用量和费用, 发布终态, 更新请求级统计并裁剪历史; 调用方必须持有锁。
 func (r *RequestState) finishLocked(usage *llm.Usage) {
 	r.Sending = false
-	r.cancel = nil
+	r.Rounds = nil
 	if usage != nil {
 		r.Usage = *usage
 	}
-	metrics := usageMetrics(r.TargetModel, usage)
+	metrics := usageMetrics(r.channelID, r.TargetModel, usage, r.units)
 	r.Cost = metrics.InputCost + metrics.OutputCost
 	r.Duration = time.Since(r.StartedAt)
 	metrics.WaitTime = r.Duration.Milliseconds()
@@ -187,11 +251,18 @@ func (r *RequestState) finishLocked(usage *llm.Usage) {
 	} else {
 		metrics.RequestFailed = 1
 	}
-	_ = op.StatsTotalUpdate(metrics)
-	_ = op.StatsHourlyUpdate(metrics)
-	_ = op.StatsDailyUpdate(context.Background(), metrics)
-	if r.apiKeyID > 0 {
-		_ = op.StatsAPIKeyUpdate(r.apiKeyID, metrics)
+	if r.billed {
+		_ = op.StatsTotalUpdate(metrics)
+		_ = op.StatsHourlyUpdate(metrics)
+		_ = op.StatsDailyUpdate(context.Background(), metrics)
+		if r.apiKeyID > 0 {
+			_ = op.StatsAPIKeyUpdate(r.apiKeyID, metrics)
+			_ = op.StatsAPIKeyModelUpdate(r.apiKeyID, r.Model, metrics)
+			if err := op.StatsAPIKeyPeriodUpdate(r.apiKeyID, metrics); err != nil {
+				log.Warnf("failed to update api key period stats: %v", err)
+			}
+			chargeKeyTokens(r.apiKeyID, metrics.InputToken+metrics.OutputToken)
+		}
 	}
 	publishRequestLocked(r)
 
@@ -211,27 +282,53 @@ func (r *RequestState) finishLocked(usage *llm.Usage) {
 	}
 }
 
-// usageMetrics 将统一用量按模型单价转换为 Token 与费用统计; 无用量或价格时对应费用为零。
-func usageMetrics(modelName string, usage *llm.Usage) model.StatsMetrics {
-	if usage == nil {
+// unitUsage 是按张数, 时长, 字符数等计量单位而非 Token 计费的用量, 零值表示本次没有此类用量。
+type unitUsage struct {
+	images       int64   // 生成或编辑得到的图片张数。
+	imageSize    string  // 图片尺寸, 为空时按默认图片价格计费。
+	audioSeconds float64 // 语音转写的输入音频时长, 单位为秒。
+	characters   int64   // 语音合成的输入字符数。
+}
+
+// usageMetrics 将统一用量和计量单位用量按模型单价和渠道价格倍率转换为 Token 与费用统计; 无用量或价格时对应费用为零。
+// 图片费用计入输出费用, 音频时长和字符数的费用计入输入费用。
+func usageMetrics(channelID int, modelName string, usage *llm.Usage, units unitUsage) model.StatsMetrics {
+	if usage == nil && units == (unitUsage{}) {
 		return model.StatsMetrics{}
 	}
-	metrics := model.StatsMetrics{InputToken: usage.PromptTokens, OutputToken: usage.CompletionTokens}
+	var metrics model.StatsMetrics
+	if usage != nil {
+		metrics.InputToken, metrics.OutputToken = usage.PromptTokens, usage.CompletionTokens
+	}
 	price, err := op.LLMGet(modelName)
 	if err != nil {
 		return metrics
 	}
-	cachedTokens, writeCachedTokens := int64(0), int64(0)
-	if usage.PromptTokensDetails != nil {
-		cachedTokens = usage.PromptTokensDetails.CachedTokens
-		writeCachedTokens = usage.PromptTokensDetails.WriteCachedTokens
+	multiplier := priceMultiplier(channelID)
+	if usage != nil {
+		cachedTokens, writeCachedTokens := int64(0), int64(0)
+		if usage.PromptTokensDetails != nil {
+			cachedTokens = usage.PromptTokensDetails.CachedTokens
+			writeCachedTokens = usage.PromptTokensDetails.WriteCachedTokens
+		}
+		inputTokens := max(int64(0), usage.PromptTokens-cachedTokens-writeCachedTokens)
+		metrics.InputCost = (float64(inputTokens)*price.Input + float64(cachedTokens)*price.CacheRead + float64(writeCachedTokens)*price.CacheWrite) / 1_000_000 * multiplier
+		metrics.OutputCost = float64(usage.CompletionTokens) * price.Output / 1_000_000 * multiplier
 	}
-	inputTokens := max(int64(0), usage.PromptTokens-cachedTokens-writeCachedTokens)
-	metrics.InputCost = (float64(inputTokens)*price.Input + float64(cachedTokens)*price.CacheRead + float64(writeCachedTokens)*price.CacheWrite) / 1_000_000
-	metrics.OutputCost = float64(usage.CompletionTokens) * price.Output / 1_000_000
+	metrics.InputCost += (units.audioSeconds*price.AudioSecond + float64(units.characters)*price.Character/1_000_000) * multiplier
+	metrics.OutputCost += float64(units.images) * price.ImagePrice(units.imageSize) * multiplier
 	return metrics
 }
 
+// priceMultiplier 返回渠道生效的价格倍率, 渠道已删除时按原价计算。
+func priceMultiplier(channelID int) float64 {
+	channel, err := op.ChannelGet(channelID)
+	if err != nil {
+		return 1
+	}
+	return channel.CostMultiplier()
+}
+
 // publishRequestLocked 非阻塞发布最新请求状态, 连接拥塞时关闭它并交给客户端重连获取全量快照; 调用方必须持有锁。
 func publishRequestLocked(request *RequestState) {
 	for stream := range watchers {
@@ -7,8 +7,9 @@ import (
 	"io"
 	"net/http"
 	"slices"
+	"strings"
+	"time"
 
-	"github.com/bestruirui/octopus/internal/helper"
 	"github.com/bestruirui/octopus/internal/model"
 	"github.com/looplj/axonhub/llm"
 	"github.com/looplj/axonhub/llm/httpclient"
@@ -16,19 +17,99 @@ import (
 	"github.com/looplj/axonhub/llm/streams"
 	"github.com/looplj/axonhub/llm/transformer"
 	"github.com/looplj/axonhub/llm/transformer/anthropic"
+	"github.com/looplj/axonhub/llm/transformer/gemini"
 	"github.com/looplj/axonhub/llm/transformer/openai"
 	"github.com/looplj/axonhub/llm/transformer/openai/responses"
 )
 
-// upstreamResponse 是已验证但尚未写给客户端的上游成功响应; events 为 nil 表示非流式响应。
+// upstreamResponse 是已验证但尚未写给客户端的上游成功响应; events 与 stream 均为 nil 表示非流式响应。
 // 透传响应保留上游响应头; 跨协议响应由客户端协议决定响应头。失败一律以 error 返回。
 type upstreamResponse struct {
-	body   []byte                                  // 非流式响应的完整正文。
-	header http.Header                             // 同协议透传时需要原样返回的上游响应头。
-	events streams.Stream[*httpclient.StreamEvent] // 流式响应中首个事件之后的剩余事件。
-	first  *httpclient.StreamEvent                 // 已预读并验证的首个事件。
-	last   bool                                    // 首个事件已经终止整个响应流。
-	usage  *llm.Usage                              // 上游本次可确认的用量。
+	body    []byte                                  // 非流式响应的完整正文。
+	header  http.Header                             // 同协议透传时需要原样返回的上游响应头。
+	events  streams.Stream[*httpclient.StreamEvent] // 流式响应中首个事件之后的剩余事件。
+	stream  io.ReadCloser                           // 二进制流式响应尚未读取的正文, 如语音合成的音频。
+	first   *httpclient.StreamEvent                 // 已预读并验证的首个事件。
+	convert eventConverter                          // 剩余事件写给客户端前需经过的协议转换, 为 nil 表示无需转换; 首个事件已经转换完毕。
+	last    bool                                    // 首个事件已经终止整个响应流。
+	usage   *llm.Usage                              // 上游本次可确认的用量。
+	units   unitUsage                               // 上游本次按计量单位计费的用量。
+}
+
+// eventConverter 把一个上游流事件转换为客户端协议的事件。
+type eventConverter func(*httpclient.StreamEvent) (*httpclient.StreamEvent, error)
+
+// close 释放未提交的响应仍占用的上游连接。
+func (r *upstreamResponse) close() {
+	if r.events != nil {
+		r.events.Close()
+	}
+	if r.stream != nil {
+		r.stream.Close()
+	}
+}
+
+// roundTimeoutError 是本轮上游没有在分组配置的时限内给出可提交响应的失败, 与其他失败一样计入成员冷却。
+type roundTimeoutError struct {
+	streaming bool          // 超时的是否为流式首个事件的等待。
+	timeout   time.Duration // 本轮适用的时限。
+}
+
+func (e *roundTimeoutError) Error() string {
+	if e.streaming {
+		return fmt.Sprintf("upstream first event timeout after %s", e.timeout)
+	}
+	return fmt.Sprintf("upstream response timeout after %s", e.timeout)
+}
+
+// newRoundTimeout 按分组配置返回本轮的超时: 非流式限制完整响应, 流式只限制首个有效事件, 首帧之后不再限时。
+func newRoundTimeout(config model.GroupRelayConfig, streaming bool) *roundTimeoutError {
+	model.NormalizeGroupRelayConfig(&config)
+	seconds := config.MemberNonStreamResponseTimeoutSeconds
+	if streaming {
+		seconds = config.MemberStreamFirstEventTimeoutSeconds
+	}
+	return &roundTimeoutError{streaming: streaming, timeout: time.Duration(seconds) * time.Second}
+}
+
+// sendRound 按客户端协议与渠道协议请求上游: Embedding, 文本补全, 图片和语音请求走各自的转换, 其余请求同协议原样直通, 跨协议经转换后请求。
+// 此时尚未写给客户端, 失败仍可换目标重试。
+func sendRound(ctx context.Context, format llm.APIFormat, raw *httpclient.Request, channel model.Channel, streaming bool) (*upstreamResponse, error) {
+	switch format {
+	case llm.APIFormatOpenAIEmbedding:
+		return sendEmbedding(ctx, raw, channel)
+	case APIFormatOpenAICompletion:
+		return sendCompletion(ctx, raw, channel, streaming)
+	case llm.APIFormatOpenAIImageGeneration, APIFormatOpenAIImageEdit:
+		return sendImage(ctx, format, raw, channel)
+	case APIFormatOpenAIAudioTranscription, APIFormatOpenAIAudioSpeech:
+		return sendAudio(ctx, format, raw, channel)
+	}
+	modelName, err := roundModel(format, raw)
+	if err != nil {
+		return nil, err
+	}
+	outbound, passthrough, err := buildOutbound(channel, format, modelName)
+	if err != nil {
+		return nil, err
+	}
+	if passthrough {
+		return sendPassthrough(ctx, format, raw, channel, outbound, streaming)
+	}
+	return sendConverted(ctx, format, raw, channel, outbound, streaming)
+}
+
+// roundModel 返回本轮上游请求的模型名称, Gemini 请求的模型位于地址中, 其余请求位于请求体中。
+func roundModel(format llm.APIFormat, raw *httpclient.Request) (string, error) {
+	if format == llm.APIFormatGeminiContents {
+		action, err := geminiRequestAction(raw.URL)
+		if err != nil {
+			return "", err
+		}
+		modelName, _, _ := strings.Cut(action, ":")
+		return modelName, nil
+	}
+	return requestModel(raw)
 }
 
 // sendPassthrough 以同协议透传方式请求上游, 取得的响应无需转换即可回给客户端。
@@ -37,7 +118,7 @@ func sendPassthrough(ctx context.Context, format llm.APIFormat, raw *httpclient.
 	if err != nil {
 		return nil, err
 	}
-	client, err := helper.ChannelHttpClient(&channel)
+	client, err := channelHTTPClient(channel)
 	if err != nil {
 		return nil, err
 	}
@@ -45,13 +126,10 @@ func sendPassthrough(ctx context.Context, format llm.APIFormat, raw *httpclient.
 		return sendPassthroughStream(ctx, format, request, client)
 	}
 
+	client, recorder := recordRetryAfter(client)
 	response, err := httpclient.NewHttpClientWithClient(client).Do(ctx, request)
 	if err != nil {
-		var failure *httpclient.Error
-		if errors.As(err, &failure) && len(failure.Body) > 0 {
-			return nil, fmt.Errorf("%w: %s", err, failure.Body)
-		}
-		return nil, err
+		return nil, newUpstreamError(err, nil, recorder)
 	}
 	// 同协议下响应可原样回给客户端, 仍需解析一次以取得用量并识别以 200 下发的失败终态。
 	parsed, err := outbound.TransformResponse(ctx, response)
@@ -64,6 +142,20 @@ func sendPassthrough(ctx context.Context, format llm.APIFormat, raw *httpclient.
 	return &upstreamResponse{body: slices.Clone(response.Body), header: response.Headers.Clone(), usage: parsed.Usage}, nil
 }
 
+// doUnaryRequest 使用渠道的 HTTP 客户端发送一次非流式请求, 上游错误状态码包装为可分类的失败。
+func doUnaryRequest(ctx context.Context, request *httpclient.Request, channel model.Channel) (*httpclient.Response, error) {
+	client, err := channelHTTPClient(channel)
+	if err != nil {
+		return nil, err
+	}
+	client, recorder := recordRetryAfter(client)
+	response, err := httpclient.NewHttpClientWithClient(client).Do(ctx, request)
+	if err != nil {
+		return nil, newUpstreamError(err, nil, recorder)
+	}
+	return response, nil
+}
+
 // sendPassthroughStream 发起同协议流式请求并预读首个有效事件, 首个事件通过验证才算本轮取得可提交响应。
 func sendPassthroughStream(ctx context.Context, format llm.APIFormat, request *httpclient.Request, client *http.Client) (*upstreamResponse, error) {
 	rawRequest, err := httpclient.BuildHttpRequest(ctx, request)
@@ -83,7 +175,7 @@ func sendPassthroughStream(ctx context.Context, format llm.APIFormat, request *h
 		if readErr != nil {
 			return nil, readErr
 		}
-		return nil, fmt.Errorf("upstream responded %s: %s", response.Status, failure)
+		return nil, &upstreamError{status: response.StatusCode, body: failure, retryAfter: parseRetryAfter(response.Header), err: fmt.Errorf("upstream responded %s", response.Status)}
 	}
 
 	events := httpclient.NewDefaultSSEDecoder(ctx, response.Body)
@@ -117,8 +209,18 @@ type conversionMiddleware struct {
 	usage   *llm.Usage    // 非流式统一响应中确认的用量。
 }
 
-// OnOutboundRawRequest 在转换后的上游请求上应用渠道参数和自定义 Header。
+// OnOutboundRawRequest 在转换后的上游请求上应用渠道参数和自定义 Header, Azure 与 OpenAI 兼容渠道另需改写地址和认证。
 func (m *conversionMiddleware) OnOutboundRawRequest(_ context.Context, request *httpclient.Request) (*httpclient.Request, error) {
+	var err error
+	switch m.channel.Type {
+	case model.ChannelProviderAzure:
+		err = rewriteAzureRequest(m.channel, request)
+	case model.ChannelProviderCompatible:
+		err = rewriteCompatibleRequest(m.channel, request)
+	}
+	if err != nil {
+		return nil, err
+	}
 	return request, applyChannelConfig(m.channel, request)
 }
 
@@ -153,14 +255,17 @@ func sendConverted(ctx context.Context, format llm.APIFormat, raw *httpclient.Re
 		inbound = responses.NewInboundTransformer()
 	case llm.APIFormatAnthropicMessage:
 		inbound = anthropic.NewInboundTransformer()
+	case llm.APIFormatGeminiContents:
+		inbound = gemini.NewInboundTransformer()
 	default:
 		inbound = openai.NewInboundTransformer()
 	}
 
-	client, err := helper.ChannelHttpClient(&channel)
+	client, err := channelHTTPClient(channel)
 	if err != nil {
 		return nil, err
 	}
+	client, recorder := recordRetryAfter(client)
 	middleware := &conversionMiddleware{channel: channel, format: outbound.APIFormat()}
 	processor := pipeline.NewFactory(httpclient.NewHttpClientWithClient(client)).Pipeline(
 		inbound,
@@ -169,6 +274,10 @@ func sendConverted(ctx context.Context, format llm.APIFormat, raw *httpclient.Re
 	)
 	result, err := processor.Process(ctx, raw)
 	if err != nil {
+		var failure *httpclient.Error
+		if errors.As(err, &failure) {
+			return nil, newUpstreamError(err, middleware.rawBody, recorder)
+		}
 		if len(middleware.rawBody) > 0 {
 			return nil, fmt.Errorf("%w: %s", err, middleware.rawBody)
 		}
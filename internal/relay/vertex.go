@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bestruirui/octopus/internal/helper"
+	"github.com/bestruirui/octopus/internal/model"
+)
+
+// vertexAnthropicVersion 是 Vertex 上 Anthropic 模型要求的请求体 anthropic_version。
+const vertexAnthropicVersion = "vertex-2023-10-16"
+
+// vertexAnthropicModel 判断模型是否由 Anthropic 在 Vertex 上发布, 其余模型按 Google 发布的 Gemini 模型处理。
+func vertexAnthropicModel(modelName string) bool {
+	return strings.HasPrefix(strings.ToLower(modelName), "claude")
+}
+
+// vertexTransport 把 Gemini 或 Anthropic Messages 请求改写为 Vertex 上对应发布方的模型接口, 并以服务账号换取的访问令牌认证。
+// Gemini 请求改写到 generateContent 或 streamGenerateContent, Anthropic 请求改写到 rawPredict 或 streamRawPredict, 响应格式与原生接口相同。
+type vertexTransport struct {
+	base        http.RoundTripper        // 实际发送请求的传输层。
+	channel     model.Channel            // 本轮请求的 Vertex 渠道, Key 为本轮选中的服务账号 JSON。
+	credentials helper.VertexCredentials // 由本轮凭据解析得到的服务账号。
+}
+
+func (t *vertexTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var target string
+	switch {
+	case geminiModelPattern.MatchString(request.URL.Path):
+		action, err := geminiRequestAction(request.URL.Path)
+		if err != nil {
+			return nil, err
+		}
+		query := request.URL.Query()
+		query.Del("key")
+		target = t.modelURL("google", action)
+		if encoded := query.Encode(); encoded != "" {
+			target += "?" + encoded
+		}
+	case strings.HasSuffix(request.URL.Path, "/messages"):
+		payload, modelName, streaming, err := anthropicPlatformPayload(body, request.Header, vertexAnthropicVersion)
+		if err != nil {
+			return nil, err
+		}
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+		method := "rawPredict"
+		if streaming {
+			method = "streamRawPredict"
+		}
+		target = t.modelURL("anthropic", modelName+":"+method)
+	default:
+		return nil, fmt.Errorf("vertex channels only support gemini and anthropic messages, got %s", request.URL.Path)
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := helper.VertexAccessToken(request.Context(), &http.Client{Transport: t.base}, t.credentials)
+	if err != nil {
+		return nil, err
+	}
+	outbound := request.Clone(request.Context())
+	outbound.URL = parsed
+	outbound.Host = ""
+	outbound.Body = io.NopCloser(bytes.NewReader(body))
+	outbound.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	outbound.ContentLength = int64(len(body))
+	for _, name := range []string{"X-Goog-Api-Key", "X-Api-Key", "Anthropic-Version", "Anthropic-Beta"} {
+		outbound.Header.Del(name)
+	}
+	outbound.Header.Set("Authorization", "Bearer "+token)
+	outbound.Header.Set("Content-Type", "application/json")
+	return t.base.RoundTrip(outbound)
+}
+
+// modelURL 返回 Vertex 上某个发布方模型的接口地址, action 为 {model}:{method}。
+func (t *vertexTransport) modelURL(publisher, action string) string {
+	return helper.VertexEndpoint(t.channel) + "/v1/projects/" + url.PathEscape(helper.VertexProject(t.channel, t.credentials)) +
+		"/locations/" + url.PathEscape(helper.VertexLocation(t.channel)) + "/publishers/" + publisher + "/models/" + action
+}
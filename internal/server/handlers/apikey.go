@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bestruirui/octopus/internal/model"
 	"github.com/bestruirui/octopus/internal/op"
@@ -119,9 +120,30 @@ func getStatsAPIKeyById(c *gin.Context) {
 		modelsString = strings.Join(models, ", ")
 	}
 	info.SupportedModels = modelsString
+	// 启用周期预算时附带当前周期的已用费用, 剩余预算与下次重置的 Unix 时间。
+	var budget map[string]any
+	if info.BudgetPeriod != "" && info.BudgetCost > 0 {
+		period, err := op.StatsAPIKeyPeriodGet(info)
+		if err != nil {
+			resp.Error(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		used := period.StatsMetrics.InputCost + period.StatsMetrics.OutputCost
+		_, resetAt := info.BudgetWindow(time.Now())
+		budget = map[string]any{
+			"period":    info.BudgetPeriod,
+			"cost":      info.BudgetCost,
+			"used":      used,
+			"remaining": max(info.BudgetCost-used, 0),
+			"reset_at":  resetAt.Unix(),
+			"stats":     period,
+		}
+	}
 	resp.Success(c, map[string]any{
-		"stats": stats,
-		"info":  info,
+		"stats":       stats,
+		"info":        info,
+		"budget":      budget,
+		"model_stats": op.StatsAPIKeyModelList(id),
 	})
 }
 
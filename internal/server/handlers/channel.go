@@ -64,6 +64,7 @@ func listChannel(c *gin.Context) {
 	for i, channel := range channels {
 		stats := op.StatsChannelGet(channel.ID)
 		channels[i].Stats = &stats
+		channels[i].KeyStats = op.StatsChannelKeyList(channel.ID)
 	}
 	resp.Success(c, channels)
 }
@@ -87,6 +88,7 @@ func createChannel(c *gin.Context) {
 	}
 	stats := op.StatsChannelGet(channel.ID)
 	channel.Stats = &stats
+	channel.KeyStats = op.StatsChannelKeyList(channel.ID)
 	resp.Success(c, channel)
 }
 
@@ -120,6 +122,7 @@ func updateChannel(c *gin.Context) {
 	}
 	stats := op.StatsChannelGet(channel.ID)
 	channel.Stats = &stats
+	channel.KeyStats = op.StatsChannelKeyList(channel.ID)
 	resp.Success(c, channel)
 }
 
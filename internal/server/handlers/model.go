@@ -192,10 +192,13 @@ func rebuildLLMPrice(c *gin.Context) {
 
 	llmInfos := op.LLMList()
 	for i := range llmInfos {
-		llmInfos[i].LLMPrice = model.LLMPrice{}
+		// 校准价格只包含 Token 单价, 人工配置的图片, 音频和字符价格保持不变。
+		var calibrated model.LLMPrice
 		if modelPrice := price.GetLLMPrice(llmInfos[i].Name); modelPrice != nil {
-			llmInfos[i].LLMPrice = *modelPrice
+			calibrated = *modelPrice
 		}
+		llmInfos[i].Input, llmInfos[i].Output = calibrated.Input, calibrated.Output
+		llmInfos[i].CacheRead, llmInfos[i].CacheWrite = calibrated.CacheRead, calibrated.CacheWrite
 	}
 	if err := op.LLMBatchSave(llmInfos, ctx); err != nil {
 		resp.Error(c, http.StatusInternalServerError, err.Error())
@@ -12,10 +12,15 @@ import (
 func init() {
 	router.NewGroupRouter("/v1").
 		Use(middleware.APIKeyAuth()).
+		Use(middleware.APIKeyBudget()).
 		AddRoute(
 			router.NewRoute("/chat/completions", http.MethodPost).
 				Handle(relay.Forward(llm.APIFormatOpenAIChatCompletion)),
 		).
+		AddRoute(
+			router.NewRoute("/completions", http.MethodPost).
+				Handle(relay.Forward(relay.APIFormatOpenAICompletion)),
+		).
 		AddRoute(
 			router.NewRoute("/responses", http.MethodPost).
 				Handle(relay.Forward(llm.APIFormatOpenAIResponse)),
@@ -23,5 +28,40 @@ func init() {
 		AddRoute(
 			router.NewRoute("/messages", http.MethodPost).
 				Handle(relay.Forward(llm.APIFormatAnthropicMessage)),
+		).
+		AddRoute(
+			router.NewRoute("/messages/count_tokens", http.MethodPost).
+				Handle(relay.CountTokens(relay.APIFormatAnthropicCountTokens)),
+		).
+		AddRoute(
+			router.NewRoute("/responses/input_tokens", http.MethodPost).
+				Handle(relay.CountTokens(relay.APIFormatOpenAIInputTokens)),
+		).
+		AddRoute(
+			router.NewRoute("/embeddings", http.MethodPost).
+				Handle(relay.Forward(llm.APIFormatOpenAIEmbedding)),
+		).
+		AddRoute(
+			router.NewRoute("/images/generations", http.MethodPost).
+				Handle(relay.Forward(llm.APIFormatOpenAIImageGeneration)),
+		).
+		AddRoute(
+			router.NewRoute("/images/edits", http.MethodPost).
+				Handle(relay.Forward(relay.APIFormatOpenAIImageEdit)),
+		).
+		AddRoute(
+			router.NewRoute("/audio/transcriptions", http.MethodPost).
+				Handle(relay.Forward(relay.APIFormatOpenAIAudioTranscription)),
+		).
+		AddRoute(
+			router.NewRoute("/audio/speech", http.MethodPost).
+				Handle(relay.Forward(relay.APIFormatOpenAIAudioSpeech)),
+		)
+	router.NewGroupRouter("/v1beta").
+		Use(middleware.APIKeyAuth()).
+		Use(middleware.APIKeyBudget()).
+		AddRoute(
+			router.NewRoute("/models/:action", http.MethodPost).
+				Handle(relay.Forward(llm.APIFormatGeminiContents)),
 		)
 }
@@ -137,6 +137,9 @@ func importDB(c *gin.Context) {
 		dump.Channels[i].CustomModel = normalizeChannelModelList(dump.Channels[i].CustomModel)
 		dump.Channels[i].Model = excludeCustomChannelModels(dump.Channels[i].Model, dump.Channels[i].CustomModel)
 	}
+	for i := range dump.GroupItems {
+		dump.GroupItems[i].Weight = max(dump.GroupItems[i].Weight, 1)
+	}
 	seenLLMNames := make(map[string]struct{}, len(dump.LLMInfos))
 	for i := range dump.LLMInfos {
 		dump.LLMInfos[i].Name = strings.ToLower(strings.TrimSpace(dump.LLMInfos[i].Name))
@@ -155,7 +158,7 @@ func importDB(c *gin.Context) {
 			dump.Groups[i].Mode = model.GroupModeManual
 		}
 		model.NormalizeGroupRelayConfig(&dump.Groups[i].RelayConfig)
-		if dump.Groups[i].Mode != model.GroupModeManual && dump.Groups[i].Mode != model.GroupModeFailover {
+		if !dump.Groups[i].Mode.Valid() {
 			resp.Error(c, http.StatusBadRequest, "invalid group relay mode")
 			return
 		}
@@ -186,6 +189,7 @@ func decodeDBDump(body []byte, dump *model.DBDump) error {
 
 	if dump.Version == 0 &&
 		len(dump.Channels) == 0 &&
+		len(dump.ChannelKeys) == 0 &&
 		len(dump.Groups) == 0 &&
 		len(dump.GroupItems) == 0 &&
 		len(dump.Settings) == 0 &&
@@ -195,8 +199,11 @@ func decodeDBDump(body []byte, dump *model.DBDump) error {
 		len(dump.StatsHourly) == 0 &&
 		len(dump.StatsTotal) == 0 &&
 		len(dump.StatsChannel) == 0 &&
+		len(dump.StatsChannelKey) == 0 &&
 		len(dump.StatsModel) == 0 &&
-		len(dump.StatsAPIKey) == 0 {
+		len(dump.StatsAPIKey) == 0 &&
+		len(dump.StatsAPIKeyModel) == 0 &&
+		len(dump.StatsAPIKeyPeriod) == 0 {
 		var wrapper struct {
 			Code    int             `json:"code"`
 			Message string          `json:"message"`
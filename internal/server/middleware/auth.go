@@ -38,6 +38,10 @@ func APIKeyAuth() gin.HandlerFunc {
 			apiKey = key
 		} else if authorization := c.Request.Header.Get("Authorization"); authorization != "" {
 			apiKey = strings.TrimPrefix(authorization, "Bearer ")
+		} else if key := c.Request.Header.Get("x-goog-api-key"); key != "" {
+			apiKey = key
+		} else if key := c.Request.URL.Query().Get("key"); key != "" {
+			apiKey = key
 		}
 
 		if apiKey == "" {
@@ -73,8 +77,40 @@ func APIKeyAuth() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		// Gemini 客户端的凭据位于专用 Header 或查询参数, 校验后移除, 避免随请求透传给上游。
+		c.Request.Header.Del("x-goog-api-key")
+		if query := c.Request.URL.Query(); query.Has("key") {
+			query.Del("key")
+			c.Request.URL.RawQuery = query.Encode()
+		}
 		c.Set("supported_models", apiKeyObj.SupportedModels)
 		c.Set("api_key_id", apiKeyObj.ID)
 		c.Next()
 	}
 }
+
+// APIKeyBudget 拒绝已用尽当前周期预算的 API Key, 须位于 APIKeyAuth 之后, 只用于转发接口, 使预算用尽后仍可查询用量。
+// 同时载入当前周期的统计, 请求结束时只需在缓存中累加费用。
+func APIKeyBudget() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKeyObj, err := op.APIKeyGet(c.GetInt("api_key_id"), c.Request.Context())
+		if err != nil {
+			resp.Error(c, http.StatusUnauthorized, resp.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+		// 周期预算只比较当前周期内的费用, 新周期开始即自动恢复。
+		period, err := op.StatsAPIKeyPeriodGet(apiKeyObj)
+		if err != nil {
+			resp.Error(c, http.StatusInternalServerError, err.Error())
+			c.Abort()
+			return
+		}
+		if apiKeyObj.BudgetPeriod != "" && apiKeyObj.BudgetCost > 0 && apiKeyObj.BudgetCost <= period.StatsMetrics.InputCost+period.StatsMetrics.OutputCost {
+			resp.Error(c, http.StatusUnauthorized, "API key has reached the budget for the current period")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}